@@ -2,11 +2,19 @@ package hdhomerun
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/joydip/hdhomerun/internal/libhdhomerun"
@@ -17,32 +25,192 @@ import (
 type Client struct {
 	mu      sync.Mutex
 	c       net.Conn
-	b       []byte
+	r       *Reader
 	timeout time.Duration
+	lockkey uint32
+
+	// Set when a Pipeline fails after writing its requests, which may leave
+	// unread replies on the connection.
+	broken bool
+
+	// Cached device features and tuner count, guarded by fmu. A device may
+	// have no tuners, so ntunersOK reports whether ntuners is cached.
+	fmu       sync.Mutex
+	features  map[string][]string
+	ntuners   int
+	ntunersOK bool
+
+	dialer          *net.Dialer
+	readBuffer      int
+	sockReadBuffer  int
+	sockWriteBuffer int
 }
 
 // Dial dials a TCP connection to an HDHomeRun device.
 //
-// For more control over the Client, use a net.Conn with NewClient instead.
-func Dial(addr string) (*Client, error) {
-	conn, err := net.Dial("tcp", addr)
+// If needed, ClientOptions can be provided to modify the behavior of the
+// Client. For more control over the Client, use a net.Conn with NewClient
+// instead.
+func Dial(addr string, options ...ClientOption) (*Client, error) {
+	c, err := newClient(options)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.dialer.Dial("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewClient(conn)
+	if err := c.init(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return c, nil
 }
 
 // NewClient wraps an existing net.Conn to create a Client.
-func NewClient(conn net.Conn) (*Client, error) {
+//
+// If needed, ClientOptions can be provided to modify the behavior of the
+// Client. Options which only apply to Dial, such as ClientDialer, have no
+// effect.
+func NewClient(conn net.Conn, options ...ClientOption) (*Client, error) {
+	c, err := newClient(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.init(conn); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// newClient creates a Client with the input options applied, but without
+// an underlying connection.
+func newClient(options []ClientOption) (*Client, error) {
 	c := &Client{
-		c: conn,
-		b: make([]byte, libhdhomerun.MaxPacketSize),
+		// Large enough to buffer a few maximum size Packets.
+		readBuffer: defaultReadBuffer,
+		dialer: &net.Dialer{
+			Timeout: defaultDialTimeout,
+		},
+	}
+
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, err
+		}
 	}
 
 	return c, nil
 }
 
+// init configures the Client to communicate using conn.
+func (c *Client) init(conn net.Conn) error {
+	// Only configure the socket buffers when requested, so the operating
+	// system defaults are used otherwise.
+	if c.sockReadBuffer != 0 {
+		if err := setSocketBuffer(conn, c.sockReadBuffer, true); err != nil {
+			return err
+		}
+	}
+	if c.sockWriteBuffer != 0 {
+		if err := setSocketBuffer(conn, c.sockWriteBuffer, false); err != nil {
+			return err
+		}
+	}
+
+	c.c = conn
+	c.r = NewReaderSize(conn, c.readBuffer)
+
+	return nil
+}
+
+const (
+	// defaultReadBuffer is the default size of a Client's internal read
+	// buffer.
+	defaultReadBuffer = 4096
+
+	// defaultDialTimeout is the default timeout used by Dial when
+	// connecting to a device.
+	defaultDialTimeout = 5 * time.Second
+)
+
+// errClientBroken is returned by a Client whose connection may hold unread
+// replies to an earlier Pipeline, which would otherwise be mistaken for
+// replies to later requests.
+var errClientBroken = errors.New("client connection out of sync after failed pipeline; reconnect to continue")
+
+// A ClientOption is an option which modifies the behavior of a Client.
+type ClientOption func(c *Client) error
+
+// ClientReadBuffer sets the size in bytes of a Client's internal read buffer
+// and the receive buffer of its underlying TCP socket. Larger buffers can
+// improve performance when reading large values, such as channel lineups.
+func ClientReadBuffer(n int) ClientOption {
+	return func(c *Client) error {
+		if n <= 0 {
+			return fmt.Errorf("read buffer size must be positive: %d", n)
+		}
+
+		c.readBuffer = n
+		c.sockReadBuffer = n
+		return nil
+	}
+}
+
+// ClientWriteBuffer sets the size in bytes of the send buffer of a Client's
+// underlying TCP socket. Larger buffers can improve performance when writing
+// large values or using Pipeline.
+func ClientWriteBuffer(n int) ClientOption {
+	return func(c *Client) error {
+		if n <= 0 {
+			return fmt.Errorf("write buffer size must be positive: %d", n)
+		}
+
+		c.sockWriteBuffer = n
+		return nil
+	}
+}
+
+// ClientDialer sets the net.Dialer used by Dial to connect to a device,
+// allowing control over the connection timeout, TCP keepalive, and local
+// address. By default, Dial uses a net.Dialer with a short connection
+// timeout.
+func ClientDialer(d *net.Dialer) ClientOption {
+	return func(c *Client) error {
+		if d == nil {
+			return errors.New("dialer must not be nil")
+		}
+
+		c.dialer = d
+		return nil
+	}
+}
+
+// setSocketBuffer sets the receive or send buffer size of conn, if conn
+// supports it. Other connection types are left unmodified.
+func setSocketBuffer(conn net.Conn, n int, read bool) error {
+	type buffers interface {
+		SetReadBuffer(bytes int) error
+		SetWriteBuffer(bytes int) error
+	}
+
+	bc, ok := conn.(buffers)
+	if !ok {
+		return nil
+	}
+
+	if read {
+		return bc.SetReadBuffer(n)
+	}
+
+	return bc.SetWriteBuffer(n)
+}
+
 // SetTimeout sets a per-request timeout for a combined write and read
 // interaction with an HDHomeRun device. For finer control, use a
 // pre-configured net.Conn with NewClient.
@@ -56,6 +224,16 @@ func (c *Client) SetTimeout(d time.Duration) {
 	c.timeout = d
 }
 
+// SetLockKey sets the lock key sent with each set request, which is required
+// to modify a tuner that has been locked with the same key by setting its
+// "lockkey" value. A key of zero indicates that no lock key should be sent.
+func (c *Client) SetLockKey(key uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lockkey = key
+}
+
 // Close closes the Client's underlying connection.
 func (c *Client) Close() error {
 	c.mu.Lock()
@@ -68,7 +246,9 @@ func (c *Client) Close() error {
 // reply from the device.
 //
 // Execute is a low-level method that does no request validation, and should
-// be used with great caution.
+// be used with great caution. It does verify that the reply's type is the one
+// expected for the request's type, which catches crossed or misframed
+// streams.
 //
 // Most users should use the Query method instead.
 func (c *Client) Execute(req *Packet) (*Packet, error) {
@@ -77,6 +257,10 @@ func (c *Client) Execute(req *Packet) (*Packet, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.broken {
+		return nil, errClientBroken
+	}
+
 	// When configured, only allow a certain amount of time for a write and
 	// a subsequent read.
 	if c.timeout != 0 {
@@ -95,17 +279,93 @@ func (c *Client) Execute(req *Packet) (*Packet, error) {
 		return nil, err
 	}
 
-	n, err := c.c.Read(c.b)
+	rep, err := c.r.ReadPacket()
 	if err != nil {
 		return nil, err
 	}
 
-	var rep Packet
-	if err := rep.UnmarshalBinary(c.b[:n]); err != nil {
+	if err := checkReplyType(req, rep); err != nil {
+		return nil, err
+	}
+
+	return rep, nil
+}
+
+// Pipeline sends multiple requests to an HDHomeRun device at once, and then
+// reads a reply for each request. The replies are returned in the same order
+// as the requests.
+//
+// The HDHomeRun control protocol has no request identifiers, so Pipeline
+// relies on the device processing requests on a connection in the order they
+// are received and replying to each in turn. This avoids waiting for a round
+// trip per request, which improves throughput for bulk operations such as
+// reading many values at once.
+//
+// Like Execute, Pipeline is a low-level method that does no request
+// validation, and should be used with great caution.
+//
+// If writing the requests or reading any reply fails, replies to the
+// remaining requests may still arrive later, so all further requests on the
+// Client return an error. The Client should be closed and a new connection
+// dialed.
+func (c *Client) Pipeline(reqs []*Packet) ([]*Packet, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.broken {
+		return nil, errClientBroken
+	}
+
+	// When configured, only allow a certain amount of time for all writes and
+	// subsequent reads.
+	if c.timeout != 0 {
+		deadline := time.Now().Add(c.timeout)
+		if err := c.c.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	// Send all requests in a single write.
+	var b []byte
+	for _, req := range reqs {
+		pb, err := req.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+
+		b = append(b, pb...)
+	}
+
+	// Once any requests may have been written, a failure leaves the replies
+	// to the remaining requests unread, so the Client cannot be used again.
+	if _, err := c.c.Write(b); err != nil {
+		c.broken = true
 		return nil, err
 	}
 
-	return &rep, nil
+	// Read every reply even if one has an unexpected type, so that no stale
+	// replies are left on the connection.
+	var terr error
+	reps := make([]*Packet, 0, len(reqs))
+	for _, req := range reqs {
+		rep, err := c.r.ReadPacket()
+		if err != nil {
+			c.broken = true
+			return nil, err
+		}
+
+		if err := checkReplyType(req, rep); err != nil && terr == nil {
+			terr = err
+		}
+
+		reps = append(reps, rep)
+	}
+
+	if terr != nil {
+		return nil, terr
+	}
+
+	return reps, nil
 }
 
 // Query performs a read-only query to retrieve information from an HDHomeRun
@@ -115,16 +375,183 @@ func (c *Client) Execute(req *Packet) (*Packet, error) {
 // If the query tries to read a key that does not exist, IsNotExist can be
 // used to check this error.
 func (c *Client) Query(query string) ([]byte, error) {
-	queryb := strBytes(query)
-
-	req := &Packet{
-		Type: libhdhomerun.TypeGetsetReq,
-		Tags: []Tag{
-			{
-				Type: libhdhomerun.TagGetsetName,
-				Data: queryb,
-			},
-		},
+	return c.getSet(query, nil)
+}
+
+// GetGlob queries every key matching a wildcard pattern, such as "/tuner0/*",
+// in a single request, and returns a map of the matching keys to their values.
+// Firmware which supports wildcards replies with one "name=value" line per
+// matching key.
+//
+// Older firmware treats the pattern as a literal key which does not exist.
+// IsNotExist can be used to check for this error, in which case each key must
+// be queried individually.
+func (c *Client) GetGlob(pattern string) (map[string]string, error) {
+	b, err := c.Query(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGlob(bytesStr(b))
+}
+
+// parseGlob parses the "name=value" lines of a wildcard query reply.
+func parseGlob(s string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) == "" {
+			// Probably an empty line.
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("malformed wildcard query line: %q", line)
+		}
+
+		values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return values, nil
+}
+
+// Set sets the value of a key on an HDHomeRun device, and returns the
+// updated value reported by the device in its reply.
+//
+// If the set tries to write a key that does not exist, IsNotExist can be
+// used to check this error.
+func (c *Client) Set(name, value string) ([]byte, error) {
+	return c.getSet(name, strBytes(value))
+}
+
+// SetLarge sets a value on an HDHomeRun device which is too large to fit
+// in a single Packet, by sending the requests produced by SplitSetRequests
+// in order. Each segment of value is written with a separate set request,
+// so SetLarge is only suitable for keys which accept values written in
+// segments. Each request leaves room for the lock key set with SetLockKey.
+func (c *Client) SetLarge(name, value string) error {
+	// Leave room for the lock key tag added to each request.
+	maxPayload := libhdhomerun.MaxPayloadSize
+	if c.lockKey() != 0 {
+		maxPayload -= tagLength(4)
+	}
+
+	reqs := SplitSetRequests(name, value, maxPayload)
+	if reqs == nil {
+		return fmt.Errorf("name is too large for a set request: %q", name)
+	}
+
+	for _, req := range reqs {
+		c.addLockKey(req)
+		if _, err := c.executeGetSet(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SplitSetRequests splits value into segments and produces the minimum number
+// of get/set request Packets needed to set name to value, such that the tags
+// of each Packet do not exceed maxPayload bytes.
+//
+// If maxPayload is too small to carry name and at least one byte of value,
+// SplitSetRequests returns nil.
+func SplitSetRequests(name, value string, maxPayload int) []*Packet {
+	// Determine how many bytes of each request remain after the name tag,
+	// and how large a segment fits in a value tag of that size. The value
+	// tag also carries a null terminator after the segment.
+	room := maxPayload - tagLength(len(strBytes(name)))
+	n := room - tagLength(1)
+	if tagLength(n+1) > room {
+		// Value tag needs a second length byte.
+		n--
+	}
+
+	if n < 1 {
+		return nil
+	}
+
+	var reqs []*Packet
+	for {
+		chunk := value
+		if len(chunk) > n {
+			chunk = chunk[:n]
+		}
+		value = value[len(chunk):]
+
+		reqs = append(reqs, newGetSetRequest(name, strBytes(chunk)))
+
+		if len(value) == 0 {
+			return reqs
+		}
+	}
+}
+
+// getSet performs a get/set request for the key name. If value is nil, a
+// get request is issued. Otherwise, a set request is issued with value.
+func (c *Client) getSet(name string, value []byte) ([]byte, error) {
+	req := newGetSetRequest(name, value)
+	if value != nil {
+		c.addLockKey(req)
+	}
+
+	return c.executeGetSet(req)
+}
+
+// lockKey returns the Client's configured lock key.
+func (c *Client) lockKey() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lockkey
+}
+
+// addLockKey adds the Client's lock key, if one is configured, to a set
+// request.
+func (c *Client) addLockKey(req *Packet) {
+	key := c.lockKey()
+	if key == 0 {
+		return
+	}
+
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, key)
+
+	req.Tags = append(req.Tags, Tag{
+		Type: libhdhomerun.TagGetsetLockkey,
+		Data: b,
+	})
+}
+
+// newGetSetRequest creates a get/set request Packet for the key name. If
+// value is nil, the request is a get request.
+func newGetSetRequest(name string, value []byte) *Packet {
+	// Name, value, and lock key.
+	req := NewPacket(libhdhomerun.TypeGetsetReq, 3)
+	req.Tags = append(req.Tags, Tag{
+		Type: libhdhomerun.TagGetsetName,
+		Data: strBytes(name),
+	})
+
+	if value != nil {
+		req.Tags = append(req.Tags, Tag{
+			Type: libhdhomerun.TagGetsetValue,
+			Data: value,
+		})
+	}
+
+	return req
+}
+
+// executeGetSet executes a get/set request and returns the value carried by
+// its reply.
+func (c *Client) executeGetSet(req *Packet) ([]byte, error) {
+	var nameb []byte
+	for _, t := range req.Tags {
+		if t.Type == libhdhomerun.TagGetsetName {
+			nameb = t.Data
+		}
 	}
 
 	rep, err := c.Execute(req)
@@ -132,34 +559,94 @@ func (c *Client) Query(query string) ([]byte, error) {
 		return nil, err
 	}
 
+	return parseGetSetReply(nameb, rep)
+}
+
+// pipelineQuery performs a query for each of names using Pipeline. It returns
+// the value and error for each query in the same order as names. The returned
+// error is non-nil only if the Pipeline itself fails.
+func (c *Client) pipelineQuery(names []string) ([][]byte, []error, error) {
+	reqs := make([]*Packet, 0, len(names))
+	for _, name := range names {
+		reqs = append(reqs, newGetSetRequest(name, nil))
+	}
+
+	reps, err := c.Pipeline(reqs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([][]byte, len(names))
+	errs := make([]error, len(names))
+	for i, rep := range reps {
+		values[i], errs[i] = parseGetSetReply(strBytes(names[i]), rep)
+	}
+
+	return values, errs, nil
+}
+
+// parseGetSetReply validates a get/set reply to the request for the key
+// nameb, and returns the value it carries.
+func parseGetSetReply(nameb []byte, rep *Packet) ([]byte, error) {
 	if rep.Type != libhdhomerun.TypeGetsetRpy {
-		return nil, fmt.Errorf("expected get/set reply, but got %#x", rep.Type)
+		return nil, errUnexpectedReplyType
 	}
 
 	// Expect to find both a name and value tag, and the name should be identical
-	// to the query we provided in the request.
-	var name, value []byte
+	// to the name we provided in the request.
+	var rname, rvalue []byte
 	for _, t := range rep.Tags {
 		switch t.Type {
 		case libhdhomerun.TagGetsetName:
-			name = t.Data
+			rname = t.Data
 		case libhdhomerun.TagGetsetValue:
-			value = t.Data
-		case libhdhomerun.TagErrorMessage:
-			// If an error is present, handle it and return an Error.
-			return nil, newError(t.Data)
+			rvalue = t.Data
 		}
 	}
 
-	if name == nil || value == nil {
-		return nil, errors.New("missing query name and/or value in query reply")
+	// If any errors are present, handle them and return an Error.
+	if err := rep.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := rep.Require(libhdhomerun.TagGetsetName, libhdhomerun.TagGetsetValue); err != nil {
+		return nil, err
 	}
 
-	if !bytes.Equal(name, queryb) {
-		return nil, fmt.Errorf("unexpected query in reply packet: %s", bytesStr(name))
+	if !bytes.Equal(rname, nameb) {
+		return nil, fmt.Errorf("unexpected query in reply packet: %s", bytesStr(rname))
 	}
 
-	return value, nil
+	return rvalue, nil
+}
+
+// NewKeepalive creates a get request for "/sys/model", which is cheap for a
+// device to answer and has no side effects. It is suitable for periodically
+// sending on an otherwise idle connection to keep it open.
+func NewKeepalive() *Packet {
+	return newGetSetRequest("/sys/model", nil)
+}
+
+// Keepalive sends a keepalive request produced by NewKeepalive to an
+// HDHomeRun device once per interval, to prevent an idle connection from
+// being dropped by intermediate firewalls or NAT devices. Keepalive blocks
+// until the context is canceled, in which case the context's error is
+// returned, or until a request fails, in which case that error is returned.
+func (c *Client) Keepalive(ctx context.Context, interval time.Duration) error {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+
+		if _, err := c.executeGetSet(NewKeepalive()); err != nil {
+			return err
+		}
+	}
 }
 
 // Model returns the model name of an HDHomeRun device.
@@ -172,6 +659,640 @@ func (c *Client) Model() (string, error) {
 	return bytesStr(b), nil
 }
 
+// HardwareModel returns the hardware model name of an HDHomeRun device, such
+// as "HDHR5-4US".
+func (c *Client) HardwareModel() (string, error) {
+	b, err := c.Query("/sys/hwmodel")
+	if err != nil {
+		return "", err
+	}
+
+	return bytesStr(b), nil
+}
+
+// Copyright returns the copyright notice of an HDHomeRun device's firmware.
+func (c *Client) Copyright() (string, error) {
+	b, err := c.Query("/sys/copyright")
+	if err != nil {
+		return "", err
+	}
+
+	return bytesStr(b), nil
+}
+
+// SystemInfo contains identifying information about an HDHomeRun device.
+// Fields which are not supported by a device's firmware are left empty.
+type SystemInfo struct {
+	Model           string
+	HardwareModel   string
+	FirmwareVersion string
+	Copyright       string
+}
+
+// SystemInfo retrieves identifying information about an HDHomeRun device in
+// a single round trip, using Pipeline. Values which are not supported by
+// older firmware are left empty rather than returning an error.
+func (c *Client) SystemInfo() (*SystemInfo, error) {
+	var info SystemInfo
+	fields := []struct {
+		name string
+		v    *string
+	}{
+		{name: "/sys/model", v: &info.Model},
+		{name: "/sys/hwmodel", v: &info.HardwareModel},
+		{name: "/sys/version", v: &info.FirmwareVersion},
+		{name: "/sys/copyright", v: &info.Copyright},
+	}
+
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+
+	values, errs, err := c.pipelineQuery(names)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, f := range fields {
+		switch {
+		case errs[i] == nil:
+			*f.v = bytesStr(values[i])
+		case IsNotExist(errs[i]):
+			// Unsupported by this firmware; leave empty.
+		default:
+			return nil, errs[i]
+		}
+	}
+
+	return &info, nil
+}
+
+// NetworkConfig contains the IP configuration of an HDHomeRun device. Fields
+// which are not reported by a device are left empty.
+type NetworkConfig struct {
+	IP      net.IP
+	Netmask net.IPMask
+	Gateway net.IP
+	DNS     []net.IP
+}
+
+// NetworkConfig retrieves the IP configuration of an HDHomeRun device in a
+// single round trip, using Pipeline. Values which are not reported by some
+// models are left empty rather than returning an error.
+func (c *Client) NetworkConfig() (*NetworkConfig, error) {
+	names := []string{
+		"/sys/ip_addr",
+		"/sys/subnet_mask",
+		"/sys/gateway",
+		"/sys/dns",
+	}
+
+	values, errs, err := c.pipelineQuery(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var ss [4]string
+	for i := range names {
+		switch {
+		case errs[i] == nil:
+			ss[i] = bytesStr(values[i])
+		case IsNotExist(errs[i]):
+			// Unsupported by this model; leave empty.
+		default:
+			return nil, errs[i]
+		}
+	}
+
+	return parseNetworkConfig(ss[0], ss[1], ss[2], ss[3])
+}
+
+// parseNetworkConfig parses the IP address, subnet mask, gateway, and
+// space-delimited DNS server values of a device into a NetworkConfig. Empty
+// values are skipped.
+func parseNetworkConfig(ip, mask, gateway, dns string) (*NetworkConfig, error) {
+	parseIP := func(s string) (net.IP, error) {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("malformed IP address: %q", s)
+		}
+
+		return ip, nil
+	}
+
+	var (
+		cfg NetworkConfig
+		err error
+	)
+
+	if s := strings.TrimSpace(ip); s != "" {
+		if cfg.IP, err = parseIP(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := strings.TrimSpace(mask); s != "" {
+		m, err := parseIP(s)
+		if err != nil {
+			return nil, err
+		}
+
+		m4 := m.To4()
+		if m4 == nil {
+			return nil, fmt.Errorf("malformed subnet mask: %q", s)
+		}
+
+		cfg.Netmask = net.IPMask(m4)
+	}
+
+	if s := strings.TrimSpace(gateway); s != "" {
+		if cfg.Gateway, err = parseIP(s); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range strings.Fields(dns) {
+		ip, err := parseIP(s)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.DNS = append(cfg.DNS, ip)
+	}
+
+	return &cfg, nil
+}
+
+// DeviceHealth summarizes the health of an HDHomeRun device, as reported by
+// Client.Health. Each value which could not be retrieved is left empty and
+// the reason is recorded in the accompanying error field.
+type DeviceHealth struct {
+	Model    string
+	ModelErr error
+
+	FirmwareVersion    string
+	FirmwareVersionErr error
+
+	// Tuners is empty and TunersErr is set if the number of tuners could
+	// not be determined.
+	Tuners    []TunerHealth
+	TunersErr error
+}
+
+// TunerHealth is the health of a single tuner within a DeviceHealth.
+type TunerHealth struct {
+	Index int
+
+	// Status is the lock and signal status of the tuner. It is nil if the
+	// tuner reported no status, or if Err is set.
+	Status *TunerStatus
+	Err    error
+}
+
+// Health retrieves the model, firmware version, and lock and signal status
+// of each tuner of an HDHomeRun device. All values are retrieved in a single
+// round trip using Pipeline, once the number of tuners is known (see
+// Tuners), and so the whole operation is bounded by the timeout configured
+// with SetTimeout.
+//
+// Health is intended for periodic monitoring, and so it returns partial
+// results: failures of individual values are recorded in DeviceHealth rather
+// than returned. An error is returned only if the device cannot be reached.
+func (c *Client) Health() (*DeviceHealth, error) {
+	var h DeviceHealth
+
+	// If the device cannot be reached, the Pipeline below will fail too.
+	n, err := c.tunerCount()
+	if err != nil {
+		h.TunersErr = err
+	}
+
+	names := []string{"/sys/model", "/sys/version"}
+	for i := 0; i < n; i++ {
+		name, err := TunerResource(i, "debug")
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	values, errs, err := c.pipelineQuery(names)
+	if err != nil {
+		return nil, err
+	}
+
+	h.Model, h.ModelErr = bytesStr(values[0]), errs[0]
+	h.FirmwareVersion, h.FirmwareVersionErr = bytesStr(values[1]), errs[1]
+
+	for i := 0; i < n; i++ {
+		th := TunerHealth{Index: i}
+
+		if err := errs[2+i]; err != nil {
+			th.Err = err
+		} else if debug, err := parseTunerDebug(values[2+i]); err != nil {
+			th.Err = err
+		} else {
+			th.Status = debug.Tuner
+		}
+
+		h.Tuners = append(h.Tuners, th)
+	}
+
+	return &h, nil
+}
+
+// FirmwareVersion returns the firmware version of an HDHomeRun device, such
+// as "20230713". See FirmwareAtLeast to compare firmware versions.
+func (c *Client) FirmwareVersion() (string, error) {
+	b, err := c.Query("/sys/version")
+	if err != nil {
+		return "", err
+	}
+
+	return bytesStr(b), nil
+}
+
+// FirmwareAtLeast reports whether the firmware version is the same as or
+// newer than the firmware version min.
+//
+// HDHomeRun firmware versions are usually date-based, such as "20230713",
+// with an optional pre-release suffix, such as "20230713beta1". Dotted
+// versions, such as "1.2.3", are also supported. A pre-release is older than
+// the release it precedes. If either version cannot be parsed,
+// FirmwareAtLeast returns false.
+func FirmwareAtLeast(version, min string) bool {
+	vn, vpre, ok := parseFirmwareVersion(version)
+	if !ok {
+		return false
+	}
+
+	mn, mpre, ok := parseFirmwareVersion(min)
+	if !ok {
+		return false
+	}
+
+	if c := compareInts(vn, mn); c != 0 {
+		return c > 0
+	}
+
+	switch {
+	case vpre == mpre:
+		return true
+	case vpre == "":
+		// A release is newer than any of its pre-releases.
+		return true
+	case mpre == "":
+		return false
+	}
+
+	// Compare pre-releases such as "beta2" and "beta10" by name, then by
+	// number.
+	vname, vnum := splitTrailingInt(vpre)
+	mname, mnum := splitTrailingInt(mpre)
+	if vname != mname {
+		return vname > mname
+	}
+
+	return vnum >= mnum
+}
+
+// parseFirmwareVersion parses a firmware version into its dotted numeric
+// components and any pre-release suffix.
+func parseFirmwareVersion(s string) ([]int, string, bool) {
+	s = strings.TrimSpace(s)
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+
+	if i == 0 {
+		return nil, "", false
+	}
+
+	ss := strings.Split(s[:i], ".")
+	nums := make([]int, 0, len(ss))
+	for _, v := range ss {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, "", false
+		}
+
+		nums = append(nums, n)
+	}
+
+	return nums, s[i:], true
+}
+
+// compareInts compares a and b element-wise, treating missing elements as
+// zero. It returns -1, 0, or 1 if a is less than, equal to, or greater than b.
+func compareInts(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// splitTrailingInt splits s into a prefix and the value of its trailing
+// decimal digits, if any.
+func splitTrailingInt(s string) (string, int) {
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+
+	n, _ := strconv.Atoi(s[i:])
+	return s[:i], n
+}
+
+// Features returns the features supported by an HDHomeRun device. Each key is
+// a feature category, such as "channelmap" or "modulation", and its values
+// are the supported options.
+//
+// Newer firmware reports features in a structured JSON form as its
+// "/sys/featuresV2" value, which is preferred when available. Otherwise, the
+// "/sys/features" value is used. The result is the same regardless of which
+// form the device reports.
+//
+// Features are fixed for a given device and firmware, so they are retrieved
+// once and cached for the lifetime of the Client. Each call returns a copy
+// which the caller may modify.
+func (c *Client) Features() (map[string][]string, error) {
+	c.fmu.Lock()
+	defer c.fmu.Unlock()
+
+	if c.features == nil {
+		features, err := c.queryFeatures()
+		if err != nil {
+			return nil, err
+		}
+
+		c.features = features
+	}
+
+	features := make(map[string][]string, len(c.features))
+	for k, vs := range c.features {
+		features[k] = append([]string(nil), vs...)
+	}
+
+	return features, nil
+}
+
+// queryFeatures retrieves the features supported by a device, preferring
+// the "/sys/featuresV2" form.
+func (c *Client) queryFeatures() (map[string][]string, error) {
+	b, err := c.Query("/sys/featuresV2")
+	switch {
+	case err == nil:
+		return parseFeaturesV2(b)
+	case !IsNotExist(err):
+		return nil, err
+	}
+
+	// Older firmware; fall back to the legacy form.
+	b, err = c.Query("/sys/features")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFeatures(bytesStr(b)), nil
+}
+
+// parseFeaturesV2 parses a "/sys/featuresV2" value, a JSON object such as
+// {"modulation": ["8vsb", "qam256", "qam64"]}, into a map of categories to
+// options.
+func parseFeaturesV2(b []byte) (map[string][]string, error) {
+	var features map[string][]string
+	if err := json.Unmarshal(bytes.TrimRight(b, "\x00"), &features); err != nil {
+		return nil, fmt.Errorf("malformed structured features: %v", err)
+	}
+
+	if features == nil {
+		// JSON null; report no features rather than an uncached result.
+		features = make(map[string][]string)
+	}
+
+	return features, nil
+}
+
+// parseFeatures parses the lines of a "/sys/features" value, such as
+// "modulation: 8vsb qam256 qam64", into a map of categories to options.
+func parseFeatures(s string) map[string][]string {
+	features := make(map[string][]string)
+	for _, line := range strings.Split(s, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			// Probably an empty line.
+			continue
+		}
+
+		features[strings.TrimSpace(kv[0])] = strings.Fields(kv[1])
+	}
+
+	return features
+}
+
+// ChannelMaps returns the channel maps supported by an HDHomeRun device, as
+// reported by the "channelmap" category of its Features.
+func (c *Client) ChannelMaps() ([]ChannelMap, error) {
+	features, err := c.Features()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseChannelMaps(features["channelmap"])
+}
+
+// parseChannelMaps parses each of the channel maps in ss.
+func parseChannelMaps(ss []string) ([]ChannelMap, error) {
+	maps := make([]ChannelMap, 0, len(ss))
+	for _, s := range ss {
+		m, err := ParseChannelMap(s)
+		if err != nil {
+			return nil, err
+		}
+
+		maps = append(maps, m)
+	}
+
+	return maps, nil
+}
+
+// ValidateSet checks whether value is valid for the get/set name, using the
+// device's Features, so that obviously invalid values can be rejected without
+// a wasted round trip to the device. Channel maps, input sources, and the
+// modulation of tuner channels are checked. If the constraints for name are
+// unknown, or the device does not report its features, ValidateSet returns
+// nil.
+func (c *Client) ValidateSet(name, value string) error {
+	var (
+		category string
+		option   = value
+	)
+
+	switch path.Base(name) {
+	case "channelmap":
+		category = "channelmap"
+	case "source":
+		category = "source"
+	case "channel":
+		if IsNone(value) {
+			return nil
+		}
+
+		ch, err := ParseChannel(value)
+		if err != nil {
+			return err
+		}
+
+		category = "modulation"
+		option = ch.Modulation
+	default:
+		return nil
+	}
+
+	features, err := c.Features()
+	if err != nil {
+		if IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	options, ok := features[category]
+	if !ok {
+		return nil
+	}
+
+	// Automatic modulation options are listed separately.
+	if category == "modulation" {
+		options = append(options[:len(options):len(options)], features["auto-modulation"]...)
+	}
+
+	if !hasString(options, option) {
+		return fmt.Errorf("invalid %s %q for %s: supported values are %s",
+			category, option, name, strings.Join(options, ", "))
+	}
+
+	return nil
+}
+
+// Source returns the input source currently selected by an HDHomeRun device
+// with multiple inputs, such as "antenna" or "cable", as reported by its
+// "/sys/source" value.
+//
+// Devices with a single input do not report a source. IsNotExist can be used
+// to check for this error.
+func (c *Client) Source() (string, error) {
+	b, err := c.Query("/sys/source")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(bytesStr(b)), nil
+}
+
+// SetSource selects the input source of an HDHomeRun device with multiple
+// inputs, such as switching between "antenna" and "cable". source is checked
+// against the "source" category of the device's Features using ValidateSet
+// before it is sent to the device.
+func (c *Client) SetSource(source string) error {
+	const name = "/sys/source"
+	if err := c.ValidateSet(name, source); err != nil {
+		return err
+	}
+
+	_, err := c.Set(name, source)
+	return err
+}
+
+// TunerCount returns the number of tuners available to an HDHomeRun device,
+// as reported in ASCII form by its "/tuner/count" value. Most devices also
+// report their tuner count during discovery; see DiscoveredDevice.TunerCount.
+func (c *Client) TunerCount() (int, error) {
+	b, err := c.Query("/tuner/count")
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(bytesStr(b)))
+}
+
+// Uptime returns the time elapsed since an HDHomeRun device last booted, as
+// reported in seconds by its "/sys/uptime" value.
+//
+// Older firmware does not report uptime. IsNotExist can be used to check for
+// this error.
+func (c *Client) Uptime() (time.Duration, error) {
+	b, err := c.Query("/sys/uptime")
+	if err != nil {
+		return 0, err
+	}
+
+	return parseUptime(bytesStr(b))
+}
+
+// parseUptime parses a "/sys/uptime" value, such as "86400", into a
+// time.Duration.
+func parseUptime(s string) (time.Duration, error) {
+	secs, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid uptime %q: %v", s, err)
+	}
+
+	return time.Duration(secs) * time.Second, nil
+}
+
+// BootStatus returns the boot status reported by an HDHomeRun device's
+// "/sys/boot" value. Automation can combine BootStatus with Restart and
+// WaitForOnline to determine when a restarted device has finished booting.
+//
+// Older firmware does not report a boot status. IsNotExist can be used to
+// check for this error.
+func (c *Client) BootStatus() (string, error) {
+	b, err := c.Query("/sys/boot")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(bytesStr(b)), nil
+}
+
+// Restart restarts an HDHomeRun device. The device may close the connection
+// before replying as it restarts, so a closed connection is not treated as
+// an error.
+//
+// Once Restart returns, the Client's connection is no longer usable and should
+// be closed. WaitForOnline can be used to wait for the device to come back
+// online after it restarts.
+func (c *Client) Restart() error {
+	_, err := c.Set("/sys/restart", "self")
+	if err != nil && !isConnClosed(err) {
+		return err
+	}
+
+	return nil
+}
+
 // Tuner accesses methods of an HDHomeRun tuner with the specified index.
 func (c *Client) Tuner(n int) *Tuner {
 	return &Tuner{
@@ -180,6 +1301,53 @@ func (c *Client) Tuner(n int) *Tuner {
 	}
 }
 
+// Tuners returns a Tuner for each tuner available to an HDHomeRun device.
+//
+// The number of tuners is determined using TunerCount, or by probing each
+// tuner in turn on firmware which does not report a count. The number of
+// tuners is fixed for a given device, so it is determined once and cached
+// for the lifetime of the Client.
+func (c *Client) Tuners() ([]*Tuner, error) {
+	n, err := c.tunerCount()
+	if err != nil {
+		return nil, err
+	}
+
+	tuners := make([]*Tuner, 0, n)
+	for i := 0; i < n; i++ {
+		tuners = append(tuners, c.Tuner(i))
+	}
+
+	return tuners, nil
+}
+
+// tunerCount returns the cached number of tuners available to a device,
+// determining it first if necessary.
+func (c *Client) tunerCount() (int, error) {
+	c.fmu.Lock()
+	defer c.fmu.Unlock()
+
+	if c.ntunersOK {
+		return c.ntuners, nil
+	}
+
+	n, err := c.TunerCount()
+	if IsNotExist(err) {
+		// Older firmware; count the tuners which exist instead.
+		n = 0
+		err = c.ForEachTuner(func(_ *Tuner) error {
+			n++
+			return nil
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	c.ntuners, c.ntunersOK = n, true
+	return n, nil
+}
+
 // ForEachTuner invokes the input function for each tuner available to an
 // HDHomeRun device.  Iteration stops when no more tuners are available.
 func (c *Client) ForEachTuner(fn func(t *Tuner) error) error {
@@ -204,7 +1372,8 @@ func (c *Client) ForEachTuner(fn func(t *Tuner) error) error {
 
 const (
 	// Possible error messages returned by an HDHomeRun device.
-	unknownGetSet = "unknown getset variable"
+	unknownGetSet  = "unknown getset variable"
+	resourceLocked = "resource locked"
 
 	// errorPrefix is the prefix added and removed when converting an Error
 	// to and from its string form.
@@ -223,7 +1392,36 @@ func IsNotExist(err error) bool {
 		return false
 	}
 
-	return herr.Message == unknownGetSet
+	return herr.Kind() == ErrorKindNotExist
+}
+
+// An ErrorKind classifies an Error returned by an HDHomeRun device.
+type ErrorKind int
+
+// Possible ErrorKind values.
+const (
+	// ErrorKindUnknown indicates an error message which is not recognized.
+	ErrorKindUnknown ErrorKind = iota
+
+	// ErrorKindNotExist indicates that a key does not exist.
+	ErrorKindNotExist
+
+	// ErrorKindLocked indicates that a resource is locked by another client.
+	ErrorKindLocked
+)
+
+// String returns the string representation of an ErrorKind.
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindUnknown:
+		return "unknown"
+	case ErrorKindNotExist:
+		return "not exist"
+	case ErrorKindLocked:
+		return "locked"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(k))
+	}
 }
 
 var _ error = &Error{}
@@ -231,11 +1429,34 @@ var _ error = &Error{}
 // An Error is an error message returned by an HDHomeRun device.
 type Error struct {
 	Message string
+
+	// Others holds any additional errors reported in the same reply as this
+	// Error, in the order they appeared. The Kind of an Error is determined
+	// only by its own Message.
+	Others []*Error
+}
+
+// Kind classifies the Error using its message.
+func (err *Error) Kind() ErrorKind {
+	switch {
+	case err.Message == unknownGetSet:
+		return ErrorKindNotExist
+	case strings.HasPrefix(err.Message, resourceLocked):
+		// The locking client's address follows the message.
+		return ErrorKindLocked
+	default:
+		return ErrorKindUnknown
+	}
 }
 
 // Error implements error.
 func (err *Error) Error() string {
-	return errorPrefix + err.Message
+	s := fmt.Sprintf("%s%s (%s)", errorPrefix, err.Message, err.Kind())
+	for _, o := range err.Others {
+		s += "; " + o.Error()
+	}
+
+	return s
 }
 
 // newError creates an Error from an error message.
@@ -247,6 +1468,33 @@ func newError(b []byte) *Error {
 	}
 }
 
+// isConnClosed determines if err indicates that the remote end of a connection
+// was closed.
+func isConnClosed(err error) bool {
+	if err == io.EOF {
+		return true
+	}
+
+	nerr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+
+	serr, ok := nerr.Err.(*os.SyscallError)
+	if !ok {
+		return false
+	}
+
+	return serr.Err == syscall.ECONNRESET || serr.Err == syscall.EPIPE
+}
+
+// IsNone reports whether value is the "none" sentinel which HDHomeRun devices
+// report for unset values, such as the channel, target, and lock key of an
+// idle tuner.
+func IsNone(value string) bool {
+	return strings.TrimSpace(value) == "none"
+}
+
 // bytesStr returns a string containing the contents of b, with any null
 // terminator suffix removed.
 func bytesStr(b []byte) string {
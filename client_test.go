@@ -1,10 +1,13 @@
 package hdhomerun
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -68,28 +71,1392 @@ func TestClientQuery(t *testing.T) {
 	}
 }
 
+func TestClientSet(t *testing.T) {
+	const (
+		name  = "/test"
+		value = "test"
+	)
+
+	var (
+		nameb  = strBytes(name)
+		valueb = strBytes(value)
+	)
+
+	// Expect a get/set request packet with both name and value.
+	getSet := &Packet{
+		Type: libhdhomerun.TypeGetsetReq,
+		Tags: []Tag{
+			{
+				Type: libhdhomerun.TagGetsetName,
+				Data: nameb,
+			},
+			{
+				Type: libhdhomerun.TagGetsetValue,
+				Data: valueb,
+			},
+		},
+	}
+
+	reply := &Packet{
+		Type: libhdhomerun.TypeGetsetRpy,
+		Tags: getSet.Tags,
+	}
+
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		if diff := cmp.Diff(getSet, req); diff != "" {
+			return nil, fmt.Errorf("unexpected set request (-want +got):\n%s", diff)
+		}
+
+		return reply, nil
+	})
+	defer done()
+
+	got, err := c.Set(name, value)
+	if err != nil {
+		t.Fatalf("failed to set: %v", err)
+	}
+
+	if diff := cmp.Diff(valueb, got); diff != "" {
+		t.Fatalf("unexpected set reply value (-want +got):\n%s", diff)
+	}
+}
+
+func TestSplitSetRequests(t *testing.T) {
+	const name = "/test"
+
+	tests := []struct {
+		name       string
+		value      string
+		maxPayload int
+		n          int
+		segment    int
+	}{
+		{
+			name:       "too small",
+			value:      "foo",
+			maxPayload: 11,
+		},
+		{
+			name:       "empty",
+			maxPayload: 64,
+			n:          1,
+		},
+		{
+			name:       "one byte segments",
+			value:      "foo",
+			maxPayload: 12,
+			n:          3,
+		},
+		{
+			name:       "exact fit",
+			value:      "foo",
+			maxPayload: 14,
+			n:          1,
+		},
+		{
+			// Name tag of 8 bytes and a value tag of 1+2+128 bytes.
+			name:       "large tag exact fit",
+			value:      strings.Repeat("a", 200),
+			maxPayload: 139,
+			n:          2,
+			segment:    127,
+		},
+		{
+			// A 127 byte segment would need a two byte length, so
+			// the largest segment that fits uses a one byte length.
+			name:       "large tag boundary",
+			value:      strings.Repeat("a", 200),
+			maxPayload: 138,
+			n:          2,
+			segment:    126,
+		},
+		{
+			name:       "small tags",
+			value:      strings.Repeat("a", 1000),
+			maxPayload: 128,
+			n:          9,
+		},
+		{
+			name:       "large tags",
+			value:      strings.Repeat("a", 4000),
+			maxPayload: libhdhomerun.MaxPayloadSize,
+			n:          3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqs := SplitSetRequests(name, tt.value, tt.maxPayload)
+			if diff := cmp.Diff(tt.n, len(reqs)); diff != "" {
+				t.Fatalf("unexpected number of requests (-want +got):\n%s", diff)
+			}
+
+			var value string
+			for i, req := range reqs {
+				pb, err := req.MarshalBinary()
+				if err != nil {
+					t.Fatalf("failed to marshal request: %v", err)
+				}
+
+				// Exclude the header and checksum from the payload.
+				if l := len(pb) - 8; l > tt.maxPayload {
+					t.Fatalf("request payload of %d bytes exceeds maximum of %d", l, tt.maxPayload)
+				}
+
+				for _, tag := range req.Tags {
+					switch tag.Type {
+					case libhdhomerun.TagGetsetName:
+						if diff := cmp.Diff(name, bytesStr(tag.Data)); diff != "" {
+							t.Fatalf("unexpected name (-want +got):\n%s", diff)
+						}
+					case libhdhomerun.TagGetsetValue:
+						s := bytesStr(tag.Data)
+						if i == 0 && tt.segment != 0 {
+							if diff := cmp.Diff(tt.segment, len(s)); diff != "" {
+								t.Fatalf("unexpected segment size (-want +got):\n%s", diff)
+							}
+						}
+
+						value += s
+					}
+				}
+			}
+
+			if diff := cmp.Diff(tt.value, value); diff != "" && tt.n > 0 {
+				t.Fatalf("unexpected reassembled value (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientSetLarge(t *testing.T) {
+	const name = "/test"
+	value := strings.Repeat("abcd", 1000)
+
+	var got string
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		for _, tag := range req.Tags {
+			if tag.Type == libhdhomerun.TagGetsetValue {
+				got += bytesStr(tag.Data)
+			}
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: req.Tags,
+		}, nil
+	})
+
+	if err := c.SetLarge(name, value); err != nil {
+		t.Fatalf("failed to set large value: %v", err)
+	}
+
+	// Wait for the device to finish handling requests.
+	done()
+
+	if diff := cmp.Diff(value, got); diff != "" {
+		t.Fatalf("unexpected value received by device (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientSetLargeLockKey(t *testing.T) {
+	const name = "/tuner0/test"
+	value := strings.Repeat("abcd", 1000)
+
+	var (
+		got   string
+		sizes []int
+	)
+
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		b, err := req.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, len(b))
+
+		for _, tag := range req.Tags {
+			if tag.Type == libhdhomerun.TagGetsetValue {
+				got += bytesStr(tag.Data)
+			}
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: req.Tags,
+		}, nil
+	})
+
+	c.SetLockKey(0xdeadbeef)
+
+	if err := c.SetLarge(name, value); err != nil {
+		t.Fatalf("failed to set large value: %v", err)
+	}
+
+	// Wait for the device to finish handling requests.
+	done()
+
+	if diff := cmp.Diff(value, got); diff != "" {
+		t.Fatalf("unexpected value received by device (-want +got):\n%s", diff)
+	}
+
+	for i, s := range sizes {
+		if s > libhdhomerun.MaxPacketSize {
+			t.Fatalf("request %d of %d bytes exceeds maximum of %d",
+				i, s, libhdhomerun.MaxPacketSize)
+		}
+	}
+}
+
+func TestClientUnexpectedReplyType(t *testing.T) {
+	// The first three requests receive a discover reply, which has no place
+	// on the control connection. Requests are handled one at a time by the
+	// device's goroutine.
+	var n int
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		n++
+		if n <= 3 {
+			return &Packet{
+				Type: libhdhomerun.TypeDiscoverRpy,
+				Tags: req.Tags,
+			}, nil
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				req.Tags[0],
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("hdhomerun5_atsc"),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	if _, err := c.Query("/sys/model"); err != errUnexpectedReplyType {
+		t.Fatalf("expected unexpected reply type error from Query, but got: %v", err)
+	}
+
+	req := newGetSetRequest("/sys/model", nil)
+	if _, err := c.Pipeline([]*Packet{req, req}); err != errUnexpectedReplyType {
+		t.Fatalf("expected unexpected reply type error from Pipeline, but got: %v", err)
+	}
+
+	// Every pipelined reply was consumed, so the next request's reply is
+	// read in turn rather than a stale one.
+	if _, err := c.Query("/sys/model"); err != nil {
+		t.Fatalf("failed to query after unexpected replies: %v", err)
+	}
+}
+
 func TestClientQueryIsNotExist(t *testing.T) {
 	err := &Error{
 		Message: unknownGetSet,
 	}
 
-	reply := &Packet{
-		Type: libhdhomerun.TypeGetsetRpy,
-		Tags: []Tag{
-			{
-				Type: libhdhomerun.TagErrorMessage,
-				Data: strBytes(err.Error()),
-			},
-		},
+	reply := &Packet{
+		Type: libhdhomerun.TypeGetsetRpy,
+		Tags: []Tag{
+			{
+				Type: libhdhomerun.TagErrorMessage,
+				Data: strBytes(errorPrefix + err.Message),
+			},
+		},
+	}
+
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		return reply, nil
+	})
+	defer done()
+
+	if _, err := c.Query("/notexist"); !IsNotExist(err) {
+		t.Fatalf("failed to query: %v", err)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		message string
+		kind    ErrorKind
+		s       string
+	}{
+		{
+			message: "something went wrong",
+			kind:    ErrorKindUnknown,
+			s:       "ERROR: something went wrong (unknown)",
+		},
+		{
+			message: unknownGetSet,
+			kind:    ErrorKindNotExist,
+			s:       "ERROR: unknown getset variable (not exist)",
+		},
+		{
+			message: "resource locked by 192.168.1.10",
+			kind:    ErrorKindLocked,
+			s:       "ERROR: resource locked by 192.168.1.10 (locked)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind.String(), func(t *testing.T) {
+			err := newError(strBytes(errorPrefix + tt.message))
+
+			if diff := cmp.Diff(tt.kind, err.Kind()); diff != "" {
+				t.Fatalf("unexpected error kind (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.s, err.Error()); diff != "" {
+				t.Fatalf("unexpected error string (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if diff := cmp.Diff("unknown(10)", ErrorKind(10).String()); diff != "" {
+		t.Fatalf("unexpected invalid error kind string (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientFirmwareVersion(t *testing.T) {
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/sys/version"),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("20230713"),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	version, err := c.FirmwareVersion()
+	if err != nil {
+		t.Fatalf("failed to get firmware version: %v", err)
+	}
+
+	if diff := cmp.Diff("20230713", version); diff != "" {
+		t.Fatalf("unexpected firmware version (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientGetGlob(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		errStr string
+		values map[string]string
+		ok     bool
+	}{
+		{
+			name:  "OK",
+			value: "/tuner0/channel=auto:8\n/tuner0/lockkey=none\n/tuner0/target=udp://192.168.1.2:5000\n",
+			values: map[string]string{
+				"/tuner0/channel": "auto:8",
+				"/tuner0/lockkey": "none",
+				"/tuner0/target":  "udp://192.168.1.2:5000",
+			},
+			ok: true,
+		},
+		{
+			name:   "no matches",
+			values: map[string]string{},
+			ok:     true,
+		},
+		{
+			name:  "malformed",
+			value: "/tuner0/channel auto:8\n",
+		},
+		{
+			name:   "not supported",
+			errStr: errorPrefix + unknownGetSet,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				tag := Tag{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes(tt.value),
+				}
+				if tt.errStr != "" {
+					tag = Tag{
+						Type: libhdhomerun.TagErrorMessage,
+						Data: strBytes(tt.errStr),
+					}
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{req.Tags[0], tag},
+				}, nil
+			})
+			defer done()
+
+			values, err := c.GetGlob("/tuner0/*")
+			if tt.errStr != "" && !IsNotExist(err) {
+				t.Fatalf("expected not exist error, but got: %v", err)
+			}
+
+			if err != nil && tt.ok {
+				t.Fatalf("failed to query values: %v", err)
+			}
+			if err == nil && !tt.ok {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.values, values); diff != "" {
+				t.Fatalf("unexpected values (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientKeepalive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const want = 3
+
+	var n int
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		if diff := diffPackets(NewKeepalive(), req); diff != "" {
+			panicf("unexpected keepalive request (-want +got):\n%s", diff)
+		}
+
+		// The request counter is only accessed by the device's goroutine.
+		n++
+		if n == want {
+			cancel()
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				req.Tags[0],
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("hdhomerun5_atsc"),
+				},
+			},
+		}, nil
+	})
+
+	if err := c.Keepalive(ctx, time.Millisecond); err != context.Canceled {
+		t.Fatalf("expected context canceled error, but got: %v", err)
+	}
+
+	// Ensure the device has finished handling requests before checking n.
+	done()
+
+	if n < want {
+		t.Fatalf("expected at least %d keepalive requests, but got %d", want, n)
+	}
+}
+
+func TestClientKeepaliveError(t *testing.T) {
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				req.Tags[0],
+				{
+					Type: libhdhomerun.TagErrorMessage,
+					Data: strBytes(errorPrefix + "internal error"),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	if err := c.Keepalive(context.Background(), time.Millisecond); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestClientBootStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		errStr string
+		status string
+		ok     bool
+	}{
+		{
+			name:   "OK",
+			value:  "complete",
+			status: "complete",
+			ok:     true,
+		},
+		{
+			name:   "whitespace",
+			value:  "complete\n",
+			status: "complete",
+			ok:     true,
+		},
+		{
+			name:   "not supported",
+			errStr: unknownGetSet,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				tag := Tag{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes(tt.value),
+				}
+				if tt.errStr != "" {
+					tag = Tag{
+						Type: libhdhomerun.TagErrorMessage,
+						Data: strBytes(tt.errStr),
+					}
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes("/sys/boot"),
+						},
+						tag,
+					},
+				}, nil
+			})
+			defer done()
+
+			status, err := c.BootStatus()
+			if tt.errStr != "" && !IsNotExist(err) {
+				t.Fatalf("expected not exist error, but got: %v", err)
+			}
+
+			if err != nil && tt.ok {
+				t.Fatalf("failed to get boot status: %v", err)
+			}
+			if err == nil && !tt.ok {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.status, status); diff != "" {
+				t.Fatalf("unexpected boot status (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientUptime(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		errStr string
+		uptime time.Duration
+		ok     bool
+	}{
+		{
+			name:   "OK",
+			value:  "93784",
+			uptime: 26*time.Hour + 3*time.Minute + 4*time.Second,
+			ok:     true,
+		},
+		{
+			name:   "whitespace",
+			value:  " 60\n",
+			uptime: time.Minute,
+			ok:     true,
+		},
+		{
+			name:  "negative",
+			value: "-1",
+		},
+		{
+			name:  "garbage",
+			value: "1d 02:03:04",
+		},
+		{
+			name:   "not supported",
+			errStr: unknownGetSet,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				tag := Tag{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes(tt.value),
+				}
+				if tt.errStr != "" {
+					tag = Tag{
+						Type: libhdhomerun.TagErrorMessage,
+						Data: strBytes(tt.errStr),
+					}
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes("/sys/uptime"),
+						},
+						tag,
+					},
+				}, nil
+			})
+			defer done()
+
+			uptime, err := c.Uptime()
+			if tt.errStr != "" && !IsNotExist(err) {
+				t.Fatalf("expected not exist error, but got: %v", err)
+			}
+
+			if err != nil && tt.ok {
+				t.Fatalf("failed to get uptime: %v", err)
+			}
+			if err == nil && !tt.ok {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.uptime, uptime); diff != "" {
+				t.Fatalf("unexpected uptime (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientSystemInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		errs   map[string]string
+		info   *SystemInfo
+		ok     bool
+	}{
+		{
+			name: "all",
+			values: map[string]string{
+				"/sys/model":     "hdhomerun5_atsc",
+				"/sys/hwmodel":   "HDHR5-4US",
+				"/sys/version":   "20230713",
+				"/sys/copyright": "Copyright © 2005-2023 Silicondust USA Inc.",
+			},
+			info: &SystemInfo{
+				Model:           "hdhomerun5_atsc",
+				HardwareModel:   "HDHR5-4US",
+				FirmwareVersion: "20230713",
+				Copyright:       "Copyright © 2005-2023 Silicondust USA Inc.",
+			},
+			ok: true,
+		},
+		{
+			name: "old firmware",
+			values: map[string]string{
+				"/sys/model":   "hdhomerun3_atsc",
+				"/sys/version": "20150826",
+			},
+			errs: map[string]string{
+				"/sys/hwmodel":   unknownGetSet,
+				"/sys/copyright": unknownGetSet,
+			},
+			info: &SystemInfo{
+				Model:           "hdhomerun3_atsc",
+				FirmwareVersion: "20150826",
+			},
+			ok: true,
+		},
+		{
+			name: "error",
+			values: map[string]string{
+				"/sys/model":     "hdhomerun5_atsc",
+				"/sys/hwmodel":   "HDHR5-4US",
+				"/sys/copyright": "Copyright © 2005-2023 Silicondust USA Inc.",
+			},
+			errs: map[string]string{
+				"/sys/version": "internal error",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				name := bytesStr(req.Tags[0].Data)
+
+				if msg, ok := tt.errs[name]; ok {
+					return &Packet{
+						Type: libhdhomerun.TypeGetsetRpy,
+						Tags: []Tag{
+							req.Tags[0],
+							{
+								Type: libhdhomerun.TagErrorMessage,
+								Data: strBytes(errorPrefix + msg),
+							},
+						},
+					}, nil
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						req.Tags[0],
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.values[name]),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			info, err := c.SystemInfo()
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error during query: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.info, info); diff != "" {
+				t.Fatalf("unexpected system info (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientHealth(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    map[string]string
+		errs      map[string]string
+		h         *DeviceHealth
+		tunersErr bool
+	}{
+		{
+			name: "multi-tuner",
+			values: map[string]string{
+				"/sys/model":    "hdhomerun5_atsc",
+				"/tuner/count":  "3",
+				"/tuner0/debug": "tun: ch=8vsb:593000000 lock=8vsb ss=83 snq=90 seq=100 dbg=-441/9730",
+				"/tuner1/debug": "tun: ch=none lock=none ss=0 snq=0 seq=0 dbg=-",
+			},
+			errs: map[string]string{
+				"/sys/version":  unknownGetSet,
+				"/tuner2/debug": "internal error",
+			},
+			h: &DeviceHealth{
+				Model:              "hdhomerun5_atsc",
+				FirmwareVersionErr: &Error{Message: unknownGetSet},
+				Tuners: []TunerHealth{
+					{
+						Index: 0,
+						Status: &TunerStatus{
+							Channel: "8vsb:593000000",
+							ChannelInfo: Channel{
+								Modulation:  "8vsb",
+								FrequencyHz: 593000000,
+							},
+							Lock:                 "8vsb",
+							SignalStrength:       83,
+							SignalToNoiseQuality: 90,
+							SymbolErrorQuality:   100,
+							Debug:                "-441/9730",
+						},
+					},
+					{
+						Index:  1,
+						Status: &TunerStatus{Debug: "-"},
+					},
+					{
+						Index: 2,
+						Err:   &Error{Message: "internal error"},
+					},
+				},
+			},
+		},
+		{
+			name: "bad tuner count",
+			values: map[string]string{
+				"/sys/model":   "hdhomerun5_atsc",
+				"/sys/version": "20230713",
+				"/tuner/count": "foo",
+			},
+			h: &DeviceHealth{
+				Model:           "hdhomerun5_atsc",
+				FirmwareVersion: "20230713",
+			},
+			tunersErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				name := bytesStr(req.Tags[0].Data)
+
+				if msg, ok := tt.errs[name]; ok {
+					return &Packet{
+						Type: libhdhomerun.TypeGetsetRpy,
+						Tags: []Tag{
+							req.Tags[0],
+							{
+								Type: libhdhomerun.TagErrorMessage,
+								Data: strBytes(errorPrefix + msg),
+							},
+						},
+					}, nil
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						req.Tags[0],
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.values[name]),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			h, err := c.Health()
+			if err != nil {
+				t.Fatalf("failed to retrieve health: %v", err)
+			}
+
+			if tt.tunersErr && h.TunersErr == nil {
+				t.Fatal("expected a tuners error, but none occurred")
+			}
+			if !tt.tunersErr && h.TunersErr != nil {
+				t.Fatalf("unexpected tuners error: %v", h.TunersErr)
+			}
+			h.TunersErr = nil
+
+			if diff := cmp.Diff(tt.h, h); diff != "" {
+				t.Fatalf("unexpected device health (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientNetworkConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		errs   map[string]string
+		cfg    *NetworkConfig
+		ok     bool
+	}{
+		{
+			name: "all",
+			values: map[string]string{
+				"/sys/ip_addr":     "192.168.1.100",
+				"/sys/subnet_mask": "255.255.255.0",
+				"/sys/gateway":     "192.168.1.1",
+				"/sys/dns":         "192.168.1.1 8.8.8.8",
+			},
+			cfg: &NetworkConfig{
+				IP:      net.ParseIP("192.168.1.100"),
+				Netmask: net.CIDRMask(24, 32),
+				Gateway: net.ParseIP("192.168.1.1"),
+				DNS: []net.IP{
+					net.ParseIP("192.168.1.1"),
+					net.ParseIP("8.8.8.8"),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "absent",
+			values: map[string]string{
+				"/sys/ip_addr":     "169.254.12.34",
+				"/sys/subnet_mask": "255.255.0.0",
+			},
+			errs: map[string]string{
+				"/sys/gateway": unknownGetSet,
+				"/sys/dns":     unknownGetSet,
+			},
+			cfg: &NetworkConfig{
+				IP:      net.ParseIP("169.254.12.34"),
+				Netmask: net.CIDRMask(16, 32),
+			},
+			ok: true,
+		},
+		{
+			name: "bad IP",
+			values: map[string]string{
+				"/sys/ip_addr": "192.168.1",
+			},
+		},
+		{
+			name: "bad DNS",
+			values: map[string]string{
+				"/sys/dns": "192.168.1.1,8.8.8.8",
+			},
+		},
+		{
+			name: "error",
+			errs: map[string]string{
+				"/sys/subnet_mask": "internal error",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				name := bytesStr(req.Tags[0].Data)
+
+				if msg, ok := tt.errs[name]; ok {
+					return &Packet{
+						Type: libhdhomerun.TypeGetsetRpy,
+						Tags: []Tag{
+							req.Tags[0],
+							{
+								Type: libhdhomerun.TagErrorMessage,
+								Data: strBytes(errorPrefix + msg),
+							},
+						},
+					}, nil
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						req.Tags[0],
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.values[name]),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			cfg, err := c.NetworkConfig()
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error during query: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.cfg, cfg); diff != "" {
+				t.Fatalf("unexpected network config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientValidateSet(t *testing.T) {
+	const features = `channelmap: us-bcast us-cable us-hrc us-irc
+modulation: 8vsb qam256 qam64
+auto-modulation: auto auto6t auto6c qam
+`
+
+	var queries int
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		queries++
+
+		// This firmware predates the structured features.
+		if bytesStr(req.Tags[0].Data) == "/sys/featuresV2" {
+			return &Packet{
+				Type: libhdhomerun.TypeGetsetRpy,
+				Tags: []Tag{
+					req.Tags[0],
+					{
+						Type: libhdhomerun.TagErrorMessage,
+						Data: strBytes(errorPrefix + unknownGetSet),
+					},
+				},
+			}, nil
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				req.Tags[0],
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes(features),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	tests := []struct {
+		name, value string
+		ok          bool
+	}{
+		{name: "/tuner0/channelmap", value: "us-cable", ok: true},
+		{name: "/tuner0/channelmap", value: "us-cabel"},
+		{name: "/tuner0/channel", value: "none", ok: true},
+		{name: "/tuner0/channel", value: "8vsb:509000000", ok: true},
+		{name: "/tuner0/channel", value: "auto6t:509000000", ok: true},
+		{name: "/tuner0/channel", value: "dvbt:509000000"},
+		{name: "/tuner0/channel", value: "8vsb"},
+		{name: "/tuner0/target", value: "udp://192.168.1.2:5000", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			err := c.ValidateSet(tt.name, tt.value)
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+
+	// Features are only queried once, in each form.
+	if diff := cmp.Diff(2, queries); diff != "" {
+		t.Fatalf("unexpected number of feature queries (-want +got):\n%s", diff)
+	}
+
+	want := map[string][]string{
+		"channelmap":      {"us-bcast", "us-cable", "us-hrc", "us-irc"},
+		"modulation":      {"8vsb", "qam256", "qam64"},
+		"auto-modulation": {"auto", "auto6t", "auto6c", "qam"},
+	}
+
+	got, err := c.Features()
+	if err != nil {
+		t.Fatalf("failed to get features: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected features (-want +got):\n%s", diff)
+	}
+
+	// Modifying the returned features must not affect the cache.
+	got["modulation"][0] = "bogus"
+	delete(got, "channelmap")
+
+	again, err := c.Features()
+	if err != nil {
+		t.Fatalf("failed to get features: %v", err)
+	}
+
+	if diff := cmp.Diff(want, again); diff != "" {
+		t.Fatalf("unexpected cached features (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientChannelMaps(t *testing.T) {
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		if bytesStr(req.Tags[0].Data) == "/sys/featuresV2" {
+			return &Packet{
+				Type: libhdhomerun.TypeGetsetRpy,
+				Tags: []Tag{
+					req.Tags[0],
+					{
+						Type: libhdhomerun.TagErrorMessage,
+						Data: strBytes(errorPrefix + unknownGetSet),
+					},
+				},
+			}, nil
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				req.Tags[0],
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("channelmap: eu-bcast eu-cable au-bcast\nmodulation: t8dvbt\n"),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	maps, err := c.ChannelMaps()
+	if err != nil {
+		t.Fatalf("failed to get channel maps: %v", err)
+	}
+
+	want := []ChannelMap{
+		{Country: "eu", Medium: "bcast"},
+		{Country: "eu", Medium: "cable"},
+		{Country: "au", Medium: "bcast"},
+	}
+
+	if diff := cmp.Diff(want, maps); diff != "" {
+		t.Fatalf("unexpected channel maps (-want +got):\n%s", diff)
+	}
+
+	// A well-formed channel map which the device does not support.
+	if err := c.ValidateSet("/tuner0/channelmap", "zz-satellite"); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestClientSetSource(t *testing.T) {
+	source := "antenna"
+
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		value := Tag{Type: libhdhomerun.TagGetsetValue}
+
+		switch bytesStr(req.Tags[0].Data) {
+		case "/sys/featuresV2":
+			value = Tag{
+				Type: libhdhomerun.TagErrorMessage,
+				Data: strBytes(errorPrefix + unknownGetSet),
+			}
+		case "/sys/features":
+			value.Data = strBytes("channelmap: us-bcast us-cable\nsource: antenna cable\n")
+		case "/sys/source":
+			if len(req.Tags) > 1 {
+				source = bytesStr(req.Tags[1].Data)
+			}
+
+			value.Data = strBytes(source)
+		default:
+			panicf("unexpected request: %v", req)
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{req.Tags[0], value},
+		}, nil
+	})
+	defer done()
+
+	// An unsupported source is rejected without a set request.
+	if err := c.SetSource("satellite"); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if err := c.SetSource("cable"); err != nil {
+		t.Fatalf("failed to set source: %v", err)
+	}
+
+	got, err := c.Source()
+	if err != nil {
+		t.Fatalf("failed to get source: %v", err)
+	}
+
+	if diff := cmp.Diff("cable", got); diff != "" {
+		t.Fatalf("unexpected source (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientFeatures(t *testing.T) {
+	want := map[string][]string{
+		"channelmap": {"us-bcast", "us-cable"},
+		"modulation": {"8vsb", "qam256", "qam64"},
+	}
+
+	tests := []struct {
+		name     string
+		values   map[string]string
+		features map[string][]string
+		ok       bool
+	}{
+		{
+			name: "legacy",
+			values: map[string]string{
+				"/sys/features": "channelmap: us-bcast us-cable\nmodulation: 8vsb qam256 qam64\n",
+			},
+			features: want,
+			ok:       true,
+		},
+		{
+			name: "structured",
+			values: map[string]string{
+				"/sys/featuresV2": `{"channelmap":["us-bcast","us-cable"],"modulation":["8vsb","qam256","qam64"]}`,
+				"/sys/features":   "channelmap: bogus\n",
+			},
+			features: want,
+			ok:       true,
+		},
+		{
+			name: "malformed structured",
+			values: map[string]string{
+				"/sys/featuresV2": `{"channelmap":"us-bcast"}`,
+				"/sys/features":   "channelmap: us-bcast us-cable\nmodulation: 8vsb qam256 qam64\n",
+			},
+		},
+		{
+			name: "none",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				value, ok := tt.values[bytesStr(req.Tags[0].Data)]
+				if !ok {
+					return &Packet{
+						Type: libhdhomerun.TypeGetsetRpy,
+						Tags: []Tag{
+							req.Tags[0],
+							{
+								Type: libhdhomerun.TagErrorMessage,
+								Data: strBytes(errorPrefix + unknownGetSet),
+							},
+						},
+					}, nil
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						req.Tags[0],
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(value),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			features, err := c.Features()
+			if tt.ok && err != nil {
+				t.Fatalf("failed to get features: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.features, features); diff != "" {
+				t.Fatalf("unexpected features (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientValidateSetNoFeatures(t *testing.T) {
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				req.Tags[0],
+				{
+					Type: libhdhomerun.TagErrorMessage,
+					Data: strBytes(errorPrefix + unknownGetSet),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	// Without features, any well-formed value is allowed.
+	if err := c.ValidateSet("/tuner0/channelmap", "us-cabel"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFirmwareAtLeast(t *testing.T) {
+	tests := []struct {
+		version, min string
+		ok           bool
+	}{
+		// Date-based versions.
+		{version: "20230713", min: "20230713", ok: true},
+		{version: "20230713", min: "20200907", ok: true},
+		{version: "20200907", min: "20230713"},
+		{version: "20230713", min: "20230713beta1", ok: true},
+		{version: "20230713beta1", min: "20230713"},
+		{version: "20230713beta2", min: "20230713beta1", ok: true},
+		{version: "20230713beta10", min: "20230713beta9", ok: true},
+		{version: "20230713beta1", min: "20230713beta2"},
+		{version: "20230713rc1", min: "20230713beta3", ok: true},
+		{version: "20230714beta1", min: "20230713", ok: true},
+
+		// Dotted versions.
+		{version: "1.2.3", min: "1.2.3", ok: true},
+		{version: "1.10", min: "1.9", ok: true},
+		{version: "1.2", min: "1.2.1"},
+		{version: "1.2.0", min: "1.2", ok: true},
+		{version: "2.0", min: "1.99.99", ok: true},
+
+		// Malformed versions.
+		{version: "", min: "20230713"},
+		{version: "20230713", min: ""},
+		{version: "beta1", min: "20230713"},
+		{version: "1..2", min: "1.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version+">="+tt.min, func(t *testing.T) {
+			if diff := cmp.Diff(tt.ok, FirmwareAtLeast(tt.version, tt.min)); diff != "" {
+				t.Fatalf("unexpected comparison result (-want +got):\n%s", diff)
+			}
+		})
 	}
+}
 
-	c, done := testClient(t, func(req *Packet) (*Packet, error) {
-		return reply, nil
-	})
-	defer done()
+func TestIsNone(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{
+			name:  "channel none",
+			value: "none",
+			ok:    true,
+		},
+		{
+			name:  "channel",
+			value: "auto:593000000",
+		},
+		{
+			name:  "target none",
+			value: "none\n",
+			ok:    true,
+		},
+		{
+			name:  "target",
+			value: "udp://192.168.1.10:5000",
+		},
+		{
+			name:  "lockkey none",
+			value: " none ",
+			ok:    true,
+		},
+		{
+			name:  "lockkey owner",
+			value: "192.168.1.10",
+		},
+		{
+			name: "empty",
+		},
+		{
+			name:  "case sensitive",
+			value: "None",
+		},
+	}
 
-	if _, err := c.Query("/notexist"); !IsNotExist(err) {
-		t.Fatalf("failed to query: %v", err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.ok, IsNone(tt.value)); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
 	}
 }
 
@@ -255,10 +1622,433 @@ func TestClientForEachTuner(t *testing.T) {
 	}
 }
 
+func TestClientTuners(t *testing.T) {
+	tests := []struct {
+		name    string
+		tuners  map[string]string
+		n       int
+		queries []string
+	}{
+		{
+			name:    "tuner count",
+			tuners:  map[string]string{"/tuner/count": "3"},
+			n:       3,
+			queries: []string{"/tuner/count"},
+		},
+		{
+			name: "old firmware",
+			tuners: map[string]string{
+				"/tuner0/debug": "tun: ch=none",
+				"/tuner1/debug": "tun: ch=none",
+			},
+			n: 2,
+			queries: []string{
+				"/tuner/count",
+				"/tuner0/debug",
+				"/tuner1/debug",
+				"/tuner2/debug",
+			},
+		},
+		{
+			name:    "no tuners",
+			tuners:  map[string]string{"/tuner/count": "0"},
+			queries: []string{"/tuner/count"},
+		},
+		{
+			name: "old firmware no tuners",
+			queries: []string{
+				"/tuner/count",
+				"/tuner0/debug",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []string
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				var name string
+				for _, tag := range req.Tags {
+					if tag.Type == libhdhomerun.TagGetsetName {
+						name = bytesStr(tag.Data)
+					}
+				}
+				queries = append(queries, name)
+
+				value, ok := tt.tuners[name]
+				if !ok {
+					return &Packet{
+						Type: libhdhomerun.TypeGetsetRpy,
+						Tags: []Tag{{
+							Type: libhdhomerun.TagErrorMessage,
+							Data: []byte(errorPrefix + unknownGetSet),
+						}},
+					}, nil
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes(name),
+						},
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(value),
+						},
+					},
+				}, nil
+			})
+
+			// The tuner count is cached after the first call.
+			for i := 0; i < 2; i++ {
+				tuners, err := c.Tuners()
+				if err != nil {
+					t.Fatalf("failed to get tuners: %v", err)
+				}
+
+				if diff := cmp.Diff(tt.n, len(tuners)); diff != "" {
+					t.Fatalf("unexpected number of tuners (-want +got):\n%s", diff)
+				}
+
+				for j, tuner := range tuners {
+					if diff := cmp.Diff(j, tuner.Index); diff != "" {
+						t.Fatalf("unexpected tuner index (-want +got):\n%s", diff)
+					}
+				}
+			}
+
+			done()
+
+			if diff := cmp.Diff(tt.queries, queries); diff != "" {
+				t.Fatalf("unexpected queries (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientRestart(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to start TCP listener: %v", err)
+	}
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		c, err := l.Accept()
+		if err != nil {
+			panicf("failed to accept: %v", err)
+		}
+
+		// Emulate a device which restarts immediately upon receiving the
+		// request, without sending a reply.
+		b := make([]byte, libhdhomerun.MaxPacketSize)
+		n, err := c.Read(b)
+		if err != nil {
+			panicf("failed to read request: %v", err)
+		}
+
+		var req Packet
+		if err := req.UnmarshalBinary(b[:n]); err != nil {
+			panicf("failed to unmarshal request: %v", err)
+		}
+
+		want := &Packet{
+			Type: libhdhomerun.TypeGetsetReq,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/sys/restart"),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("self"),
+				},
+			},
+		}
+
+		if diff := cmp.Diff(want, &req); diff != "" {
+			panicf("unexpected restart request (-want +got):\n%s", diff)
+		}
+
+		_ = c.Close()
+	}()
+
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial device: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Restart(); err != nil {
+		t.Fatalf("failed to restart: %v", err)
+	}
+
+	wg.Wait()
+}
+
+func TestClientPipeline(t *testing.T) {
+	c, done := testClient(t, echoQuery)
+	defer done()
+
+	reqs := testQueries(10)
+
+	reps, err := c.Pipeline(reqs)
+	if err != nil {
+		t.Fatalf("failed to pipeline requests: %v", err)
+	}
+
+	if diff := cmp.Diff(len(reqs), len(reps)); diff != "" {
+		t.Fatalf("unexpected number of replies (-want +got):\n%s", diff)
+	}
+
+	// Replies must be in the same order as requests.
+	for i := range reqs {
+		if diff := cmp.Diff(reqs[i].Tags[0], reps[i].Tags[0]); diff != "" {
+			t.Fatalf("unexpected reply %d name (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestClientPipelineReadError(t *testing.T) {
+	// The device stops replying partway through the pipeline, and only
+	// sends the remaining replies once the Client has given up on them.
+	var n int
+	release := make(chan struct{})
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		n++
+		if n == 2 {
+			<-release
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				req.Tags[0],
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes(strconv.Itoa(n)),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	c.SetTimeout(50 * time.Millisecond)
+
+	reqs := []*Packet{
+		newGetSetRequest("/sys/model", nil),
+		newGetSetRequest("/sys/model", nil),
+		newGetSetRequest("/sys/model", nil),
+	}
+
+	if _, err := c.Pipeline(reqs); err == nil {
+		t.Fatal("expected a pipeline error, but none occurred")
+	}
+
+	close(release)
+
+	// The stale replies to the pipeline must not be mistaken for replies
+	// to later requests.
+	if _, err := c.Query("/sys/model"); err != errClientBroken {
+		t.Fatalf("expected broken client error, but got: %v", err)
+	}
+	if _, err := c.Pipeline(reqs); err != errClientBroken {
+		t.Fatalf("expected broken client error, but got: %v", err)
+	}
+
+	// Drain the stale replies so the device finishes writing them before
+	// the connection is closed.
+	if err := c.c.SetDeadline(time.Time{}); err != nil {
+		t.Fatalf("failed to clear deadline: %v", err)
+	}
+
+	for i := 0; i < len(reqs)-1; i++ {
+		if _, err := c.r.ReadPacket(); err != nil {
+			t.Fatalf("failed to read stale reply: %v", err)
+		}
+	}
+}
+
+func BenchmarkClientPipeline(b *testing.B) {
+	const n = 16
+
+	c, done := testClient(b, echoQuery)
+	defer done()
+
+	reqs := testQueries(n)
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, req := range reqs {
+				if _, err := c.Execute(req); err != nil {
+					b.Fatalf("failed to execute: %v", err)
+				}
+			}
+		}
+	})
+
+	b.Run("pipeline", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := c.Pipeline(reqs); err != nil {
+				b.Fatalf("failed to pipeline: %v", err)
+			}
+		}
+	})
+}
+
+func TestClientOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []ClientOption
+		ok      bool
+	}{
+		{
+			name:    "bad read buffer",
+			options: []ClientOption{ClientReadBuffer(0)},
+		},
+		{
+			name:    "bad write buffer",
+			options: []ClientOption{ClientWriteBuffer(-1)},
+		},
+		{
+			name:    "bad dialer",
+			options: []ClientOption{ClientDialer(nil)},
+		},
+		{
+			name: "OK",
+			options: []ClientOption{
+				ClientReadBuffer(64 * 1024),
+				ClientWriteBuffer(64 * 1024),
+				ClientDialer(&net.Dialer{Timeout: time.Second}),
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				t.Fatalf("failed to start TCP listener: %v", err)
+			}
+			defer l.Close()
+
+			c, err := Dial(l.Addr().String(), tt.options...)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			_ = c.Close()
+		})
+	}
+}
+
+func TestClientDialer(t *testing.T) {
+	localAddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+	c, done := testClient(t, echoQuery, ClientDialer(&net.Dialer{LocalAddr: localAddr}))
+	defer done()
+
+	if _, err := c.Query("/test"); err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	got := c.c.LocalAddr().(*net.TCPAddr).IP
+	if diff := cmp.Diff(localAddr.IP.String(), got.String()); diff != "" {
+		t.Fatalf("unexpected local address (-want +got):\n%s", diff)
+	}
+}
+
+func BenchmarkClientReadBuffer(b *testing.B) {
+	// A value near the maximum packet size, such as a channel lineup.
+	value := strBytes(strings.Repeat("a", libhdhomerun.MaxPayloadSize-64))
+
+	for _, n := range []int{16, 512, defaultReadBuffer, 64 * 1024} {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			c, done := testClient(b, func(req *Packet) (*Packet, error) {
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						req.Tags[0],
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: value,
+						},
+					},
+				}, nil
+			}, ClientReadBuffer(n))
+			defer done()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Query("/test"); err != nil {
+					b.Fatalf("failed to query: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// testQueries creates n get/set requests with distinct names.
+func testQueries(n int) []*Packet {
+	reqs := make([]*Packet, 0, n)
+	for i := 0; i < n; i++ {
+		reqs = append(reqs, newGetSetRequest(fmt.Sprintf("/test%d", i), nil))
+	}
+
+	return reqs
+}
+
+// echoQuery is a handleFunc which replies to a get/set request with the
+// requested name, and a fixed value.
+func echoQuery(req *Packet) (*Packet, error) {
+	return &Packet{
+		Type: libhdhomerun.TypeGetsetRpy,
+		Tags: []Tag{
+			req.Tags[0],
+			{
+				Type: libhdhomerun.TagGetsetValue,
+				Data: strBytes("test"),
+			},
+		},
+	}, nil
+}
+
 // testClient creates a listener that emulates an HDHomeRun device, and
-// provides a Client which is configured to query it. Invoke the done closure
-// to clean up resources.
-func testClient(t *testing.T, handle handleFunc) (*Client, func()) {
+// provides a Client which is configured to query it using the input options.
+// Invoke the done closure to clean up resources.
+func testClient(t testing.TB, handle handleFunc, options ...ClientOption) (*Client, func()) {
+	addr, wait := testDevice(t, handle)
+
+	c, err := Dial(addr, options...)
+	if err != nil {
+		t.Fatalf("failed to dial device: %v", err)
+	}
+
+	return c, func() {
+		_ = c.Close()
+		wait()
+	}
+}
+
+// testDevice creates a listener that emulates an HDHomeRun device which
+// accepts a single connection, and returns its address. Invoke the done
+// closure to clean up resources once any connection to the device has been
+// closed.
+func testDevice(t testing.TB, handle handleFunc) (string, func()) {
 	l, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		t.Fatalf("failed to start TCP listener: %v", err)
@@ -274,14 +2064,19 @@ func testClient(t *testing.T, handle handleFunc) (*Client, func()) {
 		// prevent any additional connections.
 		c, err := l.Accept()
 		if err != nil {
+			if strings.Contains(err.Error(), "use of closed network connection") {
+				// No connection was made.
+				return
+			}
+
 			panicf("failed to accept: %v", err)
 		}
 		_ = l.Close()
 		defer c.Close()
 
-		b := make([]byte, libhdhomerun.MaxPacketSize)
+		r := NewReader(c)
 		for {
-			n, err := c.Read(b)
+			req, err := r.ReadPacket()
 			if err != nil {
 				if err == io.EOF {
 					return
@@ -290,12 +2085,7 @@ func testClient(t *testing.T, handle handleFunc) (*Client, func()) {
 				panicf("failed to read request: %v", err)
 			}
 
-			var req Packet
-			if err := req.UnmarshalBinary(b[:n]); err != nil {
-				panicf("failed to unmarshal request: %v", err)
-			}
-
-			res, err := handle(&req)
+			res, err := handle(req)
 			if err != nil {
 				panicf("error while handling request: %v", err)
 			}
@@ -311,14 +2101,8 @@ func testClient(t *testing.T, handle handleFunc) (*Client, func()) {
 		}
 	}()
 
-	c, err := Dial(l.Addr().String())
-	if err != nil {
-		t.Fatalf("failed to dial device: %v", err)
-	}
-
-	return c, func() {
+	return l.Addr().String(), func() {
 		_ = l.Close()
-		_ = c.Close()
 		wg.Wait()
 	}
 }
@@ -0,0 +1,87 @@
+package hdhomerun
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/joydip/hdhomerun/internal/libhdhomerun"
+)
+
+// cloudDiscoverURL is the URL of the HDHomeRun cloud discovery API. It is a
+// variable so it can be swapped out in tests.
+var cloudDiscoverURL = "https://api.hdhomerun.com/discover"
+
+// DiscoverCloud discovers HDHomeRun devices using the HDHomeRun cloud
+// discovery API, which reports the devices that have registered from the
+// same public IP address as the caller. If c is nil, http.DefaultClient is
+// used.
+//
+// Unlike a Discoverer, DiscoverCloud makes requests to a service on the
+// internet rather than the local network, so it must be used explicitly.
+// Devices found by DiscoverCloud include an AuthStr when the API reports
+// one, and a URL for the device's HTTP API.
+func DiscoverCloud(ctx context.Context, c *http.Client) ([]*DiscoveredDevice, error) {
+	var cds []cloudDevice
+	if err := getJSON(ctx, c, cloudDiscoverURL, &cds); err != nil {
+		return nil, err
+	}
+
+	devices := make([]*DiscoveredDevice, 0, len(cds))
+	for _, cd := range cds {
+		d, err := cd.device()
+		if err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, d)
+	}
+
+	return devices, nil
+}
+
+// A cloudDevice is a device reported by the HDHomeRun cloud discovery API.
+type cloudDevice struct {
+	DeviceID   string
+	StorageID  string
+	LocalIP    string
+	BaseURL    string
+	DeviceAuth string
+	TunerCount int
+}
+
+// device converts a cloudDevice into a DiscoveredDevice.
+func (cd cloudDevice) device() (*DiscoveredDevice, error) {
+	d := &DiscoveredDevice{
+		Tuners:  cd.TunerCount,
+		AuthStr: cd.DeviceAuth,
+	}
+
+	switch {
+	case cd.DeviceID != "":
+		d.ID = strings.ToLower(cd.DeviceID)
+		d.Type = DeviceTypeTuner
+	case cd.StorageID != "":
+		d.StorageID = cd.StorageID
+		d.Type = DeviceTypeStorage
+	}
+
+	if cd.LocalIP != "" {
+		d.Addr = net.JoinHostPort(cd.LocalIP, strconv.Itoa(libhdhomerun.ControlTcpPort))
+		d.Addrs = []string{d.Addr}
+	}
+
+	if cd.BaseURL != "" {
+		u, err := url.Parse(cd.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		d.URL = u
+	}
+
+	return d, nil
+}
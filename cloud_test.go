@@ -0,0 +1,72 @@
+package hdhomerun
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiscoverCloud(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[
+			{
+				"DeviceID": "1040A2B3",
+				"LocalIP": "192.168.1.100",
+				"BaseURL": "http://192.168.1.100:80",
+				"DiscoverURL": "http://192.168.1.100:80/discover.json",
+				"LineupURL": "http://192.168.1.100:80/lineup.json",
+				"DeviceAuth": "q3Uj5GiXxTqwgWlGrBqiPxEz",
+				"TunerCount": 2
+			},
+			{
+				"StorageID": "1234ABCD-0000-0000-0000-000000000000",
+				"LocalIP": "192.168.1.101",
+				"BaseURL": "http://192.168.1.101:80",
+				"StorageURL": "http://192.168.1.101:80/recorded_files.json"
+			}
+		]`))
+	}))
+	defer srv.Close()
+
+	u := cloudDiscoverURL
+	cloudDiscoverURL = srv.URL
+	defer func() { cloudDiscoverURL = u }()
+
+	devices, err := DiscoverCloud(context.Background(), srv.Client())
+	if err != nil {
+		t.Fatalf("failed to discover devices: %v", err)
+	}
+
+	want := []*DiscoveredDevice{
+		{
+			ID:    "1040a2b3",
+			Addr:  "192.168.1.100:65001",
+			Addrs: []string{"192.168.1.100:65001"},
+			Type:  DeviceTypeTuner,
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "192.168.1.100:80",
+			},
+			Tuners:  2,
+			AuthStr: "q3Uj5GiXxTqwgWlGrBqiPxEz",
+		},
+		{
+			StorageID: "1234ABCD-0000-0000-0000-000000000000",
+			Addr:      "192.168.1.101:65001",
+			Addrs:     []string{"192.168.1.101:65001"},
+			Type:      DeviceTypeStorage,
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "192.168.1.101:80",
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, devices); diff != "" {
+		t.Fatalf("unexpected devices (-want +got):\n%s", diff)
+	}
+}
@@ -47,6 +47,10 @@ func main() {
 		log.Fatal("no devices found")
 	}
 
+	// Only query each device once, even if it replied from more than
+	// one address.
+	devices = hdhomerun.MergeDevices(devices)
+
 	query := flag.Arg(0)
 	if query == "" {
 		query = "/sys/model"
@@ -9,7 +9,9 @@ import (
 	"io"
 	"net"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/joydip/hdhomerun/internal/libhdhomerun"
 )
@@ -61,14 +63,59 @@ func ParseDeviceID(id string) ([]byte, error) {
 	return idb, nil
 }
 
+// deviceIDLookup is used to compute the checksum of a device ID, as described
+// in libhdhomerun/hdhomerun_discover.c.
+var deviceIDLookup = [16]uint32{
+	0xa, 0x5, 0xf, 0x6, 0x7, 0xc, 0x1, 0xb,
+	0x9, 0x2, 0x8, 0xd, 0x4, 0x3, 0xe, 0x0,
+}
+
+// ValidDeviceID reports whether id is an eight character hexadecimal device
+// ID with a valid checksum. Every device ID printed on a physical HDHomeRun
+// device has a valid checksum, so ValidDeviceID can be used to catch typos in
+// device IDs entered by users.
+func ValidDeviceID(id string) bool {
+	idb, err := ParseDeviceID(id)
+	if err != nil {
+		return false
+	}
+
+	// Alternate nibbles, starting with the most significant, are mapped
+	// through the lookup table before being combined.
+	v := binary.BigEndian.Uint32(idb)
+	var sum uint32
+	for _, shift := range []uint{28, 20, 12, 4} {
+		sum ^= deviceIDLookup[(v>>shift)&0xf]
+		sum ^= (v >> (shift - 4)) & 0xf
+	}
+
+	return sum == 0
+}
+
 // A Discoverer can discover HDHomeRun devices on a network.
 type Discoverer struct {
 	deviceType    DeviceType
 	deviceID      []byte
+	minSize       int
+	minInterval   time.Duration
+	ifaceDelay    time.Duration
 	multicastAddr *net.UDPAddr
+	targets       []*net.UDPAddr
 	localAddr     *net.UDPAddr
 
-	c net.PacketConn
+	// send writes a discovery request to addr. It is replaced in tests.
+	send func(c *net.UDPConn, b []byte, addr *net.UDPAddr) error
+
+	c *net.UDPConn
+
+	// The discovery request, and the addresses which have yet to receive it
+	// when requests are spaced out by ifaceDelay.
+	req      []byte
+	deferred []*net.UDPAddr
+
+	// Devices which arrived in the same datagram as a previously returned
+	// device, and have yet to be returned by Discover.
+	pending []*DiscoveredDevice
 }
 
 // A DiscovererOption is an option which modifies the behavior of a Discoverer.
@@ -97,6 +144,107 @@ func DiscoverDeviceID(id string) DiscovererOption {
 	}
 }
 
+// DiscoverMinRequestSize requests that a Discoverer pad its discovery requests
+// to at least n bytes, using a padding tag which devices ignore. Some network
+// switches drop very small UDP datagrams; a size of 64 bytes is sufficient to
+// avoid this on such hardware.
+//
+// By default, discovery requests are not padded, and are 20 bytes in length.
+// n must not exceed the maximum size of an HDHomeRun UDP packet.
+func DiscoverMinRequestSize(n int) DiscovererOption {
+	return func(d *Discoverer) error {
+		if n < 0 {
+			return fmt.Errorf("minimum request size must not be negative: %d", n)
+		}
+		if n > libhdhomerun.MaxPacketSize {
+			return fmt.Errorf("minimum request size %d exceeds maximum UDP packet size %d",
+				n, libhdhomerun.MaxPacketSize)
+		}
+
+		d.minSize = n
+		return nil
+	}
+}
+
+// DiscoverMinInterval requests that discovery requests be sent no more often
+// than once per interval d. It applies to the retries made by WaitForOnline,
+// limiting the rate of broadcasts on networks where frequent broadcasts are
+// undesirable, such as those monitored by an intrusion detection system.
+//
+// By default, WaitForOnline sends a discovery request roughly once per second.
+func DiscoverMinInterval(d time.Duration) DiscovererOption {
+	return func(dd *Discoverer) error {
+		if d < 0 {
+			return fmt.Errorf("minimum interval must not be negative: %v", d)
+		}
+
+		dd.minInterval = d
+		return nil
+	}
+}
+
+// DiscoverPerInterfaceDelay requests that a Discoverer send a separate
+// discovery request to the broadcast address of each local IPv4 network
+// interface which is up, waiting d between each request, rather than a single
+// request to all interfaces at once. Some operating systems drop packets when
+// broadcasting on many interfaces simultaneously; spacing out the requests
+// trades a little latency for reliability on such hosts. Replies from every
+// interface are returned by Discover as they arrive, and MergeDevices can
+// be used to merge any device which replies on more than one interface.
+//
+// NewDiscoverer sends the first request, and the first call to Discover
+// sends the remaining requests in the background until they have all been
+// sent or its context is canceled. Errors sending the remaining requests
+// are ignored, since replies may already have arrived from other interfaces.
+//
+// By default, the delay is zero and a single request is broadcast on all
+// interfaces simultaneously.
+func DiscoverPerInterfaceDelay(d time.Duration) DiscovererOption {
+	return func(dd *Discoverer) error {
+		if d < 0 {
+			return fmt.Errorf("per-interface delay must not be negative: %v", d)
+		}
+
+		dd.ifaceDelay = d
+		return nil
+	}
+}
+
+// DiscoverLocalIP requests that a Discoverer send discovery requests from the
+// specified local IP address, such as an alias address on a network interface.
+// The IP address must be assigned to a local network interface.
+func DiscoverLocalIP(ip net.IP) DiscovererOption {
+	return func(d *Discoverer) error {
+		if !isLocalIP(ip) {
+			return fmt.Errorf("IP address %s is not assigned to a local network interface", ip)
+		}
+
+		d.localAddr = &net.UDPAddr{
+			IP: ip,
+		}
+		return nil
+	}
+}
+
+// isLocalIP determines if ip is assigned to a local network interface.
+func isLocalIP(ip net.IP) bool {
+	ias, err := listInterfaces()
+	if err != nil {
+		return false
+	}
+
+	for _, ia := range ias {
+		for _, a := range ia.Addrs {
+			ipn, ok := a.(*net.IPNet)
+			if ok && ipn.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // discoverLocalUDPAddr controls the address used for the Discoverer's local
 // UDP listener.
 func discoverLocalUDPAddr(network, addr string) DiscovererOption {
@@ -111,6 +259,24 @@ func discoverLocalUDPAddr(network, addr string) DiscovererOption {
 	}
 }
 
+// discoverTargets requests that a Discoverer send its discovery requests to
+// each of addrs, rather than to its multicast address.
+func discoverTargets(addrs []*net.UDPAddr) DiscovererOption {
+	return func(d *Discoverer) error {
+		d.targets = addrs
+		return nil
+	}
+}
+
+// discoverSend replaces the function a Discoverer uses to send its discovery
+// requests.
+func discoverSend(fn func(c *net.UDPConn, b []byte, addr *net.UDPAddr) error) DiscovererOption {
+	return func(d *Discoverer) error {
+		d.send = fn
+		return nil
+	}
+}
+
 // discoverMulticastUDPAddr controls the address used for the Discoverer's
 // multicast UDP discovery requests.
 func discoverMulticastUDPAddr(network, addr string) DiscovererOption {
@@ -132,6 +298,81 @@ func discoverMulticastUDPAddr(network, addr string) DiscovererOption {
 // If needed, DiscovererOptions can be provided to modify the behavior of
 // the Discoverer.
 func NewDiscoverer(options ...DiscovererOption) (*Discoverer, error) {
+	d, err := newDiscoverer(options)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := net.ListenUDP("udp", d.localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Discover devices of specified type and ID using the configured
+	// multicast group, explicit targets such as subnet broadcast addresses,
+	// or each interface's broadcast address in turn.
+	addrs := []*net.UDPAddr{d.multicastAddr}
+	switch {
+	case len(d.targets) > 0:
+		addrs = d.targets
+	case d.ifaceDelay > 0:
+		ifaddrs, err := interfaceBroadcasts(d.multicastAddr.Port)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+
+		if len(ifaddrs) > 0 {
+			addrs = ifaddrs
+		}
+	}
+
+	d.c = c
+	d.req = mustDiscoverPacket(d.deviceType, d.deviceID, d.minSize)
+
+	// When requests are spaced out, only the first is sent now and Discover
+	// sends the rest.
+	send := addrs
+	if d.ifaceDelay > 0 {
+		send, d.deferred = addrs[:1], addrs[1:]
+	}
+
+	for _, addr := range send {
+		if err := d.send(c, d.req, addr); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// sendDeferred sends the discovery request to each of addrs in turn, waiting
+// ifaceDelay before each request, until all have been sent or the context
+// is canceled.
+func (d *Discoverer) sendDeferred(ctx context.Context, addrs []*net.UDPAddr) {
+	for _, addr := range addrs {
+		select {
+		case <-ctx.Done():
+			return
+		case <-discoverAfter(d.ifaceDelay):
+		}
+
+		if err := d.send(d.c, d.req, addr); err != nil {
+			// Most likely the listener was closed; any other error will
+			// also be reported by Discover.
+			return
+		}
+	}
+}
+
+// discoverAfter is used to wait between deferred discovery requests. It is
+// a variable so it can be swapped out in tests.
+var discoverAfter = time.After
+
+// newDiscoverer creates a Discoverer with the input options applied, but
+// without a listener.
+func newDiscoverer(options []DiscovererOption) (*Discoverer, error) {
 	d := &Discoverer{
 		// Search for any type of device.
 		deviceType: DeviceTypeWildcard,
@@ -142,6 +383,10 @@ func NewDiscoverer(options ...DiscovererOption) (*Discoverer, error) {
 		},
 		// Bind to any port on all interfaces.
 		localAddr: nil,
+		send: func(c *net.UDPConn, b []byte, addr *net.UDPAddr) error {
+			_, err := c.WriteToUDP(b, addr)
+			return err
+		},
 	}
 
 	// Prepend options which are applied automatically, so user options
@@ -157,24 +402,13 @@ func NewDiscoverer(options ...DiscovererOption) (*Discoverer, error) {
 		}
 	}
 
-	c, err := net.ListenUDP("udp", d.localAddr)
-	if err != nil {
-		return nil, err
-	}
-
-	// Discover devices of specified type and ID using the configured
-	// multicast group.
-	b := mustDiscoverPacket(d.deviceType, d.deviceID)
-	if _, err := c.WriteToUDP(b, d.multicastAddr); err != nil {
-		_ = c.Close()
-		return nil, err
-	}
-
-	return &Discoverer{
-		c: c,
-	}, nil
+	return d, nil
 }
 
+// errNotHDHomeRun indicates that a datagram received during discovery is not
+// an HDHomeRun packet.
+var errNotHDHomeRun = errors.New("datagram is not an HDHomeRun packet")
+
 // A retryableError is an error returned during discovery that indicates a
 // malformed reply from a device.
 type retryableError struct {
@@ -207,6 +441,17 @@ func (d *Discoverer) Discover(ctx context.Context) (*DiscoveredDevice, error) {
 	default:
 	}
 
+	if len(d.deferred) > 0 {
+		go d.sendDeferred(ctx, d.deferred)
+		d.deferred = nil
+	}
+
+	if len(d.pending) > 0 {
+		device := d.pending[0]
+		d.pending = d.pending[1:]
+		return device, nil
+	}
+
 	for {
 		// Keep trying to discover a device until context is canceled or a
 		// fatal error is returned.  Malformed device replies will result
@@ -280,32 +525,275 @@ func (d *Discoverer) discover(ctx context.Context) (*DiscoveredDevice, error) {
 	// it can stop waiting for context cancelation.
 	msgC <- struct{}{}
 
+	// Other applications may share the discovery port, so cheaply discard
+	// datagrams which do not begin with an HDHomeRun packet.
+	if n < 8 || packetLength(b) > n || !IsHDHomeRunPacket(b[:packetLength(b)]) {
+		return nil, &retryableError{err: errNotHDHomeRun}
+	}
+
 	// There's no guarantee that the message we received is a valid discover
 	// reply, so any errors here result in another network read to continue
 	// looking for valid devices.
+	//
+	// Though uncommon, some proxies pack several replies into one datagram,
+	// so decode as many replies as possible and save any extras for later.
+	var (
+		devices []*DiscoveredDevice
+		perr    error
+	)
+
+	for buf := b[:n]; len(buf) > 0; {
+		var p Packet
+		pn, err := (&p).UnmarshalBinaryN(buf)
+		if err != nil {
+			// Packet framing is lost; no more replies can be decoded.
+			perr = err
+			break
+		}
+		buf = buf[pn:]
 
-	var p Packet
-	if err := (&p).UnmarshalBinary(b[:n]); err != nil {
-		return nil, &retryableError{err: err}
+		device, err := newDiscoveredDevice(addr.String(), p)
+		if err != nil {
+			perr = err
+			continue
+		}
+
+		if uaddr, ok := addr.(*net.UDPAddr); ok {
+			device.LocalAddr, device.Interface = localRoute(uaddr.IP)
+		}
+
+		devices = append(devices, device)
+	}
+
+	if len(devices) == 0 {
+		return nil, &retryableError{err: perr}
+	}
+
+	d.pending = append(d.pending, devices[1:]...)
+	return devices[0], nil
+}
+
+// An ifaceAddrs is a network interface and its addresses.
+type ifaceAddrs struct {
+	Name  string
+	Flags net.Flags
+	Addrs []net.Addr
+}
+
+// listInterfaces returns the network interfaces and addresses of this
+// machine. It is a variable so it can be swapped out in tests.
+var listInterfaces = func() ([]ifaceAddrs, error) {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return nil, err
 	}
 
-	device, err := newDiscoveredDevice(addr.String(), p)
+	ias := make([]ifaceAddrs, 0, len(ifis))
+	for _, ifi := range ifis {
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		ias = append(ias, ifaceAddrs{
+			Name:  ifi.Name,
+			Flags: ifi.Flags,
+			Addrs: addrs,
+		})
+	}
+
+	return ias, nil
+}
+
+// interfaceBroadcasts returns the distinct broadcast addresses of each local
+// IPv4 network on an interface which is up and is not a loopback interface,
+// using the specified port.
+func interfaceBroadcasts(port int) ([]*net.UDPAddr, error) {
+	ias, err := listInterfaces()
 	if err != nil {
-		return nil, &retryableError{err: err}
+		return nil, err
 	}
 
-	return device, nil
+	var (
+		addrs []*net.UDPAddr
+		seen  = make(map[string]bool)
+	)
+
+	for _, ia := range ias {
+		if ia.Flags&net.FlagUp == 0 || ia.Flags&net.FlagLoopback != 0 {
+			// No devices can be reached on this interface.
+			continue
+		}
+
+		for _, a := range ia.Addrs {
+			ipn, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			bcast := broadcastAddr(ipn)
+			if bcast == nil || seen[bcast.String()] {
+				continue
+			}
+			seen[bcast.String()] = true
+
+			addrs = append(addrs, &net.UDPAddr{
+				IP:   bcast,
+				Port: port,
+			})
+		}
+	}
+
+	return addrs, nil
+}
+
+// broadcastAddr returns the broadcast address of the IPv4 subnet ipn, or nil
+// if ipn is not an IPv4 subnet.
+func broadcastAddr(ipn *net.IPNet) net.IP {
+	ip := ipn.IP.To4()
+	mask := ipn.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	if ip == nil || len(mask) != net.IPv4len {
+		return nil
+	}
+
+	bcast := make(net.IP, net.IPv4len)
+	for i := range bcast {
+		bcast[i] = ip[i] | ^mask[i]
+	}
+
+	return bcast
+}
+
+// localRoute determines the local IP address and network interface which are
+// directly attached to the same subnet as the remote IP address ip. If none
+// can be found, it returns nil and an empty string.
+func localRoute(ip net.IP) (net.IP, string) {
+	ias, err := listInterfaces()
+	if err != nil {
+		return nil, ""
+	}
+
+	for _, ia := range ias {
+		for _, a := range ia.Addrs {
+			ipn, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			if ipn.Contains(ip) {
+				return ipn.IP, ia.Name
+			}
+		}
+	}
+
+	return nil, ""
+}
+
+// waitForOnlineInterval is the amount of time WaitForOnline spends on each
+// discovery attempt before sending another discovery request.
+var waitForOnlineInterval = 1 * time.Second
+
+// WaitForOnline repeatedly performs discovery until a device is found or
+// the context is canceled, such as when waiting for a device to come back
+// online after Client.Restart. Typically, DiscoverDeviceID is used to wait
+// for one specific device.
+//
+// If the context is canceled before a device is found, the context's error
+// is returned.
+func WaitForOnline(ctx context.Context, options ...DiscovererOption) (*DiscoveredDevice, error) {
+	// Apply the options up front to determine the minimum interval between
+	// discovery requests.
+	cfg, err := newDiscoverer(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var last time.Time
+	for {
+		if err := waitInterval(ctx, last, cfg.minInterval); err != nil {
+			return nil, err
+		}
+		last = time.Now()
+
+		d, err := NewDiscoverer(options...)
+		if err != nil {
+			return nil, err
+		}
+
+		actx, cancel := context.WithTimeout(ctx, waitForOnlineInterval)
+		device, err := d.Discover(actx)
+		cancel()
+
+		switch err {
+		case nil:
+			// Found a device; clean up the listener since discovery
+			// is complete.
+			_ = d.c.Close()
+			return device, nil
+		case io.EOF:
+			// Attempt timed out or parent context canceled.
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, err
+		}
+	}
+}
+
+// waitInterval blocks until at least interval has elapsed since last, or the
+// context is canceled. It returns immediately if last is the zero time.
+func waitInterval(ctx context.Context, last time.Time, interval time.Duration) error {
+	if last.IsZero() {
+		return nil
+	}
+
+	wait := interval - time.Since(last)
+	if wait <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
 }
 
 // A DiscoveredDevice is a device encountered during discovery.  Its network
 // address can be used with Dial to initiate a direct connection to a device.
 type DiscoveredDevice struct {
-	// ID is the unique ID of this device.
+	// ID is the unique ID of this device. Storage devices found by
+	// DiscoverCloud have no ID, and are identified by StorageID instead.
 	ID string
 
+	// StorageID, if available, is the unique ID of a storage device, such as
+	// an HDHomeRun DVR, as reported by DiscoverCloud. Unlike an ID, it is a
+	// UUID such as "1234ABCD-0000-0000-0000-000000000000".
+	StorageID string
+
 	// Addr is the network address of this device.
 	Addr string
 
+	// Addrs contains every network address at which this device was
+	// discovered. It is populated by MergeDevices, and otherwise contains
+	// only Addr.
+	Addrs []string
+
+	// LocalAddr and Interface, if available, are the local IP address and
+	// network interface which share a subnet with this device. On machines
+	// with multiple network interfaces, they indicate which network path
+	// reaches the device.
+	LocalAddr net.IP
+	Interface string
+
 	// Type is the type of device discovered, such as a tuner or storage unit.
 	Type DeviceType
 
@@ -314,6 +802,505 @@ type DiscoveredDevice struct {
 
 	// Tuners is the number of TV tuners available to the device.
 	Tuners int
+
+	// AuthStr, if available, is the device's authentication string, which
+	// is used to authenticate requests made on behalf of the device to
+	// HDHomeRun cloud services.
+	AuthStr string
+
+	// RawTags contains every Tag from the device's discovery reply in wire
+	// order, including Tags which are not otherwise parsed into the fields
+	// of a DiscoveredDevice, such as those added by newer firmware.
+	RawTags []Tag
+}
+
+// TunerCount returns the number of tuners available to a DiscoveredDevice.
+// The tuner count from the device's discovery reply is preferred, but some
+// firmware omits it. In that case, the count is queried using c, which must
+// be connected to the same device. If c is nil, a connection to the device's
+// Addr is dialed for the query and closed afterward.
+func (d *DiscoveredDevice) TunerCount(c *Client) (int, error) {
+	if d.Tuners > 0 {
+		return d.Tuners, nil
+	}
+
+	if c == nil {
+		if d.Addr == "" {
+			return 0, errors.New("device has no address")
+		}
+
+		dc, err := Dial(d.Addr)
+		if err != nil {
+			return 0, err
+		}
+		defer dc.Close()
+
+		c = dc
+	}
+
+	return c.TunerCount()
+}
+
+// Key returns a stable identifier for the physical device described by a
+// DiscoveredDevice, suitable for caching and deduplication. Two
+// DiscoveredDevices with the same Key refer to the same device, even if one
+// was found on the local network and the other by DiscoverCloud.
+//
+// The Key is the device's ID in lower case, since IDs are unique to each
+// device regardless of how it was found. Devices without an ID, such as
+// storage devices or relay entries, are keyed by their StorageID, their URL,
+// or failing that their Addr; these Keys are prefixed so that they can never
+// equal an ID.
+func (d *DiscoveredDevice) Key() string {
+	switch {
+	case d.ID != "":
+		return strings.ToLower(d.ID)
+	case d.StorageID != "":
+		return "storage:" + strings.ToLower(d.StorageID)
+	case d.URL != nil:
+		return "url:" + d.URL.String()
+	default:
+		return "addr:" + d.Addr
+	}
+}
+
+// SerialString returns the device's ID in the upper case form printed on the
+// label of a physical device, such as "10A0F2CB", so that discovered devices
+// can be matched to physical units. ValidDeviceID can be used to check the ID
+// of a device which was not found by discovery.
+//
+// SerialString returns an empty string for a device without an ID, such as a
+// storage device identified by its StorageID.
+func (d *DiscoveredDevice) SerialString() string {
+	return strings.ToUpper(d.ID)
+}
+
+// ErrPingTimeout is returned by DiscoveredDevice.Ping when the context's
+// deadline is exceeded before the device replies.
+var ErrPingTimeout = errors.New("timed out waiting for device to reply")
+
+// deviceBinaryVersion is the version of the binary form produced by
+// DiscoveredDevice.MarshalBinary.
+const deviceBinaryVersion = 1
+
+// Tag types which are not used by the HDHomeRun protocol, and are used to
+// store a DiscoveredDevice's Addr and StorageID in its binary form.
+const (
+	tagDeviceAddr = 0x7e
+	tagStorageID  = 0x7d
+)
+
+// MarshalBinary marshals a DiscoveredDevice into a compact binary form, so
+// that discovery results can be stored between runs. The ID, StorageID,
+// Addr, Type, URL, Tuners, and AuthStr fields are stored; the remaining
+// fields describe a particular discovery and are not. A device must have an
+// ID, a StorageID, or both, and an ID must be a valid hexadecimal device ID.
+//
+// The binary form is a version byte followed by a discover reply Packet
+// carrying the stored fields as Tags, so it is protected by the Packet's
+// checksum.
+func (d *DiscoveredDevice) MarshalBinary() ([]byte, error) {
+	if d.ID == "" && d.StorageID == "" {
+		return nil, errors.New("device has neither an ID nor a storage ID")
+	}
+
+	if d.Tuners < 0 || d.Tuners > 0xff {
+		return nil, fmt.Errorf("tuner count out of range: %d", d.Tuners)
+	}
+
+	typ := make([]byte, 4)
+	binary.BigEndian.PutUint32(typ, uint32(d.Type))
+
+	p := NewPacket(libhdhomerun.TypeDiscoverRpy, 7)
+	p.Tags = append(p.Tags, Tag{Type: libhdhomerun.TagDeviceType, Data: typ})
+
+	if d.ID != "" {
+		id, err := ParseDeviceID(d.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Tags = append(p.Tags, Tag{Type: libhdhomerun.TagDeviceId, Data: id})
+	}
+	if d.StorageID != "" {
+		p.Tags = append(p.Tags, Tag{Type: tagStorageID, Data: []byte(d.StorageID)})
+	}
+	if d.Addr != "" {
+		p.Tags = append(p.Tags, Tag{Type: tagDeviceAddr, Data: []byte(d.Addr)})
+	}
+	if d.Tuners > 0 {
+		p.Tags = append(p.Tags, Tag{Type: libhdhomerun.TagTunerCount, Data: []byte{byte(d.Tuners)}})
+	}
+	if d.URL != nil {
+		p.Tags = append(p.Tags, Tag{Type: libhdhomerun.TagBaseUrl, Data: []byte(d.URL.String())})
+	}
+	if d.AuthStr != "" {
+		p.Tags = append(p.Tags, Tag{Type: libhdhomerun.TagDeviceAuthStr, Data: []byte(d.AuthStr)})
+	}
+
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{deviceBinaryVersion}, pb...), nil
+}
+
+// UnmarshalBinary unmarshals a DiscoveredDevice from the binary form produced
+// by MarshalBinary. Its RawTags contain the stored Tags, other than the Tags
+// used to store Addr and StorageID.
+func (d *DiscoveredDevice) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+
+	if v := b[0]; v != deviceBinaryVersion {
+		return fmt.Errorf("unsupported device binary version: %d", v)
+	}
+
+	var p Packet
+	if err := p.UnmarshalBinary(b[1:]); err != nil {
+		return err
+	}
+
+	if p.Type != libhdhomerun.TypeDiscoverRpy {
+		return fmt.Errorf("expected discover reply, but got %#x", p.Type)
+	}
+
+	dd := &DiscoveredDevice{
+		RawTags: make([]Tag, 0, len(p.Tags)),
+	}
+
+	for _, t := range p.Tags {
+		switch t.Type {
+		case tagDeviceAddr:
+			dd.Addr = string(t.Data)
+			dd.Addrs = []string{dd.Addr}
+		case tagStorageID:
+			dd.StorageID = string(t.Data)
+		default:
+			dd.RawTags = append(dd.RawTags, t)
+		}
+	}
+
+	if err := dd.parseTags(dd.RawTags); err != nil {
+		return err
+	}
+
+	if dd.Type == 0 {
+		return errors.New("no device type found in stored device")
+	}
+	if dd.ID == "" && dd.StorageID == "" {
+		return errors.New("no device ID or storage ID found in stored device")
+	}
+
+	*d = *dd
+	return nil
+}
+
+// Ping sends a unicast discovery request to the device at Addr, and waits
+// for the device to reply, confirming that it is online without opening a
+// control connection. If LocalAddr is set, the request is sent from that
+// address.
+//
+// Ping blocks until the device replies or the context is canceled, so the
+// context should carry a deadline. If the deadline is exceeded before the
+// device replies, ErrPingTimeout is returned.
+func (d *DiscoveredDevice) Ping(ctx context.Context) error {
+	addr, err := net.ResolveUDPAddr("udp", d.Addr)
+	if err != nil {
+		return err
+	}
+
+	id, err := ParseDeviceID(d.ID)
+	if err != nil {
+		return err
+	}
+
+	c, err := net.ListenUDP("udp", &net.UDPAddr{IP: d.LocalAddr})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	b := mustDiscoverPacket(DeviceTypeWildcard, id, 0)
+	if _, err := c.WriteToUDP(b, addr); err != nil {
+		return err
+	}
+
+	dd := &Discoverer{c: c}
+	for {
+		device, err := dd.Discover(ctx)
+		switch err {
+		case nil:
+		case io.EOF:
+			if ctx.Err() == context.DeadlineExceeded {
+				return ErrPingTimeout
+			}
+
+			return ctx.Err()
+		default:
+			return err
+		}
+
+		// Ignore replies from any other device. Device IDs are hexadecimal,
+		// so they may differ in case.
+		if strings.EqualFold(device.ID, d.ID) {
+			return nil
+		}
+	}
+}
+
+// DiscoverSubnets sends a discovery request to the directed broadcast address
+// of each of the input IPv4 subnets, such as the VLANs of a large deployment,
+// and collects replies until the context is canceled or its deadline is
+// exceeded. ctx should have a deadline, since replies are otherwise collected
+// indefinitely. Devices which reply more than once, such as on several
+// subnets, are merged using MergeDevices. The DiscovererOptions are applied
+// to discovery.
+//
+// Directed broadcasts can reach devices on subnets to which this machine is
+// not directly attached, but only if every router along the way forwards
+// them. Many routers drop directed broadcasts by default to mitigate
+// amplification attacks, so devices on such subnets will not be found.
+func DiscoverSubnets(ctx context.Context, subnets []*net.IPNet, options ...DiscovererOption) ([]*DiscoveredDevice, error) {
+	cfg, err := newDiscoverer(options)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]*net.UDPAddr, 0, len(subnets))
+	for _, s := range subnets {
+		bcast := broadcastAddr(s)
+		if bcast == nil {
+			return nil, fmt.Errorf("subnet %s is not an IPv4 subnet", s)
+		}
+
+		addrs = append(addrs, &net.UDPAddr{
+			IP:   bcast,
+			Port: cfg.multicastAddr.Port,
+		})
+	}
+
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+
+	d, err := NewDiscoverer(append(options, discoverTargets(addrs))...)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*DiscoveredDevice
+	for {
+		device, err := d.Discover(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, device)
+	}
+
+	return MergeDevices(devices), nil
+}
+
+// MergeDevices merges DiscoveredDevices which have the same Key, such as when
+// a device on a bridged network replies to discovery from more than one
+// address, or is found both locally and by DiscoverCloud. The merged
+// device's Addrs contains every distinct, non-empty address for that device
+// in the order they were discovered, and its Addr is the first of those.
+// Its remaining fields are those of the first device discovered with that
+// Key. The input devices are not modified.
+func MergeDevices(devices []*DiscoveredDevice) []*DiscoveredDevice {
+	idx := make(map[string]int, len(devices))
+	merged := make([]*DiscoveredDevice, 0, len(devices))
+
+	for _, d := range devices {
+		key := d.Key()
+		i, ok := idx[key]
+		if !ok {
+			dd := *d
+			dd.Addrs = nil
+			if d.Addr != "" {
+				dd.Addrs = []string{d.Addr}
+			}
+
+			idx[key] = len(merged)
+			merged = append(merged, &dd)
+			continue
+		}
+
+		m := merged[i]
+		if m.Addr == "" {
+			m.Addr = d.Addr
+		}
+		if d.Addr != "" && !hasString(m.Addrs, d.Addr) {
+			m.Addrs = append(m.Addrs, d.Addr)
+		}
+	}
+
+	return merged
+}
+
+// ForEachDevice dials each of the input devices and invokes fn with a Client
+// connected to that device, using at most concurrency connections at once.
+// Each Client is closed once fn has returned for that device, even if fn
+// returns an error.
+//
+// Devices are identified by their Key, so if the same device appears more
+// than once in devices, a single connection to it is shared and fn is
+// invoked for each appearance in turn rather than concurrently. Operations on
+// different devices run concurrently.
+//
+// An error from one device does not stop ForEachDevice from processing the
+// others. If any errors occur, ForEachDevice returns DeviceErrors containing
+// an error for each device which failed. Devices which were not processed
+// because the context was canceled report the context's error.
+func ForEachDevice(ctx context.Context, devices []*DiscoveredDevice, concurrency int, fn func(ctx context.Context, c *Client) error) error {
+	if concurrency <= 0 {
+		return fmt.Errorf("concurrency must be positive: %d", concurrency)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs DeviceErrors
+	)
+
+	addErr := func(d *DiscoveredDevice, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		errs = append(errs, &DeviceError{
+			ID:   d.ID,
+			Addr: d.Addr,
+			Err:  err,
+		})
+	}
+
+	// Group duplicate devices by Key, preserving the order in which each
+	// device first appears. Devices without an ID are keyed by address, so
+	// each is dialed separately.
+	var keys []string
+	groups := make(map[string][]*DiscoveredDevice)
+	for _, d := range devices {
+		k := d.Key()
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+
+		groups[k] = append(groups[k], d)
+	}
+
+	sem := make(chan struct{}, concurrency)
+	for _, k := range keys {
+		group := groups[k]
+
+		// Wait for a free slot, unless the context is canceled first.
+		select {
+		case <-ctx.Done():
+			for _, d := range group {
+				addErr(d, ctx.Err())
+			}
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(group []*DiscoveredDevice) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			forDevice(ctx, group, fn, addErr)
+		}(group)
+	}
+
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// forDevice dials the device shared by each entry in group and invokes fn
+// once per entry with the resulting Client, one at a time. Errors are
+// reported using addErr.
+func forDevice(ctx context.Context, group []*DiscoveredDevice, fn func(ctx context.Context, c *Client) error, addErr func(d *DiscoveredDevice, err error)) {
+	fail := func(err error) {
+		for _, d := range group {
+			addErr(d, err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		fail(err)
+		return
+	}
+
+	c, err := Dial(group[0].Addr)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer c.Close()
+
+	for _, d := range group {
+		if err := ctx.Err(); err != nil {
+			addErr(d, err)
+			continue
+		}
+
+		if err := fn(ctx, c); err != nil {
+			addErr(d, err)
+		}
+	}
+}
+
+// A DeviceError is an error which occurred while operating on a device.
+type DeviceError struct {
+	// ID and Addr identify the device.
+	ID   string
+	Addr string
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *DeviceError) Error() string {
+	return fmt.Sprintf("device %s (%s): %v", e.ID, e.Addr, e.Err)
+}
+
+// DeviceErrors is a collection of errors which occurred while operating on
+// multiple devices.
+type DeviceErrors []*DeviceError
+
+// Error implements error.
+func (errs DeviceErrors) Error() string {
+	ss := make([]string, 0, len(errs))
+	for _, err := range errs {
+		ss = append(ss, err.Error())
+	}
+
+	return strings.Join(ss, "; ")
+}
+
+// hasString determines if s is present in ss.
+func hasString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
 }
 
 // newDiscoveredDevice creates a DiscoveredDevice using the data from a
@@ -324,7 +1311,9 @@ func newDiscoveredDevice(addr string, p Packet) (*DiscoveredDevice, error) {
 	}
 
 	device := &DiscoveredDevice{
-		Addr: addr,
+		Addr:    addr,
+		Addrs:   []string{addr},
+		RawTags: p.Tags,
 	}
 
 	if err := device.parseTags(p.Tags); err != nil {
@@ -370,6 +1359,8 @@ func (d *DiscoveredDevice) parseTags(tags []Tag) error {
 			}
 
 			d.Tuners = int(t.Data[0])
+		case libhdhomerun.TagDeviceAuthStr:
+			d.AuthStr = string(t.Data)
 		default:
 			// TODO(mdlayher): handle additional tags if needed
 		}
@@ -378,10 +1369,15 @@ func (d *DiscoveredDevice) parseTags(tags []Tag) error {
 	return nil
 }
 
+// tagPadding is a Tag type which is not used by the HDHomeRun protocol, and
+// is used to pad discovery requests.
+const tagPadding = 0x7f
+
 // mustDiscoverPacket produces the bytes for a device discovery packet,
-// using the specified or wildcard device type and device ID. It panics
-// if any errors occur while creating the discovery packet.
-func mustDiscoverPacket(typ DeviceType, id []byte) []byte {
+// using the specified or wildcard device type and device ID. If the packet
+// is smaller than minSize bytes, it is padded to at least minSize bytes. It
+// panics if any errors occur while creating the discovery packet.
+func mustDiscoverPacket(typ DeviceType, id []byte, minSize int) []byte {
 	if len(id) != 4 {
 		panicf("device ID must be exactly 4 bytes: %v", id)
 	}
@@ -403,6 +1399,21 @@ func mustDiscoverPacket(typ DeviceType, id []byte) []byte {
 		},
 	}
 
+	// Header, tags, and checksum.
+	size := 2 + 2 + tagLength(len(b)) + tagLength(len(id)) + 4
+	if extra := minSize - size; extra > 0 {
+		// Find the smallest padding tag which meets the minimum size.
+		var n int
+		for tagLength(n) < extra {
+			n++
+		}
+
+		p.Tags = append(p.Tags, Tag{
+			Type: tagPadding,
+			Data: make([]byte, n),
+		})
+	}
+
 	pb, err := p.MarshalBinary()
 	if err != nil {
 		panicf("failed to marshal discover packet: %v", err)
@@ -2,13 +2,17 @@ package hdhomerun
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -79,6 +83,48 @@ func TestParseDeviceID(t *testing.T) {
 	}
 }
 
+func TestValidDeviceID(t *testing.T) {
+	tests := []struct {
+		id string
+		ok bool
+	}{
+		{id: ""},
+		{id: "nothex"},
+		{id: "deadbeef"},
+		{id: "12345675"},
+		{id: "12345674", ok: true},
+		{id: "10a0f2cb", ok: true},
+		{id: "10A0F2CB", ok: true},
+		{id: DeviceIDWildcard, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if diff := cmp.Diff(tt.ok, ValidDeviceID(tt.id)); diff != "" {
+				t.Fatalf("unexpected device ID validity (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiscoveredDeviceSerialString(t *testing.T) {
+	d := &DiscoveredDevice{ID: "10a0f2cb"}
+
+	if diff := cmp.Diff("10A0F2CB", d.SerialString()); diff != "" {
+		t.Fatalf("unexpected serial string (-want +got):\n%s", diff)
+	}
+
+	if !ValidDeviceID(d.SerialString()) {
+		t.Fatalf("serial string %q is not a valid device ID", d.SerialString())
+	}
+
+	// Storage devices have no serial.
+	storage := &DiscoveredDevice{StorageID: "1234ABCD-0000-0000-0000-000000000000"}
+	if diff := cmp.Diff("", storage.SerialString()); diff != "" {
+		t.Fatalf("unexpected storage serial string (-want +got):\n%s", diff)
+	}
+}
+
 func TestDiscoverOneDevice(t *testing.T) {
 	// Check for goroutine leaks.
 	defer leaktest.Check(t)()
@@ -98,15 +144,49 @@ func TestDiscoverOneDevice(t *testing.T) {
 		},
 	}
 
+	// Reply with all known tags and an unknown tag, such as the lineup URL
+	// reported by newer firmware.
+	tags := []Tag{
+		{
+			Type: libhdhomerun.TagDeviceType,
+			Data: []byte{0x00, 0x00, 0x00, 0x01},
+		},
+		{
+			Type: libhdhomerun.TagDeviceId,
+			Data: []byte{0xde, 0xad, 0xbe, 0xef},
+		},
+		{
+			Type: libhdhomerun.TagBaseUrl,
+			Data: []byte("http://192.168.1.1:80"),
+		},
+		{
+			Type: libhdhomerun.TagTunerCount,
+			Data: []byte{0x03},
+		},
+		{
+			Type: libhdhomerun.TagDeviceAuthStr,
+			Data: []byte("q3Uj5GiXxTqwgWlGrBqiPxEz"),
+		},
+		{
+			Type: 0x27,
+			Data: []byte("http://192.168.1.1:80/lineup.json"),
+		},
+	}
+
 	wantDevice := &DiscoveredDevice{
-		ID:   "deadbeef",
-		Addr: "127.0.0.1:65002",
-		Type: DeviceTypeTuner,
+		ID:        "deadbeef",
+		Addr:      "127.0.0.1:65002",
+		Addrs:     []string{"127.0.0.1:65002"},
+		LocalAddr: net.IPv4(127, 0, 0, 1),
+		Interface: testLoopback(t),
+		Type:      DeviceTypeTuner,
 		URL: &url.URL{
 			Scheme: "http",
 			Host:   "192.168.1.1:80",
 		},
-		Tuners: 3,
+		Tuners:  3,
+		AuthStr: "q3Uj5GiXxTqwgWlGrBqiPxEz",
+		RawTags: tags,
 	}
 
 	d, done := testListener(t, 1, func(req *Packet) (*Packet, error) {
@@ -116,24 +196,7 @@ func TestDiscoverOneDevice(t *testing.T) {
 
 		return &Packet{
 			Type: libhdhomerun.TypeDiscoverRpy,
-			Tags: []Tag{
-				{
-					Type: libhdhomerun.TagDeviceType,
-					Data: []byte{0x00, 0x00, 0x00, 0x01},
-				},
-				{
-					Type: libhdhomerun.TagDeviceId,
-					Data: []byte{0xde, 0xad, 0xbe, 0xef},
-				},
-				{
-					Type: libhdhomerun.TagBaseUrl,
-					Data: []byte("http://192.168.1.1:80"),
-				},
-				{
-					Type: libhdhomerun.TagTunerCount,
-					Data: []byte{0x03},
-				},
-			},
+			Tags: tags,
 		}, nil
 	})
 	defer done()
@@ -189,6 +252,233 @@ func TestDiscoverOneHundredDevices(t *testing.T) {
 	}
 }
 
+func TestDiscoverCoalescedReplies(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	// No device is listening, so replies are sent manually below.
+	d, err := NewDiscoverer(testDiscovererOptions()...)
+	if err != nil {
+		t.Fatalf("failed to start discovery: %v", err)
+	}
+	defer d.c.Close()
+
+	ids := []string{"deadbeef", "01234567"}
+
+	// Pack two discover replies and some trailing garbage into a single
+	// datagram.
+	var b []byte
+	for _, id := range ids {
+		idb, err := ParseDeviceID(id)
+		if err != nil {
+			t.Fatalf("failed to parse device ID: %v", err)
+		}
+
+		pb, err := (&Packet{
+			Type: libhdhomerun.TypeDiscoverRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagDeviceType,
+					Data: []byte{0x00, 0x00, 0x00, 0x01},
+				},
+				{
+					Type: libhdhomerun.TagDeviceId,
+					Data: idb,
+				},
+			},
+		}).MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal reply: %v", err)
+		}
+
+		b = append(b, pb...)
+	}
+	b = append(b, 0xff)
+
+	c, err := net.ListenPacket("udp", testLocalAddr)
+	if err != nil {
+		t.Fatalf("failed to open device listener: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.WriteTo(b, d.c.LocalAddr()); err != nil {
+		t.Fatalf("failed to write replies: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	var got []string
+	for range ids {
+		device, err := d.Discover(ctx)
+		if err != nil {
+			t.Fatalf("failed to discover: %v", err)
+		}
+
+		got = append(got, device.ID)
+	}
+
+	if diff := cmp.Diff(ids, got); diff != "" {
+		t.Fatalf("unexpected device IDs (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiscoverIgnoresForeignDatagrams(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	// No device is listening, so datagrams are sent manually below.
+	d, err := NewDiscoverer(testDiscovererOptions()...)
+	if err != nil {
+		t.Fatalf("failed to start discovery: %v", err)
+	}
+	defer d.c.Close()
+
+	reply, err := (&Packet{
+		Type: libhdhomerun.TypeDiscoverRpy,
+		Tags: []Tag{
+			{
+				Type: libhdhomerun.TagDeviceType,
+				Data: []byte{0x00, 0x00, 0x00, 0x01},
+			},
+			{
+				Type: libhdhomerun.TagDeviceId,
+				Data: []byte{0xde, 0xad, 0xbe, 0xef},
+			},
+		},
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal reply: %v", err)
+	}
+
+	// A near miss: a discover reply with a corrupted checksum.
+	badCRC := make([]byte, len(reply))
+	copy(badCRC, reply)
+	badCRC[len(badCRC)-1]++
+
+	c, err := net.ListenPacket("udp", testLocalAddr)
+	if err != nil {
+		t.Fatalf("failed to open device listener: %v", err)
+	}
+	defer c.Close()
+
+	for _, b := range [][]byte{
+		[]byte("M-SEARCH * HTTP/1.1\r\n\r\n"),
+		{0x00},
+		badCRC,
+		reply,
+	} {
+		if _, err := c.WriteTo(b, d.c.LocalAddr()); err != nil {
+			t.Fatalf("failed to write datagram: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	device, err := d.Discover(ctx)
+	if err != nil {
+		t.Fatalf("failed to discover: %v", err)
+	}
+
+	if diff := cmp.Diff("deadbeef", device.ID); diff != "" {
+		t.Fatalf("unexpected device ID (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiscoverMultipleDevices(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	devices := []*DiscoveredDevice{
+		{
+			ID:     "deadbeef",
+			Type:   DeviceTypeTuner,
+			Tuners: 2,
+			URL: &url.URL{
+				Scheme: "http",
+				Host:   "192.168.1.10:80",
+			},
+		},
+		{
+			ID:   "01234567",
+			Type: DeviceTypeStorage,
+		},
+		{
+			ID:     "89abcdef",
+			Type:   DeviceTypeTuner,
+			Tuners: 4,
+		},
+	}
+
+	tests := []struct {
+		name    string
+		options []DiscovererOption
+		ids     []string
+	}{
+		{
+			name: "all",
+			ids:  []string{"01234567", "89abcdef", "deadbeef"},
+		},
+		{
+			name:    "tuners",
+			options: []DiscovererOption{DiscoverDeviceType(DeviceTypeTuner)},
+			ids:     []string{"89abcdef", "deadbeef"},
+		},
+		{
+			name:    "ID",
+			options: []DiscovererOption{DiscoverDeviceID("01234567")},
+			ids:     []string{"01234567"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, done := testResponder(t, devices, tt.options...)
+			defer done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			var found []*DiscoveredDevice
+			for {
+				device, err := d.Discover(ctx)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("failed to discover: %v", err)
+				}
+
+				found = append(found, device)
+			}
+
+			var ids []string
+			for _, device := range MergeDevices(found) {
+				ids = append(ids, device.ID)
+
+				for _, want := range devices {
+					if want.ID != device.ID {
+						continue
+					}
+
+					if diff := cmp.Diff(want.Tuners, device.Tuners); diff != "" {
+						t.Fatalf("unexpected tuner count (-want +got):\n%s", diff)
+					}
+					if diff := cmp.Diff(want.URL, device.URL); diff != "" {
+						t.Fatalf("unexpected URL (-want +got):\n%s", diff)
+					}
+				}
+			}
+			sort.Strings(ids)
+
+			if diff := cmp.Diff(tt.ids, ids); diff != "" {
+				t.Fatalf("unexpected device IDs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestDiscoverContextCanceled(t *testing.T) {
 	d, done := testListener(t, 1, noReply)
 	defer done()
@@ -411,84 +701,1529 @@ func TestDiscoverBadDeviceReplies(t *testing.T) {
 	}
 }
 
-// A handleFunc is a function which can be used to reply to a request
-// with testListener.
-type handleFunc func(req *Packet) (*Packet, error)
-
-// noReply is a handleFunc which returns no reply to a request.
-func noReply(req *Packet) (*Packet, error) {
-	// Return nothing.
-	return nil, errNoReply
-}
+func TestDiscoverPerInterfaceDelay(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
 
-// testListener creates a listener that emulates a HDHomeRun device, and
-// provides a Discoverer which can discover devices from it.  Invoke the
-// done closure to clean up resources.
-func testListener(t *testing.T, devices int, handle handleFunc) (*Discoverer, func()) {
-	const (
-		localAddr = "127.0.0.1:0"
-		// TODO(mdlayher): use a different address?
-		multicastAddr = "224.0.0.1:65002"
-	)
+	const delay = 50 * time.Millisecond
 
-	multicastUDPAddr, err := net.ResolveUDPAddr("udp", multicastAddr)
-	if err != nil {
-		t.Fatalf("failed to resolve multicast UDP listener address: %v", err)
+	ipn := func(ip net.IP, bits int) []net.Addr {
+		return []net.Addr{&net.IPNet{
+			IP:   ip,
+			Mask: net.CIDRMask(bits, 32),
+		}}
 	}
 
-	lo, err := net.InterfaceByName("lo")
-	if err != nil {
-		t.Fatalf("failed to get loopback device: %v", err)
+	// Only interfaces which are up and are not loopback interfaces should
+	// receive requests.
+	ifaces := []ifaceAddrs{
+		{
+			Name:  "lo",
+			Flags: net.FlagUp | net.FlagLoopback,
+			Addrs: ipn(net.IPv4(127, 0, 0, 1), 8),
+		},
+		{
+			Name:  "eth0",
+			Flags: net.FlagUp | net.FlagBroadcast,
+			Addrs: ipn(net.IPv4(192, 0, 2, 10), 24),
+		},
+		{
+			Name:  "eth1",
+			Flags: net.FlagBroadcast,
+			Addrs: ipn(net.IPv4(203, 0, 113, 10), 24),
+		},
+		{
+			Name:  "eth2",
+			Flags: net.FlagUp | net.FlagBroadcast,
+			Addrs: ipn(net.IPv4(198, 51, 100, 10), 24),
+		},
 	}
 
-	c, err := net.ListenMulticastUDP("udp", lo, multicastUDPAddr)
-	if err != nil {
-		t.Fatalf("failed to open multicast listener: %v", err)
+	list := listInterfaces
+	listInterfaces = func() ([]ifaceAddrs, error) {
+		return ifaces, nil
 	}
+	defer func() { listInterfaces = list }()
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
+	// Record each wait rather than actually waiting.
+	var (
+		mu    sync.Mutex
+		waits []time.Duration
+		addrs []string
+	)
 
-		var reqp Packet
-		b := make([]byte, 2048)
-		for {
-			n, addr, err := c.ReadFrom(b)
-			if err != nil {
-				if strings.Contains(err.Error(), "use of closed network connection") {
-					return
-				}
+	after := discoverAfter
+	discoverAfter = func(d time.Duration) <-chan time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		waits = append(waits, d)
 
-				panicf("failed to read: %v", err)
-			}
+		c := make(chan time.Time, 1)
+		c <- time.Time{}
+		return c
+	}
+	defer func() { discoverAfter = after }()
 
-			if err := reqp.UnmarshalBinary(b[:n]); err != nil {
-				panicf("failed to unmarshal request packet from %v: %v", addr, err)
-			}
+	sent := make(chan struct{})
+	send := func(_ *net.UDPConn, _ []byte, addr *net.UDPAddr) error {
+		mu.Lock()
+		defer mu.Unlock()
 
-			for i := 0; i < devices; i++ {
-				handleRequest(c, addr, reqp, handle)
-			}
+		addrs = append(addrs, addr.String())
+		if len(addrs) == 2 {
+			close(sent)
 		}
-	}()
 
-	// Look for any device type with any ID, but use the predefined
-	// constants for the local UDP listener and UDP multicast group.
+		return nil
+	}
+
 	d, err := NewDiscoverer(
-		discoverLocalUDPAddr("udp", localAddr),
-		discoverMulticastUDPAddr("udp", multicastAddr),
+		discoverLocalUDPAddr("udp", testLocalAddr),
+		DiscoverPerInterfaceDelay(delay),
+		discoverSend(send),
 	)
 	if err != nil {
 		t.Fatalf("failed to start discovery: %v", err)
 	}
+	defer d.c.Close()
 
-	return d, func() {
-		// Although the tests may have already closed the discovery listener
-		// due to a context timeout or cancelation, we ensure the listener
-		// is closed to avoid any potential file descriptor leaks.
-		_ = d.c.Close()
+	// Only the first request is sent before Discover is called.
+	mu.Lock()
+	if diff := cmp.Diff([]string{"192.0.2.255:65001"}, addrs); diff != "" {
+		t.Fatalf("unexpected initial requests (-want +got):\n%s", diff)
+	}
+	mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stop discovery once the deferred request has been sent.
+	go func() {
+		<-sent
+		cancel()
+	}()
+
+	if _, err := d.Discover(ctx); err != io.EOF {
+		t.Fatalf("expected io.EOF, but got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff([]string{"192.0.2.255:65001", "198.51.100.255:65001"}, addrs); diff != "" {
+		t.Fatalf("unexpected requests (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]time.Duration{delay}, waits); diff != "" {
+		t.Fatalf("unexpected waits between requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiscoverPerInterfaceDelayCanceled(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	ifaces := []ifaceAddrs{
+		{
+			Name:  "eth0",
+			Flags: net.FlagUp | net.FlagBroadcast,
+			Addrs: []net.Addr{&net.IPNet{
+				IP:   net.IPv4(192, 0, 2, 10),
+				Mask: net.CIDRMask(24, 32),
+			}},
+		},
+		{
+			Name:  "eth1",
+			Flags: net.FlagUp | net.FlagBroadcast,
+			Addrs: []net.Addr{&net.IPNet{
+				IP:   net.IPv4(198, 51, 100, 10),
+				Mask: net.CIDRMask(24, 32),
+			}},
+		},
+	}
+
+	list := listInterfaces
+	listInterfaces = func() ([]ifaceAddrs, error) {
+		return ifaces, nil
+	}
+	defer func() { listInterfaces = list }()
+
+	var n int32
+	send := func(_ *net.UDPConn, _ []byte, _ *net.UDPAddr) error {
+		atomic.AddInt32(&n, 1)
+		return nil
+	}
+
+	// A delay so long that the deferred request is never sent. Neither
+	// NewDiscoverer nor Discover may block for it.
+	d, err := NewDiscoverer(
+		discoverLocalUDPAddr("udp", testLocalAddr),
+		DiscoverPerInterfaceDelay(time.Hour),
+		discoverSend(send),
+	)
+	if err != nil {
+		t.Fatalf("failed to start discovery: %v", err)
+	}
+	defer d.c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := d.Discover(ctx); err != io.EOF {
+		t.Fatalf("expected io.EOF, but got: %v", err)
+	}
+
+	if diff := cmp.Diff(int32(1), atomic.LoadInt32(&n)); diff != "" {
+		t.Fatalf("unexpected number of requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiscoverSubnets(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	var (
+		a = &DiscoveredDevice{ID: "0000000a", Type: DeviceTypeTuner}
+		b = &DiscoveredDevice{ID: "0000000b", Type: DeviceTypeTuner}
+	)
+
+	// Each subnet has a responder standing in for its broadcast address.
+	// Device a is reachable on both subnets.
+	subnets := []struct {
+		ipn     *net.IPNet
+		devices []*DiscoveredDevice
+	}{
+		{
+			ipn: &net.IPNet{
+				IP:   net.IPv4(192, 0, 2, 0),
+				Mask: net.CIDRMask(24, 32),
+			},
+			devices: []*DiscoveredDevice{a},
+		},
+		{
+			ipn: &net.IPNet{
+				IP:   net.IPv4(198, 51, 100, 0),
+				Mask: net.CIDRMask(24, 32),
+			},
+			devices: []*DiscoveredDevice{a, b},
+		},
+	}
+
+	var (
+		wg    sync.WaitGroup
+		ipns  []*net.IPNet
+		addrs = make(map[string][]string)
+
+		// Broadcast addresses and the responders which stand in for them.
+		responders = make(map[string]*net.UDPAddr)
+	)
+
+	for _, s := range subnets {
+		c, err := net.ListenPacket("udp", testLocalAddr)
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer c.Close()
+
+		ipns = append(ipns, s.ipn)
+		responders[broadcastAddr(s.ipn).String()] = c.LocalAddr().(*net.UDPAddr)
+
+		for _, d := range s.devices {
+			addrs[d.ID] = append(addrs[d.ID], c.LocalAddr().String())
+		}
+
+		wg.Add(1)
+		go func(c net.PacketConn, devices []*DiscoveredDevice) {
+			defer wg.Done()
+
+			b := make([]byte, 2048)
+			_, addr, err := c.ReadFrom(b)
+			if err != nil {
+				panicf("failed to read: %v", err)
+			}
+
+			for _, d := range devices {
+				handleRequest(c, addr, Packet{}, func(_ *Packet) (*Packet, error) {
+					return testDiscoverReply(d), nil
+				})
+			}
+		}(c, s.devices)
+	}
+
+	// Redirect each broadcast to its responder.
+	send := func(c *net.UDPConn, b []byte, addr *net.UDPAddr) error {
+		r, ok := responders[addr.IP.String()]
+		if !ok {
+			panicf("unexpected discovery request to %s", addr)
+		}
+
+		_, err := c.WriteToUDP(b, r)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	devices, err := DiscoverSubnets(ctx, ipns,
+		discoverLocalUDPAddr("udp", testLocalAddr),
+		discoverSend(send),
+	)
+	if err != nil {
+		t.Fatalf("failed to discover subnets: %v", err)
+	}
+
+	wg.Wait()
+
+	got := make(map[string][]string)
+	for _, d := range devices {
+		sort.Strings(d.Addrs)
+		got[d.ID] = d.Addrs
+	}
+
+	for _, as := range addrs {
+		sort.Strings(as)
+	}
+
+	if diff := cmp.Diff(addrs, got); diff != "" {
+		t.Fatalf("unexpected device addresses (-want +got):\n%s", diff)
+	}
+}
+
+func Test_interfaceBroadcasts(t *testing.T) {
+	ifaces := []ifaceAddrs{
+		{
+			// Loopback, so it should be skipped.
+			Name:  "lo",
+			Flags: net.FlagUp | net.FlagLoopback,
+			Addrs: []net.Addr{
+				&net.IPNet{
+					IP:   net.IPv4(127, 0, 0, 1),
+					Mask: net.CIDRMask(8, 32),
+				},
+			},
+		},
+		{
+			Name:  "eth0",
+			Flags: net.FlagUp | net.FlagBroadcast,
+			Addrs: []net.Addr{
+				&net.IPNet{
+					IP:   net.IPv4(192, 168, 1, 10),
+					Mask: net.CIDRMask(24, 32),
+				},
+				// Same subnet, so it should be skipped.
+				&net.IPNet{
+					IP:   net.IPv4(192, 168, 1, 11),
+					Mask: net.CIDRMask(24, 32),
+				},
+				// IPv6 has no broadcast, so it should be skipped.
+				&net.IPNet{
+					IP:   net.ParseIP("fe80::1"),
+					Mask: net.CIDRMask(64, 128),
+				},
+			},
+		},
+		{
+			Name:  "eth1",
+			Flags: net.FlagUp | net.FlagBroadcast,
+			Addrs: []net.Addr{
+				// Not a subnet, so it should be skipped.
+				&net.IPAddr{
+					IP: net.IPv4(10, 0, 0, 10),
+				},
+				&net.IPNet{
+					IP:   net.IPv4(10, 0, 0, 10),
+					Mask: net.CIDRMask(8, 32),
+				},
+			},
+		},
+		{
+			// Down, so it should be skipped.
+			Name:  "eth2",
+			Flags: net.FlagBroadcast,
+			Addrs: []net.Addr{
+				&net.IPNet{
+					IP:   net.IPv4(172, 16, 0, 10),
+					Mask: net.CIDRMask(16, 32),
+				},
+			},
+		},
+	}
+
+	list := listInterfaces
+	listInterfaces = func() ([]ifaceAddrs, error) {
+		return ifaces, nil
+	}
+	defer func() { listInterfaces = list }()
+
+	addrs, err := interfaceBroadcasts(65001)
+	if err != nil {
+		t.Fatalf("failed to get broadcast addresses: %v", err)
+	}
+
+	var got []string
+	for _, a := range addrs {
+		got = append(got, a.String())
+	}
+
+	want := []string{"192.168.1.255:65001", "10.255.255.255:65001"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected broadcast addresses (-want +got):\n%s", diff)
+	}
+}
+
+func Test_localRoute(t *testing.T) {
+	ifaces := []ifaceAddrs{
+		{
+			Name: "eth0",
+			Addrs: []net.Addr{
+				&net.IPNet{
+					IP:   net.IPv4(192, 168, 1, 10),
+					Mask: net.CIDRMask(24, 32),
+				},
+			},
+		},
+		{
+			Name: "eth1",
+			Addrs: []net.Addr{
+				// Not a subnet, so it should be skipped.
+				&net.IPAddr{
+					IP: net.IPv4(10, 0, 0, 10),
+				},
+				&net.IPNet{
+					IP:   net.IPv4(10, 0, 0, 10),
+					Mask: net.CIDRMask(8, 32),
+				},
+			},
+		},
+	}
+
+	list := listInterfaces
+	listInterfaces = func() ([]ifaceAddrs, error) {
+		return ifaces, nil
+	}
+	defer func() { listInterfaces = list }()
+
+	tests := []struct {
+		name  string
+		ip    net.IP
+		local net.IP
+		iface string
+	}{
+		{
+			name: "no route",
+			ip:   net.IPv4(172, 16, 0, 1),
+		},
+		{
+			name:  "eth0",
+			ip:    net.IPv4(192, 168, 1, 20),
+			local: net.IPv4(192, 168, 1, 10),
+			iface: "eth0",
+		},
+		{
+			name:  "eth1",
+			ip:    net.IPv4(10, 1, 2, 3),
+			local: net.IPv4(10, 0, 0, 10),
+			iface: "eth1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, iface := localRoute(tt.ip)
+
+			if diff := cmp.Diff(tt.local, local); diff != "" {
+				t.Fatalf("unexpected local IP (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.iface, iface); diff != "" {
+				t.Fatalf("unexpected interface (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiscoveredDeviceTunerCount(t *testing.T) {
+	// A discover reply which lacks a tuner count tag.
+	device, err := newDiscoveredDevice("127.0.0.1:65001", Packet{
+		Type: libhdhomerun.TypeDiscoverRpy,
+		Tags: []Tag{
+			{
+				Type: libhdhomerun.TagDeviceType,
+				Data: []byte{0x00, 0x00, 0x00, 0x01},
+			},
+			{
+				Type: libhdhomerun.TagDeviceId,
+				Data: []byte{0xde, 0xad, 0xbe, 0xef},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to parse discover reply: %v", err)
+	}
+
+	// The device reports its tuner count as an ASCII string.
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		if diff := cmp.Diff("/tuner/count", bytesStr(req.Tags[0].Data)); diff != "" {
+			return nil, fmt.Errorf("unexpected query (-want +got):\n%s", diff)
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				req.Tags[0],
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("4"),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	n, err := device.TunerCount(c)
+	if err != nil {
+		t.Fatalf("failed to get tuner count: %v", err)
+	}
+
+	if diff := cmp.Diff(4, n); diff != "" {
+		t.Fatalf("unexpected tuner count (-want +got):\n%s", diff)
+	}
+
+	// Without a Client or an address, the count cannot be queried.
+	device.Addr = ""
+	if _, err := device.TunerCount(nil); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	// Without a Client, the device is dialed at its address.
+	addr, wait := testDevice(t, func(req *Packet) (*Packet, error) {
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				req.Tags[0],
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("3"),
+				},
+			},
+		}, nil
+	})
+	defer wait()
+
+	device.Addr = addr
+
+	n, err = device.TunerCount(nil)
+	if err != nil {
+		t.Fatalf("failed to get tuner count: %v", err)
+	}
+
+	if diff := cmp.Diff(3, n); diff != "" {
+		t.Fatalf("unexpected tuner count (-want +got):\n%s", diff)
+	}
+
+	// When the discover reply includes a tuner count, no query is needed.
+	device.Tuners = 2
+
+	n, err = device.TunerCount(nil)
+	if err != nil {
+		t.Fatalf("failed to get tuner count: %v", err)
+	}
+
+	if diff := cmp.Diff(2, n); diff != "" {
+		t.Fatalf("unexpected tuner count (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiscoveredDevicePing(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	d, done := testResponder(t, []*DiscoveredDevice{
+		{
+			ID:   "deadbeef",
+			Type: DeviceTypeTuner,
+		},
+		{
+			ID:   "01234567",
+			Type: DeviceTypeStorage,
+		},
+	})
+	defer done()
+	_ = d.c.Close()
+
+	tests := []struct {
+		name string
+		id   string
+		err  error
+	}{
+		{
+			name: "online",
+			id:   "deadbeef",
+		},
+		{
+			name: "online uppercase",
+			id:   "DEADBEEF",
+		},
+		{
+			name: "offline",
+			id:   "89abcdef",
+			err:  ErrPingTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			device := &DiscoveredDevice{
+				ID:        tt.id,
+				Addr:      testMulticastAddr,
+				LocalAddr: net.IPv4(127, 0, 0, 1),
+			}
+
+			if err := device.Ping(ctx); err != tt.err {
+				t.Fatalf("unexpected ping error: want %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestForEachDevice(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	const concurrency = 2
+
+	// A device which is no longer listening, so dialing fails.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to start TCP listener: %v", err)
+	}
+	_ = l.Close()
+
+	devices := []*DiscoveredDevice{{
+		ID:   "00000000",
+		Addr: l.Addr().String(),
+	}}
+
+	for i := 1; i < 5; i++ {
+		addr, done := testDevice(t, echoQuery)
+		// Each device only exits once its connection is closed.
+		defer done()
+
+		devices = append(devices, &DiscoveredDevice{
+			ID:   fmt.Sprintf("%08x", i),
+			Addr: addr,
+		})
+	}
+
+	var (
+		mu         sync.Mutex
+		active, nn int
+	)
+
+	err = ForEachDevice(context.Background(), devices, concurrency, func(_ context.Context, c *Client) error {
+		mu.Lock()
+		active++
+		if active > nn {
+			nn = active
+		}
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			defer mu.Unlock()
+			active--
+		}()
+
+		// Give other workers a chance to run concurrently.
+		time.Sleep(10 * time.Millisecond)
+
+		b, err := c.Query("/test")
+		if err != nil {
+			return err
+		}
+
+		// The second device fails.
+		if c.c.RemoteAddr().String() == devices[2].Addr {
+			return fmt.Errorf("bad value: %q", b)
+		}
+
+		return nil
+	})
+
+	errs, ok := err.(DeviceErrors)
+	if !ok {
+		t.Fatalf("expected DeviceErrors, but got: %#v", err)
+	}
+
+	var ids []string
+	for _, err := range errs {
+		ids = append(ids, err.ID)
+	}
+	sort.Strings(ids)
+
+	if diff := cmp.Diff([]string{"00000000", "00000002"}, ids); diff != "" {
+		t.Fatalf("unexpected failed device IDs (-want +got):\n%s", diff)
+	}
+
+	if nn > concurrency {
+		t.Fatalf("too many concurrent devices: %d > %d", nn, concurrency)
+	}
+}
+
+func TestForEachDeviceDuplicates(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	var devices []*DiscoveredDevice
+	for i := 0; i < 2; i++ {
+		addr, done := testDevice(t, echoQuery)
+		defer done()
+
+		d := &DiscoveredDevice{
+			ID:   fmt.Sprintf("%08x", i),
+			Addr: addr,
+		}
+
+		// Each device appears three times.
+		devices = append(devices, d, d, d)
+	}
+
+	var (
+		mu      sync.Mutex
+		active  = make(map[string]int)
+		calls   = make(map[string]int)
+		clients = make(map[string]map[*Client]bool)
+		overlap bool
+	)
+
+	err := ForEachDevice(context.Background(), devices, len(devices), func(_ context.Context, c *Client) error {
+		addr := c.c.RemoteAddr().String()
+
+		mu.Lock()
+		active[addr]++
+		calls[addr]++
+		if active[addr] > 1 {
+			overlap = true
+		}
+		if clients[addr] == nil {
+			clients[addr] = make(map[*Client]bool)
+		}
+		clients[addr][c] = true
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			defer mu.Unlock()
+			active[addr]--
+		}()
+
+		// Give other workers a chance to run concurrently.
+		time.Sleep(10 * time.Millisecond)
+
+		_, err := c.Query("/test")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to process devices: %v", err)
+	}
+
+	if overlap {
+		t.Fatal("operations on the same device ran concurrently")
+	}
+
+	for addr, n := range calls {
+		if diff := cmp.Diff(3, n); diff != "" {
+			t.Fatalf("unexpected number of calls for %s (-want +got):\n%s", addr, diff)
+		}
+
+		if diff := cmp.Diff(1, len(clients[addr])); diff != "" {
+			t.Fatalf("unexpected number of connections for %s (-want +got):\n%s", addr, diff)
+		}
+	}
+
+	if diff := cmp.Diff(2, len(calls)); diff != "" {
+		t.Fatalf("unexpected number of devices (-want +got):\n%s", diff)
+	}
+}
+
+func TestForEachDeviceNoID(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	// Devices added by address have no ID, but are still distinct devices.
+	var devices []*DiscoveredDevice
+	for i := 0; i < 2; i++ {
+		addr, done := testDevice(t, echoQuery)
+		defer done()
+
+		devices = append(devices, &DiscoveredDevice{Addr: addr})
+	}
+
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]int)
+	)
+
+	err := ForEachDevice(context.Background(), devices, len(devices), func(_ context.Context, c *Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls[c.c.RemoteAddr().String()]++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to process devices: %v", err)
+	}
+
+	want := map[string]int{
+		devices[0].Addr: 1,
+		devices[1].Addr: 1,
+	}
+
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Fatalf("unexpected calls per device (-want +got):\n%s", diff)
+	}
+}
+
+func TestForEachDeviceContextCanceled(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	addr, done := testDevice(t, echoQuery)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	devices := []*DiscoveredDevice{{
+		ID:   "deadbeef",
+		Addr: addr,
+	}}
+
+	err := ForEachDevice(ctx, devices, 1, func(_ context.Context, _ *Client) error {
+		panic("should not be called")
+	})
+
+	errs, ok := err.(DeviceErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("expected one DeviceError, but got: %#v", err)
+	}
+
+	want := &DeviceError{
+		ID:   "deadbeef",
+		Addr: addr,
+		Err:  context.Canceled,
+	}
+
+	if diff := cmp.Diff(want.Error(), errs[0].Error()); diff != "" {
+		t.Fatalf("unexpected error (-want +got):\n%s", diff)
+	}
+
+	if err := ForEachDevice(ctx, nil, 0, nil); err == nil {
+		t.Fatal("expected an error for zero concurrency, but none occurred")
+	}
+}
+
+func TestDiscoveredDeviceMarshalUnmarshalBinary(t *testing.T) {
+	u, err := url.Parse("http://192.0.2.100:80")
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		d    *DiscoveredDevice
+	}{
+		{
+			name: "minimal",
+			d: &DiscoveredDevice{
+				ID:   "1040a2b3",
+				Type: DeviceTypeStorage,
+			},
+		},
+		{
+			name: "full",
+			d: &DiscoveredDevice{
+				ID:      "1040a2b3",
+				Addr:    "192.0.2.100:65001",
+				Type:    DeviceTypeTuner,
+				URL:     u,
+				Tuners:  4,
+				AuthStr: "cD6bm1_3aR3dXlPq",
+			},
+		},
+		{
+			name: "storage",
+			d: &DiscoveredDevice{
+				StorageID: "1234ABCD-0000-0000-0000-000000000000",
+				Addr:      "192.0.2.101:65001",
+				Type:      DeviceTypeStorage,
+				URL:       u,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.d.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal device: %v", err)
+			}
+
+			if diff := cmp.Diff(byte(deviceBinaryVersion), b[0]); diff != "" {
+				t.Fatalf("unexpected version (-want +got):\n%s", diff)
+			}
+
+			var got DiscoveredDevice
+			if err := got.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal device: %v", err)
+			}
+
+			// Only the stored fields are compared.
+			got.RawTags = nil
+			if tt.d.Addr != "" {
+				if diff := cmp.Diff([]string{tt.d.Addr}, got.Addrs); diff != "" {
+					t.Fatalf("unexpected addresses (-want +got):\n%s", diff)
+				}
+				got.Addrs = nil
+			}
+
+			if diff := cmp.Diff(tt.d, &got); diff != "" {
+				t.Fatalf("unexpected device (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiscoveredDeviceUnmarshalBinaryError(t *testing.T) {
+	good, err := (&DiscoveredDevice{
+		ID:   "1040a2b3",
+		Type: DeviceTypeTuner,
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal device: %v", err)
+	}
+
+	badVersion := append([]byte{deviceBinaryVersion + 1}, good[1:]...)
+
+	badCRC := append([]byte(nil), good...)
+	badCRC[len(badCRC)-1]++
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{name: "empty"},
+		{name: "version only", b: good[:1]},
+		{name: "future version", b: badVersion},
+		{name: "checksum", b: badCRC},
+		{name: "truncated", b: good[:len(good)-1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := new(DiscoveredDevice).UnmarshalBinary(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+
+	if _, err := (&DiscoveredDevice{ID: "bogus"}).MarshalBinary(); err == nil {
+		t.Fatal("expected an error for a bad device ID, but none occurred")
+	}
+
+	// A storage ID is not a device ID, so it must not be stored as one.
+	if _, err := (&DiscoveredDevice{ID: "1234ABCD-0000-0000-0000-000000000000"}).MarshalBinary(); err == nil {
+		t.Fatal("expected an error for a storage ID as device ID, but none occurred")
+	}
+
+	if _, err := (&DiscoveredDevice{Type: DeviceTypeTuner}).MarshalBinary(); err == nil {
+		t.Fatal("expected an error for a device without an ID, but none occurred")
+	}
+}
+
+func TestMergeDevices(t *testing.T) {
+	var (
+		a1 = &DiscoveredDevice{
+			ID:     "deadbeef",
+			Addr:   "192.168.1.10:65001",
+			Addrs:  []string{"192.168.1.10:65001"},
+			Type:   DeviceTypeTuner,
+			Tuners: 2,
+		}
+		b = &DiscoveredDevice{
+			ID:    "01234567",
+			Addr:  "192.168.1.11:65001",
+			Addrs: []string{"192.168.1.11:65001"},
+			Type:  DeviceTypeStorage,
+		}
+		a2 = &DiscoveredDevice{
+			ID:     "deadbeef",
+			Addr:   "10.0.0.10:65001",
+			Addrs:  []string{"10.0.0.10:65001"},
+			Type:   DeviceTypeTuner,
+			Tuners: 2,
+		}
+	)
+
+	// Same device from two different addresses, with one address repeated.
+	got := MergeDevices([]*DiscoveredDevice{a1, b, a2, a1})
+
+	want := []*DiscoveredDevice{
+		{
+			ID:   "deadbeef",
+			Addr: "192.168.1.10:65001",
+			Addrs: []string{
+				"192.168.1.10:65001",
+				"10.0.0.10:65001",
+			},
+			Type:   DeviceTypeTuner,
+			Tuners: 2,
+		},
+		b,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected merged devices (-want +got):\n%s", diff)
+	}
+
+	// Inputs must not be modified.
+	if diff := cmp.Diff([]string{"192.168.1.10:65001"}, a1.Addrs); diff != "" {
+		t.Fatalf("input device was modified (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiscoveredDeviceKey(t *testing.T) {
+	u, err := url.Parse("http://192.168.1.10:80")
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+
+	var (
+		lan = &DiscoveredDevice{
+			ID:    "1234abcd",
+			Addr:  "192.168.1.10:65001",
+			Addrs: []string{"192.168.1.10:65001"},
+			Type:  DeviceTypeTuner,
+		}
+		// The cloud API reports device IDs in upper case, and may omit the
+		// local address.
+		cloud = &DiscoveredDevice{
+			ID:   "1234ABCD",
+			Type: DeviceTypeTuner,
+			URL:  u,
+		}
+		noID = &DiscoveredDevice{
+			URL: u,
+		}
+		storage = &DiscoveredDevice{
+			StorageID: "1234ABCD-0000-0000-0000-000000000000",
+			URL:       u,
+		}
+	)
+
+	if diff := cmp.Diff("storage:1234abcd-0000-0000-0000-000000000000", storage.Key()); diff != "" {
+		t.Fatalf("unexpected storage key (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(lan.Key(), cloud.Key()); diff != "" {
+		t.Fatalf("LAN and cloud keys differ (-lan +cloud):\n%s", diff)
+	}
+
+	if lan.Key() == noID.Key() {
+		t.Fatalf("device without ID must not share key %q with an ID", lan.Key())
+	}
+
+	// The LAN and cloud devices merge into one, adopting the local address.
+	got := MergeDevices([]*DiscoveredDevice{cloud, lan})
+
+	want := []*DiscoveredDevice{{
+		ID:    "1234ABCD",
+		Addr:  "192.168.1.10:65001",
+		Addrs: []string{"192.168.1.10:65001"},
+		Type:  DeviceTypeTuner,
+		URL:   u,
+	}}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected merged devices (-want +got):\n%s", diff)
+	}
+}
+
+func Test_mustDiscoverPacketPadding(t *testing.T) {
+	id := []byte{0xff, 0xff, 0xff, 0xff}
+
+	for _, n := range []int{0, 20, 21, 22, 64, 150, 151, 152, 1460} {
+		t.Run(fmt.Sprintf("%d", n), func(t *testing.T) {
+			b := mustDiscoverPacket(DeviceTypeWildcard, id, n)
+
+			// Padding must meet the minimum size without overshooting it
+			// by more than a byte, which can occur when the padding tag's
+			// length requires an extra byte.
+			if len(b) < n || (n > 20 && len(b) > n+1) {
+				t.Fatalf("unexpected padded packet length for minimum %d: %d", n, len(b))
+			}
+
+			var p Packet
+			if err := p.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal padded packet: %v", err)
+			}
+
+			if diff := cmp.Diff(uint16(libhdhomerun.TypeDiscoverReq), p.Type); diff != "" {
+				t.Fatalf("unexpected packet type (-want +got):\n%s", diff)
+			}
+
+			// Only a padding tag may be added after the device type and ID.
+			switch len(p.Tags) {
+			case 2:
+				if n > 20 {
+					t.Fatal("expected a padding tag, but none was found")
+				}
+			case 3:
+				if diff := cmp.Diff(uint8(tagPadding), p.Tags[2].Type); diff != "" {
+					t.Fatalf("unexpected padding tag type (-want +got):\n%s", diff)
+				}
+			default:
+				t.Fatalf("unexpected number of tags: %d", len(p.Tags))
+			}
+		})
+	}
+}
+
+func TestDiscoverMinRequestSize(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		ok   bool
+	}{
+		{
+			name: "negative",
+			n:    -1,
+		},
+		{
+			name: "zero",
+			ok:   true,
+		},
+		{
+			name: "maximum",
+			n:    libhdhomerun.MaxPacketSize,
+			ok:   true,
+		},
+		{
+			name: "too large",
+			n:    libhdhomerun.MaxPacketSize + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDiscoverer(
+				discoverMulticastUDPAddr("udp", testMulticastAddr),
+				DiscoverMinRequestSize(tt.n),
+			)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+			defer d.c.Close()
+
+			if l := len(d.req); l < tt.n || l > libhdhomerun.MaxPacketSize {
+				t.Fatalf("unexpected request length for minimum %d: %d", tt.n, l)
+			}
+		})
+	}
+}
+
+func TestDiscoverLocalIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   net.IP
+		ok   bool
+	}{
+		{
+			name: "not local",
+			ip:   net.IPv4(192, 0, 2, 1),
+		},
+		{
+			name: "loopback",
+			ip:   net.IPv4(127, 0, 0, 1),
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDiscoverer(
+				discoverMulticastUDPAddr("udp", testMulticastAddr),
+				DiscoverLocalIP(tt.ip),
+			)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+			defer d.c.Close()
+
+			got := d.c.LocalAddr().(*net.UDPAddr).IP
+			if !tt.ip.Equal(got) {
+				t.Fatalf("unexpected local IP address: want %s, got %s", tt.ip, got)
+			}
+		})
+	}
+}
+
+func TestWaitForOnline(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	// Speed up discovery attempts for this test.
+	interval := waitForOnlineInterval
+	waitForOnlineInterval = 50 * time.Millisecond
+	defer func() { waitForOnlineInterval = interval }()
+
+	var i int
+	d, done := testListener(t, 1, func(req *Packet) (*Packet, error) {
+		// The device is offline for the testListener's own request and
+		// the first attempt by WaitForOnline.
+		i++
+		if i <= 2 {
+			return nil, errNoReply
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeDiscoverRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagDeviceType,
+					Data: []byte{0x00, 0x00, 0x00, 0x01},
+				},
+				{
+					Type: libhdhomerun.TagDeviceId,
+					Data: []byte{0xde, 0xad, 0xbe, 0xef},
+				},
+			},
+		}, nil
+	})
+	defer done()
+	_ = d.c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	device, err := WaitForOnline(ctx, testDiscovererOptions()...)
+	if err != nil {
+		t.Fatalf("failed to wait for device: %v", err)
+	}
+
+	if diff := cmp.Diff("deadbeef", device.ID); diff != "" {
+		t.Fatalf("unexpected device ID (-want +got):\n%s", diff)
+	}
+}
+
+func TestWaitForOnlineMinInterval(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	// Speed up discovery attempts for this test, so the minimum interval
+	// dominates the spacing between requests.
+	interval := waitForOnlineInterval
+	waitForOnlineInterval = 10 * time.Millisecond
+	defer func() { waitForOnlineInterval = interval }()
+
+	const minInterval = 100 * time.Millisecond
+
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+
+	stop := testServe(t, func(_ net.PacketConn, _ net.Addr, _ *Packet) {
+		// The device never replies.
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, time.Now())
+	})
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 450*time.Millisecond)
+	defer cancel()
+
+	options := append(testDiscovererOptions(), DiscoverMinInterval(minInterval))
+	if _, err := WaitForOnline(ctx, options...); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(times) < 2 {
+		t.Fatalf("expected at least 2 discovery requests, but got %d", len(times))
+	}
+
+	for i := 1; i < len(times); i++ {
+		// Allow a small margin for scheduling of the listener goroutine.
+		if d := times[i].Sub(times[i-1]); d < minInterval-10*time.Millisecond {
+			t.Fatalf("discovery requests %d and %d sent only %v apart", i-1, i, d)
+		}
+	}
+}
+
+func TestWaitForOnlineMinIntervalCanceled(t *testing.T) {
+	// Check for goroutine leaks.
+	defer leaktest.Check(t)()
+
+	interval := waitForOnlineInterval
+	waitForOnlineInterval = 10 * time.Millisecond
+	defer func() { waitForOnlineInterval = interval }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The gate must not delay cancelation, even with a very long interval.
+	start := time.Now()
+	options := append(testDiscovererOptions(), DiscoverMinInterval(time.Hour))
+	if _, err := WaitForOnline(ctx, options...); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("cancelation took too long: %v", d)
+	}
+}
+
+func TestWaitForOnlineContextTimeout(t *testing.T) {
+	d, done := testListener(t, 1, noReply)
+	defer done()
+	_ = d.c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := WaitForOnline(ctx, testDiscovererOptions()...); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+}
+
+// A handleFunc is a function which can be used to reply to a request
+// with testListener.
+type handleFunc func(req *Packet) (*Packet, error)
+
+// noReply is a handleFunc which returns no reply to a request.
+func noReply(req *Packet) (*Packet, error) {
+	// Return nothing.
+	return nil, errNoReply
+}
+
+const (
+	testLocalAddr = "127.0.0.1:0"
+	// TODO(mdlayher): use a different address?
+	testMulticastAddr = "224.0.0.1:65002"
+)
+
+// testDiscovererOptions returns DiscovererOptions which configure a
+// Discoverer to communicate with a testListener.
+func testDiscovererOptions() []DiscovererOption {
+	return []DiscovererOption{
+		discoverLocalUDPAddr("udp", testLocalAddr),
+		discoverMulticastUDPAddr("udp", testMulticastAddr),
+	}
+}
+
+// testListener creates a listener that emulates a HDHomeRun device, and
+// provides a Discoverer which can discover devices from it.  Invoke the
+// done closure to clean up resources.
+func testListener(t *testing.T, devices int, handle handleFunc) (*Discoverer, func()) {
+	stop := testServe(t, func(c net.PacketConn, addr net.Addr, req *Packet) {
+		for i := 0; i < devices; i++ {
+			handleRequest(c, addr, *req, handle)
+		}
+	})
+
+	// Look for any device type with any ID, but use the predefined
+	// constants for the local UDP listener and UDP multicast group.
+	d, err := NewDiscoverer(testDiscovererOptions()...)
+	if err != nil {
+		t.Fatalf("failed to start discovery: %v", err)
+	}
+
+	return d, func() {
+		// Although the tests may have already closed the discovery listener
+		// due to a context timeout or cancelation, we ensure the listener
+		// is closed to avoid any potential file descriptor leaks.
+		_ = d.c.Close()
+		stop()
+	}
+}
+
+// testResponder creates a listener that emulates one or more HDHomeRun
+// devices, each of which replies to discovery requests which match its
+// device type and ID. It provides a Discoverer configured with the input
+// options which can discover devices from it. Invoke the done closure to
+// clean up resources.
+func testResponder(t *testing.T, devices []*DiscoveredDevice, options ...DiscovererOption) (*Discoverer, func()) {
+	stop := testServe(t, func(c net.PacketConn, addr net.Addr, req *Packet) {
+		if req.Type != libhdhomerun.TypeDiscoverReq {
+			panicf("unexpected request packet type: %#x", req.Type)
+		}
+
+		// Determine which devices were requested.
+		var (
+			typ DeviceType
+			id  string
+		)
+
+		for _, tag := range req.Tags {
+			switch tag.Type {
+			case libhdhomerun.TagDeviceType:
+				typ = DeviceType(binary.BigEndian.Uint32(tag.Data))
+			case libhdhomerun.TagDeviceId:
+				id = hex.EncodeToString(tag.Data)
+			}
+		}
+
+		for _, d := range devices {
+			if typ != DeviceTypeWildcard && typ != d.Type {
+				continue
+			}
+			if id != DeviceIDWildcard && id != d.ID {
+				continue
+			}
+
+			handleRequest(c, addr, *req, func(_ *Packet) (*Packet, error) {
+				return testDiscoverReply(d), nil
+			})
+		}
+	})
+
+	d, err := NewDiscoverer(append(testDiscovererOptions(), options...)...)
+	if err != nil {
+		t.Fatalf("failed to start discovery: %v", err)
+	}
+
+	return d, func() {
+		_ = d.c.Close()
+		stop()
+	}
+}
+
+// testDiscoverReply creates a discover reply Packet for a device.
+func testDiscoverReply(d *DiscoveredDevice) *Packet {
+	id, err := ParseDeviceID(d.ID)
+	if err != nil {
+		panicf("failed to parse device ID: %v", err)
+	}
+
+	typ := make([]byte, 4)
+	binary.BigEndian.PutUint32(typ, uint32(d.Type))
+
+	p := &Packet{
+		Type: libhdhomerun.TypeDiscoverRpy,
+		Tags: []Tag{
+			{
+				Type: libhdhomerun.TagDeviceType,
+				Data: typ,
+			},
+			{
+				Type: libhdhomerun.TagDeviceId,
+				Data: id,
+			},
+		},
+	}
+
+	if d.URL != nil {
+		p.Tags = append(p.Tags, Tag{
+			Type: libhdhomerun.TagBaseUrl,
+			Data: []byte(d.URL.String()),
+		})
+	}
+
+	if d.Tuners > 0 {
+		p.Tags = append(p.Tags, Tag{
+			Type: libhdhomerun.TagTunerCount,
+			Data: []byte{byte(d.Tuners)},
+		})
+	}
+
+	return p
+}
+
+// testLoopback returns the name of the loopback network interface, which
+// varies by operating system.
+func testLoopback(t *testing.T) string {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		t.Fatalf("failed to list network interfaces: %v", err)
+	}
+
+	for _, ifi := range ifis {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			return ifi.Name
+		}
+	}
+
+	t.Fatal("no loopback network interface found")
+	return ""
+}
+
+// testServe listens for discovery requests on the test multicast group and
+// invokes fn for each request. Invoke the returned closure to stop listening
+// and clean up resources.
+func testServe(t *testing.T, fn func(c net.PacketConn, addr net.Addr, req *Packet)) func() {
+	multicastUDPAddr, err := net.ResolveUDPAddr("udp", testMulticastAddr)
+	if err != nil {
+		t.Fatalf("failed to resolve multicast UDP listener address: %v", err)
+	}
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Fatalf("failed to get loopback device: %v", err)
+	}
+
+	c, err := net.ListenMulticastUDP("udp", lo, multicastUDPAddr)
+	if err != nil {
+		t.Fatalf("failed to open multicast listener: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		var reqp Packet
+		b := make([]byte, 2048)
+		for {
+			n, addr, err := c.ReadFrom(b)
+			if err != nil {
+				if strings.Contains(err.Error(), "use of closed network connection") {
+					return
+				}
+
+				panicf("failed to read: %v", err)
+			}
+
+			if err := reqp.UnmarshalBinary(b[:n]); err != nil {
+				panicf("failed to unmarshal request packet from %v: %v", addr, err)
+			}
+
+			fn(c, addr, &reqp)
+		}
+	}()
+
+	return func() {
 		_ = c.Close()
 		wg.Wait()
 	}
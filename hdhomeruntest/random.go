@@ -0,0 +1,65 @@
+// Package hdhomeruntest provides utilities for testing code which uses
+// package hdhomerun.
+package hdhomeruntest
+
+import (
+	"math/rand"
+
+	"github.com/joydip/hdhomerun"
+	"github.com/joydip/hdhomerun/internal/libhdhomerun"
+)
+
+const (
+	// maxTags is the maximum number of Tags carried by a random Packet.
+	maxTags = 16
+
+	// largeTagLength denotes when a tag's length must be encoded as two
+	// bytes instead of one.
+	largeTagLength = 128
+)
+
+// RandomPacket uses r to produce a random, valid Packet with a random type
+// and a random set of Tags, for use in property-based tests and as seed
+// inputs for fuzzing.
+//
+// Tags carry random data, and some are large enough to require a two byte
+// tag length. The Tags are limited so that the encoded Packet never exceeds
+// the maximum size of an HDHomeRun UDP packet. Zero-length Data is empty
+// rather than nil, and a Packet with no Tags has nil Tags, so the Packet is
+// identical to the result of unmarshaling its binary form.
+func RandomPacket(r *rand.Rand) *hdhomerun.Packet {
+	p := &hdhomerun.Packet{
+		Type: uint16(r.Intn(1 << 16)),
+	}
+
+	budget := libhdhomerun.MaxPayloadSize
+	for n := r.Intn(maxTags + 1); n > 0; n-- {
+		// Type and a one byte length.
+		overhead := 2
+
+		// About a quarter of the Tags are large, if there is room for
+		// at least one large Tag.
+		size := r.Intn(largeTagLength)
+		if r.Intn(4) == 0 && budget > largeTagLength+overhead+1 {
+			// Type and a two byte length.
+			overhead++
+			size = largeTagLength + r.Intn(budget-largeTagLength-overhead)
+		}
+
+		if size+overhead > budget {
+			// Out of room; the Packet is full.
+			break
+		}
+		budget -= size + overhead
+
+		data := make([]byte, size)
+		_, _ = r.Read(data)
+
+		p.Tags = append(p.Tags, hdhomerun.Tag{
+			Type: uint8(r.Intn(1 << 8)),
+			Data: data,
+		})
+	}
+
+	return p
+}
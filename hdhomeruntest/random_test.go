@@ -0,0 +1,107 @@
+package hdhomeruntest
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/joydip/hdhomerun"
+	"github.com/joydip/hdhomerun/internal/libhdhomerun"
+)
+
+func TestRandomPacketRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	var large bool
+	for i := 0; i < 1000; i++ {
+		want := RandomPacket(r)
+
+		for _, tag := range want.Tags {
+			if len(tag.Data) >= largeTagLength {
+				large = true
+			}
+		}
+
+		b, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal packet %d: %v", i, err)
+		}
+
+		if l := len(b); l > libhdhomerun.MaxPacketSize {
+			t.Fatalf("packet %d exceeds maximum size: %d bytes", i, l)
+		}
+
+		got := new(hdhomerun.Packet)
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatalf("failed to unmarshal packet %d: %v", i, err)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected packet %d (-want +got):\n%s", i, diff)
+		}
+	}
+
+	if !large {
+		t.Fatal("no large tags were generated")
+	}
+}
+
+func TestRandomPacketSeeds(t *testing.T) {
+	// Every seed must produce a valid Packet, including those which fill
+	// the Packet completely.
+	for seed := int64(0); seed < 5000; seed++ {
+		want := RandomPacket(rand.New(rand.NewSource(seed)))
+
+		b, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal packet with seed %d: %v", seed, err)
+		}
+
+		if l := len(b); l > libhdhomerun.MaxPacketSize {
+			t.Fatalf("packet with seed %d exceeds maximum size: %d bytes", seed, l)
+		}
+
+		got := new(hdhomerun.Packet)
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatalf("failed to unmarshal packet with seed %d: %v", seed, err)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected packet with seed %d (-want +got):\n%s", seed, diff)
+		}
+	}
+}
+
+func TestRandomPacketReader(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	// Concatenate many random packets into a single stream.
+	var (
+		buf  bytes.Buffer
+		want []*hdhomerun.Packet
+	)
+
+	for i := 0; i < 100; i++ {
+		p := RandomPacket(r)
+		want = append(want, p)
+
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal packet %d: %v", i, err)
+		}
+		buf.Write(b)
+	}
+
+	hr := hdhomerun.NewReader(&buf)
+	for i, w := range want {
+		p, err := hr.ReadPacket()
+		if err != nil {
+			t.Fatalf("failed to read packet %d: %v", i, err)
+		}
+
+		if diff := cmp.Diff(w, p); diff != "" {
+			t.Fatalf("unexpected packet %d (-want +got):\n%s", i, diff)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package hdhomerun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// getJSON performs an HTTP GET request for the URL u, and decodes its JSON
+// response body into v. If c is nil, http.DefaultClient is used.
+func getJSON(ctx context.Context, c *http.Client, u string, v interface{}) error {
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status from %s: %s", u, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// errHTTPNotSupported is returned by post when a device does not support the
+// requested HTTP endpoint.
+var errHTTPNotSupported = errors.New("HTTP endpoint not supported by device")
+
+// post performs an HTTP POST request with no body for the URL u, and returns
+// the response body, which is limited to maxPostReply bytes. If c is nil,
+// http.DefaultClient is used. If the device reports that the endpoint does
+// not exist or is not implemented, errHTTPNotSupported is returned.
+func post(ctx context.Context, c *http.Client, u string) ([]byte, error) {
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxPostReply))
+	if err != nil {
+		return nil, err
+	}
+
+	// Drain any remaining body so the connection can be reused.
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return b, nil
+	case http.StatusNotFound, http.StatusNotImplemented:
+		return nil, errHTTPNotSupported
+	default:
+		return nil, fmt.Errorf("unexpected HTTP status from %s: %s", u, res.Status)
+	}
+}
+
+// maxPostReply is the maximum length of a POST reply body read by post.
+// Replies are short status messages, if the device sends one at all.
+const maxPostReply = 64 * 1024
@@ -0,0 +1,300 @@
+package hdhomerun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// A LineupEntry is a channel in a device's channel lineup, as reported by
+// its HTTP API.
+type LineupEntry struct {
+	// GuideNumber and GuideName identify the channel, such as "5.1" and
+	// "KTVX-HD".
+	GuideNumber string
+	GuideName   string
+
+	// URL is the URL of the channel's video stream.
+	URL string
+
+	// HD, Favorite, and DRM report whether the channel is high definition,
+	// is marked as a favorite, and is copy protected.
+	HD       bool
+	Favorite bool
+	DRM      bool
+}
+
+// Lineup retrieves the device's channel lineup. The device must have a URL.
+// If c is nil, http.DefaultClient is used.
+func (d *DiscoveredDevice) Lineup(ctx context.Context, c *http.Client) ([]LineupEntry, error) {
+	if d.URL == nil {
+		return nil, errors.New("device has no URL")
+	}
+
+	// The device reports booleans as integers.
+	var les []struct {
+		GuideNumber string
+		GuideName   string
+		URL         string
+		HD          int
+		Favorite    int
+		DRM         int
+	}
+
+	if err := getJSON(ctx, c, d.URL.String()+"/lineup.json", &les); err != nil {
+		return nil, err
+	}
+
+	lineup := make([]LineupEntry, 0, len(les))
+	for _, le := range les {
+		lineup = append(lineup, LineupEntry{
+			GuideNumber: le.GuideNumber,
+			GuideName:   le.GuideName,
+			URL:         le.URL,
+			HD:          le.HD != 0,
+			Favorite:    le.Favorite != 0,
+			DRM:         le.DRM != 0,
+		})
+	}
+
+	return lineup, nil
+}
+
+// lineupsConcurrency is the maximum number of lineups retrieved at once by
+// Lineups.
+const lineupsConcurrency = 4
+
+// Lineups retrieves the channel lineup of each of the input devices
+// concurrently, and returns the lineups keyed by DiscoveredDevice.Key.
+// Devices which are not tuners, or which have no URL, are skipped. If c is
+// nil, http.DefaultClient is used.
+//
+// An error from one device does not stop Lineups from retrieving the others.
+// If any errors occur, Lineups returns the lineups which were retrieved along
+// with DeviceErrors containing an error for each device which failed.
+func Lineups(ctx context.Context, c *http.Client, devices []*DiscoveredDevice) (map[string][]LineupEntry, error) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		lineups = make(map[string][]LineupEntry)
+		errs    DeviceErrors
+	)
+
+	sem := make(chan struct{}, lineupsConcurrency)
+	for _, d := range devices {
+		if d.Type != DeviceTypeTuner || d.URL == nil {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(d *DiscoveredDevice) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			lineup, err := d.Lineup(ctx, c)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, &DeviceError{
+					ID:   d.ID,
+					Addr: d.Addr,
+					Err:  err,
+				})
+				return
+			}
+
+			lineups[d.Key()] = lineup
+		}(d)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return lineups, errs
+	}
+
+	return lineups, nil
+}
+
+// DiscoverLineups discovers devices for the duration of window, and then
+// retrieves the channel lineup of each tuner device found using Lineups.
+// The DiscovererOptions are applied to discovery. If c is nil,
+// http.DefaultClient is used.
+//
+// As with Lineups, errors from individual devices are returned as
+// DeviceErrors alongside the lineups which were retrieved.
+func DiscoverLineups(ctx context.Context, c *http.Client, window time.Duration, options ...DiscovererOption) (map[string][]LineupEntry, error) {
+	d, err := NewDiscoverer(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	dctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	var devices []*DiscoveredDevice
+	for {
+		device, err := d.Discover(dctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, device)
+	}
+
+	// Discovery ends when the window elapses, but the caller may also have
+	// canceled the parent context.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return Lineups(ctx, c, MergeDevices(devices))
+}
+
+// SetFavorite marks or unmarks the channel with the specified guide number,
+// such as "5.1", as a favorite in the device's channel lineup. The device must
+// have a URL. If c is nil, http.DefaultClient is used.
+//
+// Not all devices support editing their channel lineup; if the device does
+// not, an error is returned. An error is also returned if the device replies
+// with an error message, or with a reply which cannot be decoded.
+func (d *DiscoveredDevice) SetFavorite(ctx context.Context, c *http.Client, guideNumber string, favorite bool) error {
+	if guideNumber == "" {
+		return errors.New("guide number must not be empty")
+	}
+
+	// The device adds or removes a favorite using a "+" or "-" prefix.
+	op := "-"
+	if favorite {
+		op = "+"
+	}
+
+	b, err := d.postLineup(ctx, c, url.Values{"favorite": []string{op + guideNumber}}, "lineup editing")
+	if err != nil {
+		return err
+	}
+
+	return parseLineupPostReply(b)
+}
+
+// parseLineupPostReply checks the reply body of a lineup.post request. Some
+// firmware sends no body on success, and others send a JSON object which
+// carries an Error message on failure.
+func parseLineupPostReply(b []byte) error {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil
+	}
+
+	var rep struct {
+		Error string
+	}
+	if err := json.Unmarshal(b, &rep); err != nil {
+		return fmt.Errorf("malformed lineup reply %q: %v", b, err)
+	}
+
+	if rep.Error != "" {
+		return fmt.Errorf("device rejected lineup change: %s", rep.Error)
+	}
+
+	return nil
+}
+
+// StartHTTPScan starts a channel scan using the device's HTTP API, rather
+// than the control protocol. The device must have a URL.
+// If c is nil, http.DefaultClient is used.
+//
+// The scan runs in the background on the device; use LineupStatus to monitor
+// its progress.
+func (d *DiscoveredDevice) StartHTTPScan(ctx context.Context, c *http.Client) error {
+	_, err := d.postLineup(ctx, c, url.Values{"scan": []string{"start"}}, "HTTP channel scans")
+	return err
+}
+
+// LineupStatus is the status of a device's channel lineup, as reported by its
+// HTTP API.
+type LineupStatus struct {
+	// ScanInProgress reports whether a channel scan is running. If so,
+	// Progress is the percentage of the scan which is complete, and Found
+	// is the number of channels found so far.
+	ScanInProgress bool
+	Progress       int
+	Found          int
+
+	// ScanPossible reports whether a channel scan can be started. It is only
+	// meaningful when no scan is in progress.
+	ScanPossible bool
+
+	// Source is the signal source which will be scanned, such as "Antenna"
+	// or "Cable", and SourceList contains all sources supported by the
+	// device.
+	Source     string
+	SourceList []string
+}
+
+// LineupStatus retrieves the status of the device's channel lineup, including
+// the progress of any channel scan. The device must have a URL. If c is nil,
+// http.DefaultClient is used.
+func (d *DiscoveredDevice) LineupStatus(ctx context.Context, c *http.Client) (*LineupStatus, error) {
+	if d.URL == nil {
+		return nil, errors.New("device has no URL")
+	}
+
+	// The device reports booleans as integers.
+	var ls struct {
+		ScanInProgress int
+		ScanPossible   int
+		Progress       int
+		Found          int
+		Source         string
+		SourceList     []string
+	}
+
+	if err := getJSON(ctx, c, d.URL.String()+"/lineup_status.json", &ls); err != nil {
+		return nil, err
+	}
+
+	return &LineupStatus{
+		ScanInProgress: ls.ScanInProgress != 0,
+		Progress:       ls.Progress,
+		Found:          ls.Found,
+		ScanPossible:   ls.ScanPossible != 0,
+		Source:         ls.Source,
+		SourceList:     ls.SourceList,
+	}, nil
+}
+
+// postLineup performs a POST to the device's lineup.post endpoint with the
+// query parameters q, and returns the reply body. feature describes the
+// operation in the error returned when the device does not support it.
+func (d *DiscoveredDevice) postLineup(ctx context.Context, c *http.Client, q url.Values, feature string) ([]byte, error) {
+	if d.URL == nil {
+		return nil, errors.New("device has no URL")
+	}
+
+	u := d.URL.String() + "/lineup.post?" + q.Encode()
+	b, err := post(ctx, c, u)
+	if err != nil {
+		if err == errHTTPNotSupported {
+			return nil, fmt.Errorf("device %s does not support %s", d.ID, feature)
+		}
+
+		return nil, err
+	}
+
+	return b, nil
+}
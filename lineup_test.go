@@ -0,0 +1,309 @@
+package hdhomerun
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiscoveredDeviceSetFavorite(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		favorite bool
+		query    string
+		ok       bool
+	}{
+		{
+			name:     "add",
+			status:   http.StatusOK,
+			favorite: true,
+			query:    "+5.1",
+			ok:       true,
+		},
+		{
+			name:   "remove",
+			status: http.StatusOK,
+			query:  "-5.1",
+			ok:     true,
+		},
+		{
+			name:     "JSON success",
+			status:   http.StatusOK,
+			body:     `{"GuideNumber":"5.1","Favorite":1}`,
+			favorite: true,
+			query:    "+5.1",
+			ok:       true,
+		},
+		{
+			name:     "rejected",
+			status:   http.StatusOK,
+			body:     `{"Error":"unknown channel"}`,
+			favorite: true,
+			query:    "+5.1",
+		},
+		{
+			name:     "malformed",
+			status:   http.StatusOK,
+			body:     `<html>`,
+			favorite: true,
+			query:    "+5.1",
+		},
+		{
+			name:     "not supported",
+			status:   http.StatusNotFound,
+			favorite: true,
+			query:    "+5.1",
+		},
+		{
+			name:     "server error",
+			status:   http.StatusInternalServerError,
+			favorite: true,
+			query:    "+5.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if diff := cmp.Diff(http.MethodPost, r.Method); diff != "" {
+					panicf("unexpected HTTP method (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff("/lineup.post", r.URL.Path); diff != "" {
+					panicf("unexpected HTTP path (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.query, r.URL.Query().Get("favorite")); diff != "" {
+					panicf("unexpected favorite query (-want +got):\n%s", diff)
+				}
+
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			u, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatalf("failed to parse URL: %v", err)
+			}
+
+			d := &DiscoveredDevice{
+				ID:  "1040a2b3",
+				URL: u,
+			}
+
+			err = d.SetFavorite(context.Background(), srv.Client(), "5.1", tt.favorite)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestDiscoveredDeviceHTTPScan(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var scanning bool
+	mux.HandleFunc("/lineup.post", func(w http.ResponseWriter, r *http.Request) {
+		if diff := cmp.Diff("start", r.URL.Query().Get("scan")); diff != "" {
+			panicf("unexpected scan query (-want +got):\n%s", diff)
+		}
+
+		scanning = true
+	})
+
+	mux.HandleFunc("/lineup_status.json", func(w http.ResponseWriter, _ *http.Request) {
+		if !scanning {
+			_, _ = w.Write([]byte(`{"ScanInProgress":0,"ScanPossible":1,"Source":"Antenna","SourceList":["Antenna","Cable"]}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ScanInProgress":1,"Progress":45,"Found":12}`))
+	})
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+
+	d := &DiscoveredDevice{
+		ID:  "1040a2b3",
+		URL: u,
+	}
+
+	ctx := context.Background()
+	c := srv.Client()
+
+	status, err := d.LineupStatus(ctx, c)
+	if err != nil {
+		t.Fatalf("failed to get lineup status: %v", err)
+	}
+
+	want := &LineupStatus{
+		ScanPossible: true,
+		Source:       "Antenna",
+		SourceList:   []string{"Antenna", "Cable"},
+	}
+
+	if diff := cmp.Diff(want, status); diff != "" {
+		t.Fatalf("unexpected idle lineup status (-want +got):\n%s", diff)
+	}
+
+	if err := d.StartHTTPScan(ctx, c); err != nil {
+		t.Fatalf("failed to start scan: %v", err)
+	}
+
+	status, err = d.LineupStatus(ctx, c)
+	if err != nil {
+		t.Fatalf("failed to get lineup status: %v", err)
+	}
+
+	want = &LineupStatus{
+		ScanInProgress: true,
+		Progress:       45,
+		Found:          12,
+	}
+
+	if diff := cmp.Diff(want, status); diff != "" {
+		t.Fatalf("unexpected scanning lineup status (-want +got):\n%s", diff)
+	}
+}
+
+func TestLineups(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/a/lineup.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[
+			{"GuideNumber":"2.1","GuideName":"KCBS-HD","VideoCodec":"MPEG2","AudioCodec":"AC3","HD":1,"Favorite":1,"URL":"http://192.168.1.100:5004/auto/v2.1"},
+			{"GuideNumber":"2.2","GuideName":"StartTV","URL":"http://192.168.1.100:5004/auto/v2.2"}
+		]`))
+	})
+	mux.HandleFunc("/b/lineup.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[{"GuideNumber":"702","GuideName":"HBOHD","HD":1,"DRM":1,"URL":"http://192.168.1.101:5004/auto/v702"}]`))
+	})
+	mux.HandleFunc("/c/lineup.json", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	device := func(id, path string, typ DeviceType) *DiscoveredDevice {
+		u, err := url.Parse(srv.URL + path)
+		if err != nil {
+			t.Fatalf("failed to parse URL: %v", err)
+		}
+
+		return &DiscoveredDevice{
+			ID:   id,
+			Addr: "192.0.2.1:65001",
+			Type: typ,
+			URL:  u,
+		}
+	}
+
+	devices := []*DiscoveredDevice{
+		device("1040a2b3", "/a", DeviceTypeTuner),
+		device("1040a2b4", "/b", DeviceTypeTuner),
+		device("1040a2b5", "/c", DeviceTypeTuner),
+		// Skipped: not a tuner, and no URL.
+		device("2050c3d4", "/a", DeviceTypeStorage),
+		{ID: "1040a2b6", Type: DeviceTypeTuner},
+	}
+
+	lineups, err := Lineups(context.Background(), srv.Client(), devices)
+
+	want := map[string][]LineupEntry{
+		"1040a2b3": {
+			{
+				GuideNumber: "2.1",
+				GuideName:   "KCBS-HD",
+				URL:         "http://192.168.1.100:5004/auto/v2.1",
+				HD:          true,
+				Favorite:    true,
+			},
+			{
+				GuideNumber: "2.2",
+				GuideName:   "StartTV",
+				URL:         "http://192.168.1.100:5004/auto/v2.2",
+			},
+		},
+		"1040a2b4": {{
+			GuideNumber: "702",
+			GuideName:   "HBOHD",
+			URL:         "http://192.168.1.101:5004/auto/v702",
+			HD:          true,
+			DRM:         true,
+		}},
+	}
+
+	if diff := cmp.Diff(want, lineups); diff != "" {
+		t.Fatalf("unexpected lineups (-want +got):\n%s", diff)
+	}
+
+	// Only the failed device reports an error.
+	errs, ok := err.(DeviceErrors)
+	if !ok {
+		t.Fatalf("expected DeviceErrors, but got: %#v", err)
+	}
+
+	if diff := cmp.Diff(1, len(errs)); diff != "" {
+		t.Fatalf("unexpected number of errors (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff("1040a2b5", errs[0].ID); diff != "" {
+		t.Fatalf("unexpected device error ID (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiscoverLineups(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/lineup.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[{"GuideNumber":"5.1","GuideName":"KTVX-HD","HD":1,"URL":"http://192.168.1.100:5004/auto/v5.1"}]`))
+	})
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+
+	// The responder's own Discoverer is unused; DiscoverLineups performs
+	// discovery itself.
+	d, done := testResponder(t, []*DiscoveredDevice{{
+		ID:   "1040a2b3",
+		Type: DeviceTypeTuner,
+		URL:  u,
+	}})
+	defer done()
+	_ = d.c.Close()
+
+	lineups, err := DiscoverLineups(context.Background(), srv.Client(), 250*time.Millisecond, testDiscovererOptions()...)
+	if err != nil {
+		t.Fatalf("failed to discover lineups: %v", err)
+	}
+
+	want := map[string][]LineupEntry{
+		"1040a2b3": {{
+			GuideNumber: "5.1",
+			GuideName:   "KTVX-HD",
+			URL:         "http://192.168.1.100:5004/auto/v5.1",
+			HD:          true,
+		}},
+	}
+
+	if diff := cmp.Diff(want, lineups); diff != "" {
+		t.Fatalf("unexpected lineups (-want +got):\n%s", diff)
+	}
+}
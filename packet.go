@@ -2,17 +2,34 @@ package hdhomerun
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"hash/crc32"
 	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/joydip/hdhomerun/internal/libhdhomerun"
 )
 
 const (
 	// largeTagLength denotes when a tag's length must be encoded as two
 	// bytes instead of one.
 	largeTagLength = 128
+
+	// DefaultMaxTags is the maximum number of Tags a Packet may carry when it
+	// is unmarshaled. Real Packets carry only a handful of Tags, but a
+	// Packet of zero length Tags could otherwise declare tens of thousands.
+	DefaultMaxTags = 1024
 )
 
+// crcTable is the CRC32 table used to compute Packet checksums. All known
+// HDHomeRun devices use the IEEE polynomial.
+var crcTable = crc32.IEEETable
+
 var (
 	// errInvalidChecksum is returned when attempting to unmarshal a Packet
 	// with a bad checksum.
@@ -21,6 +38,27 @@ var (
 	// errTagLengthBuffer is returned when attempting to marshal or unmarshal
 	// a large tag length with a buffer that is not the right size.
 	errTagLengthBuffer = errors.New("large tag length buffer must be exactly two bytes")
+
+	// errNilPacket is returned when attempting to marshal or unmarshal
+	// a nil Packet.
+	errNilPacket = errors.New("cannot marshal or unmarshal nil Packet")
+
+	// errTagsTooLong is returned when a Packet's encoded Tags are too long
+	// for their length to be represented in its header.
+	errTagsTooLong = errors.New("packet tags exceed maximum length")
+
+	// errTooManyTags is returned when attempting to unmarshal a Packet
+	// which carries more Tags than permitted.
+	errTooManyTags = errors.New("packet carries too many tags")
+
+	// errPacketTooLarge is returned when attempting to unmarshal a Packet
+	// which is longer than a Decoder permits.
+	errPacketTooLarge = errors.New("packet exceeds maximum size")
+
+	// errUnexpectedReplyType is returned when a reply's type does not match
+	// the type of its request, such as a discover reply arriving in response
+	// to a get/set request.
+	errUnexpectedReplyType = errors.New("reply packet type does not match request")
 )
 
 // A Packet is a network packet used to communicate with HDHomeRun devices.
@@ -28,7 +66,10 @@ type Packet struct {
 	// Type specifies the type of message this Packet carries.
 	Type uint16
 
-	// Tags specifies zero or more tags containing optional attributes.
+	// Tags specifies zero or more tags containing optional attributes. Nil
+	// and empty Tags are encoded identically. A Packet with no tags is always
+	// decoded with nil Tags, even when decoding into a Packet which
+	// previously held Tags.
 	Tags []Tag
 }
 
@@ -37,28 +78,154 @@ type Tag struct {
 	// Type specifies the type of payload this Tag carries.
 	Type uint8
 
-	// Data is an arbitrary byte payload.
+	// Data is an arbitrary byte payload. A Tag may carry no payload, in which
+	// case it is encoded as its type followed by a zero length. Nil and empty
+	// Data are encoded identically, and are always decoded as empty, non-nil
+	// Data.
 	Data []byte
 }
 
+// NewPacket creates a Packet of the specified type with an empty Tags slice.
+// tagCap is a hint for the number of Tags which will be appended to the
+// Packet, and is used to size the Tags slice to avoid reallocation when
+// building a Packet one Tag at a time. A Packet may hold any number of Tags
+// regardless of tagCap.
+func NewPacket(typ uint16, tagCap int) *Packet {
+	if tagCap < 0 {
+		tagCap = 0
+	}
+
+	return &Packet{
+		Type: typ,
+		Tags: make([]Tag, 0, tagCap),
+	}
+}
+
 // MarshalBinary marshals a Packet into its binary form.
 func (p *Packet) MarshalBinary() ([]byte, error) {
+	if p == nil {
+		return nil, errNilPacket
+	}
+
 	// Allocate enough bytes all at once for the Packet.
-	var count int
-	for _, t := range p.Tags {
-		// Tag length may be 2 bytes for larger numbers.
-		tlen := 1
-		if len(t.Data) >= largeTagLength {
-			tlen = 2
-		}
+	//
+	// Counting the tag bytes up front costs an extra pass over the tags, but
+	// benchmarks show it is faster than a single pass which appends into a
+	// growable buffer: the append approach needs at least one extra allocation
+	// for even the smallest packets, and repeatedly grows and copies the buffer
+	// as the number of tags increases.
+	count, err := p.tagsLength()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 2+2+count+4)
 
-		count += 1 + tlen + len(t.Data)
+	if err := p.marshal(b, count); err != nil {
+		return nil, err
 	}
 
-	b := make([]byte, 2+2+count+4)
+	return b, nil
+}
+
+// MarshalBinaryTo marshals a Packet into its binary form in b, and returns
+// the number of bytes written. If b is too small to hold the Packet,
+// io.ErrShortBuffer is returned and b is not modified.
+//
+// MarshalBinaryTo is useful for callers which reuse a fixed size buffer, such
+// as one sized for a maximum length UDP datagram, to avoid allocations.
+func (p *Packet) MarshalBinaryTo(b []byte) (int, error) {
+	if p == nil {
+		return 0, errNilPacket
+	}
+
+	count, err := p.tagsLength()
+	if err != nil {
+		return 0, err
+	}
 
+	n := 2 + 2 + count + 4
+	if len(b) < n {
+		return 0, io.ErrShortBuffer
+	}
+
+	if err := p.marshal(b[:n], count); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// WriteToUDP marshals a Packet and sends it to addr using pc in a single
+// datagram, returning the number of bytes written. If the Packet exceeds the
+// maximum size of an HDHomeRun UDP packet, an error is returned and nothing
+// is sent.
+func (p *Packet) WriteToUDP(pc net.PacketConn, addr net.Addr) (int, error) {
+	var b [libhdhomerun.MaxPacketSize]byte
+	n, err := p.MarshalBinaryTo(b[:])
+	switch err {
+	case nil:
+	case io.ErrShortBuffer:
+		// MarshalBinaryTo has already checked the tags length.
+		count, _ := p.tagsLength()
+		return 0, fmt.Errorf("packet length %d exceeds maximum UDP packet size %d",
+			2+2+count+4, libhdhomerun.MaxPacketSize)
+	default:
+		return 0, err
+	}
+
+	return pc.WriteTo(b[:n], addr)
+}
+
+// MarshalHeader returns the 4 byte header of a Packet's binary form: its
+// type followed by the length of its encoded Tags, both big endian.
+//
+// MarshalHeader is useful for proxies which rewrite a Packet's type and
+// forward its raw tag bytes unmodified. The checksum covers the header, so it
+// must be recomputed after any change to the header bytes.
+//
+// An error is returned if the Packet is nil, or if its encoded Tags are too
+// long for their length to be represented in the header.
+func (p *Packet) MarshalHeader() ([4]byte, error) {
+	var b [4]byte
+	if p == nil {
+		return b, errNilPacket
+	}
+
+	count, err := p.tagsLength()
+	if err != nil {
+		return b, err
+	}
+
+	p.putHeader(b[:], count)
+	return b, nil
+}
+
+// putHeader writes the Packet's type and a tags length of count into b, which
+// must be at least 4 bytes in length.
+func (p *Packet) putHeader(b []byte, count int) {
 	binary.BigEndian.PutUint16(b[0:2], p.Type)
 	binary.BigEndian.PutUint16(b[2:4], uint16(count))
+}
+
+// tagsLength returns the number of bytes needed to encode the Packet's Tags.
+// An error is returned if the length cannot be represented in the header.
+func (p *Packet) tagsLength() (int, error) {
+	var count int
+	for _, t := range p.Tags {
+		count += tagLength(len(t.Data))
+	}
+
+	if count > math.MaxUint16 {
+		return 0, errTagsTooLong
+	}
+
+	return count, nil
+}
+
+// marshal marshals a Packet into b, which must be exactly the length of the
+// Packet with count bytes of tags.
+func (p *Packet) marshal(b []byte, count int) error {
+	p.putHeader(b, count)
 
 	i := 4
 	for _, t := range p.Tags {
@@ -67,76 +234,854 @@ func (p *Packet) MarshalBinary() ([]byte, error) {
 
 		n, err := writeTagLength(len(t.Data), b[i:i+2])
 		if err != nil {
-			return nil, err
+			return err
 		}
 		i += n
 
 		i += copy(b[i:], t.Data)
 	}
 
-	chk := crc32.ChecksumIEEE(b[0 : len(b)-4])
+	chk := checksum(b[0 : len(b)-4])
 	binary.LittleEndian.PutUint32(b[len(b)-4:], chk)
 
-	return b, nil
+	return nil
 }
 
 // UnmarshalBinary unmarshals a Packet from its binary form.
 func (p *Packet) UnmarshalBinary(b []byte) error {
+	if p == nil {
+		return errNilPacket
+	}
+
+	// Need enough data for type, tags length, and checksum.
+	if len(b) < 8 {
+		return io.ErrUnexpectedEOF
+	}
+
+	// Don't allow a misleading length value, minus length for
+	// type, tags length, and CRC checksum.
+	if packetLength(b) != len(b) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return p.unmarshal(b)
+}
+
+// UnmarshalBinaryStrict is like UnmarshalBinary, but it also returns an error
+// if the Packet's Type is not one defined by the HDHomeRun protocol.
+//
+// UnmarshalBinary is lenient about the Packet's Type so that it can
+// interoperate with future firmware, but applications which only expect
+// specific replies can use UnmarshalBinaryStrict to fail fast on unexpected
+// traffic.
+func (p *Packet) UnmarshalBinaryStrict(b []byte) error {
+	if err := p.UnmarshalBinary(b); err != nil {
+		return err
+	}
+
+	if !isKnownType(p.Type) {
+		return fmt.Errorf("unknown packet type: %#04x", p.Type)
+	}
+
+	return nil
+}
+
+// UnmarshalBinaryNoCRC is like UnmarshalBinary, but it does not verify the
+// Packet's checksum. The length of the Packet is still validated, and b must
+// still contain the 4 trailing checksum bytes, though their value is ignored.
+//
+// UnmarshalBinaryNoCRC is unsafe for use with live network traffic, because
+// corrupted Packets will be decoded without error. It is intended only for
+// debugging Packets captured by tools which strip or mangle the checksum.
+func (p *Packet) UnmarshalBinaryNoCRC(b []byte) error {
+	return (&Decoder{NoCRC: true}).decode(p, b)
+}
+
+// UnmarshalBinaryChecked is like UnmarshalBinaryNoCRC, but it also reports
+// whether the Packet's checksum is valid. The Packet is decoded even if its
+// checksum is invalid, which allows lenient applications to accept a Packet
+// while logging the corruption. The length of the Packet is still validated.
+func (p *Packet) UnmarshalBinaryChecked(b []byte) (crcOK bool, err error) {
+	if p == nil {
+		return false, errNilPacket
+	}
+
+	if len(b) < 8 || packetLength(b) != len(b) {
+		return false, io.ErrUnexpectedEOF
+	}
+
+	crcOK = VerifyChecksum(b) == nil
+	if err := p.decodeTags(b, false, DefaultMaxTags); err != nil {
+		return false, err
+	}
+
+	return crcOK, nil
+}
+
+// UnmarshalBinaryNoCopy is like UnmarshalBinary, but the Data of each of the
+// Packet's Tags refers directly to b rather than to a copy, which avoids an
+// allocation per Tag.
+//
+// The caller must not modify b while the Packet is in use, and must not
+// reuse b for other data, such as the next read from a network connection,
+// until the Packet is no longer needed.
+func (p *Packet) UnmarshalBinaryNoCopy(b []byte) error {
+	return (&Decoder{NoCopy: true}).decode(p, b)
+}
+
+// UnmarshalBinaryN unmarshals the first Packet from b, and returns the number
+// of bytes consumed by that Packet. Any trailing bytes in b are ignored, so
+// UnmarshalBinaryN can be used to decode several concatenated Packets by
+// advancing b by n after each call.
+func (p *Packet) UnmarshalBinaryN(b []byte) (n int, err error) {
+	if p == nil {
+		return 0, errNilPacket
+	}
+
 	// Need enough data for type, tags length, and checksum.
 	if len(b) < 8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	n = packetLength(b)
+	if n > len(b) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if err := p.unmarshal(b[:n]); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// A Decoder unmarshals Packets with configurable options. The zero value of
+// a Decoder is safe for use with live network traffic, and decodes Packets
+// in the same way as Packet.UnmarshalBinary.
+type Decoder struct {
+	// MaxTags specifies the maximum number of Tags a Packet may carry. Packets
+	// with more Tags are rejected with an error. If zero or negative,
+	// DefaultMaxTags is used; the limit cannot be disabled.
+	MaxTags int
+
+	// MaxSize specifies the maximum length in bytes of a Packet, including
+	// its header and checksum. Longer Packets are rejected with an error
+	// before they are decoded. If zero, any length permitted by the protocol
+	// is accepted.
+	MaxSize int
+
+	// NoCopy specifies that the Data of each of a Packet's Tags should refer
+	// directly to the input buffer rather than to a copy, as with
+	// Packet.UnmarshalBinaryNoCopy. The caller must not modify or reuse the
+	// buffer while the Packet is in use.
+	NoCopy bool
+
+	// NoCRC specifies that a Packet's checksum should not be verified, as
+	// with Packet.UnmarshalBinaryNoCRC. It is intended only for debugging
+	// captured Packets, and is unsafe for use with live network traffic.
+	NoCRC bool
+}
+
+// Decode unmarshals a single Packet from b, which must contain exactly one
+// Packet.
+func (d *Decoder) Decode(b []byte) (*Packet, error) {
+	p := new(Packet)
+	if err := d.decode(p, b); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// decode unmarshals a single Packet from b into p.
+func (d *Decoder) decode(p *Packet, b []byte) error {
+	if p == nil {
+		return errNilPacket
+	}
+
+	if d.MaxSize != 0 && len(b) > d.MaxSize {
+		return errPacketTooLarge
+	}
+
+	if len(b) < 8 || packetLength(b) != len(b) {
+		return io.ErrUnexpectedEOF
+	}
+
+	if !d.NoCRC {
+		if err := VerifyChecksum(b); err != nil {
+			return err
+		}
+	}
+
+	maxTags := d.MaxTags
+	if maxTags <= 0 {
+		maxTags = DefaultMaxTags
+	}
+
+	return p.decodeTags(b, d.NoCopy, maxTags)
+}
+
+// A DiscoverRequest is a device discovery request decoded by Decode.
+type DiscoverRequest struct {
+	// Type and ID are the device type and device ID being searched for,
+	// which may be DeviceTypeWildcard and "ffffffff" respectively.
+	Type DeviceType
+	ID   string
+}
+
+// A GetSetRequest is a get/set request decoded by Decode.
+type GetSetRequest struct {
+	// Name is the key being read or written.
+	Name string
+
+	// Set reports whether the request sets Value, rather than only reading
+	// Name.
+	Set   bool
+	Value string
+
+	// LockKey is the lock key which accompanied a set request, or zero if
+	// none was present.
+	LockKey uint32
+}
+
+// A GetSetReply is a get/set reply decoded by Decode.
+type GetSetReply struct {
+	// Name and Value are the key and its current value.
+	Name, Value string
+
+	// Err is the error reported by the device, if any, as returned by
+	// Packet.Err.
+	Err error
+}
+
+// Decode unmarshals a Packet from b and returns a value specific to its type,
+// so that callers can use a type switch rather than inspecting Tags:
+//   - discover requests are returned as *DiscoverRequest
+//   - discover replies are returned as *DiscoveredDevice, with no address
+//   - get/set requests are returned as *GetSetRequest
+//   - get/set replies are returned as *GetSetReply
+//
+// Packets of any other type are returned as *Packet.
+func Decode(b []byte) (interface{}, error) {
+	var p Packet
+	if err := p.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	switch p.Type {
+	case libhdhomerun.TypeDiscoverReq:
+		var req DiscoverRequest
+		for _, t := range p.Tags {
+			switch t.Type {
+			case libhdhomerun.TagDeviceType:
+				if l := len(t.Data); l != 4 {
+					return nil, fmt.Errorf("unexpected device type length in discover request: %d", l)
+				}
+
+				req.Type = DeviceType(binary.BigEndian.Uint32(t.Data))
+			case libhdhomerun.TagDeviceId:
+				if l := len(t.Data); l != 4 {
+					return nil, fmt.Errorf("unexpected device ID length in discover request: %d", l)
+				}
+
+				req.ID = hex.EncodeToString(t.Data)
+			}
+		}
+
+		return &req, nil
+	case libhdhomerun.TypeDiscoverRpy:
+		d, err := newDiscoveredDevice("", p)
+		if err != nil {
+			return nil, err
+		}
+		d.Addrs = nil
+
+		return d, nil
+	case libhdhomerun.TypeGetsetReq:
+		if err := p.Require(libhdhomerun.TagGetsetName); err != nil {
+			return nil, err
+		}
+
+		var req GetSetRequest
+		for _, t := range p.Tags {
+			switch t.Type {
+			case libhdhomerun.TagGetsetName:
+				req.Name = bytesStr(t.Data)
+			case libhdhomerun.TagGetsetValue:
+				req.Set = true
+				req.Value = bytesStr(t.Data)
+			case libhdhomerun.TagGetsetLockkey:
+				if l := len(t.Data); l != 4 {
+					return nil, fmt.Errorf("unexpected lock key length in get/set request: %d", l)
+				}
+
+				req.LockKey = binary.BigEndian.Uint32(t.Data)
+			}
+		}
+
+		return &req, nil
+	case libhdhomerun.TypeGetsetRpy:
+		rep := GetSetReply{
+			Err: p.Err(),
+		}
+
+		for _, t := range p.Tags {
+			switch t.Type {
+			case libhdhomerun.TagGetsetName:
+				rep.Name = bytesStr(t.Data)
+			case libhdhomerun.TagGetsetValue:
+				rep.Value = bytesStr(t.Data)
+			}
+		}
+
+		return &rep, nil
+	default:
+		return &p, nil
+	}
+}
+
+// PacketLength returns the total length in bytes of the Packet which begins
+// at b, including its header, tags, and checksum. Only the 4 byte header is
+// read: the tags are not decoded and the checksum is not verified, so
+// PacketLength is suitable for cheaply framing a stream of Packets.
+//
+// If b is shorter than a Packet header, io.ErrUnexpectedEOF is returned.
+func PacketLength(b []byte) (int, error) {
+	if len(b) < libhdhomerun.MinPeekLength {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return packetLength(b), nil
+}
+
+// PeekType returns the type of the Packet which begins at b. Only the first 2
+// bytes are read: the Packet is not decoded and its checksum is not verified,
+// so PeekType is suitable for cheaply classifying Packets, such as when
+// routing them along with PacketLength. PeekType does not allocate.
+//
+// If b is shorter than 2 bytes, io.ErrUnexpectedEOF is returned.
+func PeekType(b []byte) (uint16, error) {
+	if len(b) < 2 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return binary.BigEndian.Uint16(b[0:2]), nil
+}
+
+// packetLength returns the total length of the Packet whose header begins b,
+// including its header and checksum. b must be at least 4 bytes in length.
+func packetLength(b []byte) int {
+	return 2 + 2 + int(binary.BigEndian.Uint16(b[2:4])) + 4
+}
+
+// IsHDHomeRunPacket reports whether b contains exactly one valid HDHomeRun
+// Packet, by checking its declared length and checksum without decoding its
+// Tags. It does not allocate, so it can be used to cheaply discard datagrams
+// from other applications which share a UDP port with HDHomeRun devices.
+func IsHDHomeRunPacket(b []byte) bool {
+	return len(b) >= 8 && packetLength(b) == len(b) && VerifyChecksum(b) == nil
+}
+
+// unmarshal unmarshals a Packet from b, which must contain exactly one Packet
+// whose declared length has already been validated.
+func (p *Packet) unmarshal(b []byte) error {
+	if err := VerifyChecksum(b); err != nil {
+		return err
+	}
+
+	return p.decodeTags(b, false, DefaultMaxTags)
+}
+
+// VerifyChecksum verifies the checksum of the Packet in b, which must contain
+// exactly one Packet including its trailing 4 byte checksum. If b is too
+// short to contain a checksum, io.ErrUnexpectedEOF is returned.
+func VerifyChecksum(b []byte) error {
+	if len(b) < 4 {
 		return io.ErrUnexpectedEOF
 	}
 
 	want := binary.LittleEndian.Uint32(b[len(b)-4:])
-	got := crc32.ChecksumIEEE(b[0 : len(b)-4])
-	if want != got {
+	if checksum(b[:len(b)-4]) != want {
 		return errInvalidChecksum
 	}
 
-	p.Type = binary.BigEndian.Uint16(b[0:2])
-	length := int(binary.BigEndian.Uint16(b[2:4]))
+	return nil
+}
 
-	// Don't allow a misleading length value, minus length for
-	// type, tags length, and CRC checksum.
-	if length != len(b)-8 {
-		return io.ErrUnexpectedEOF
+// VerifyChecksumReader is like VerifyChecksum, but it reads a Packet from r
+// instead of a buffer. length is the length of the Packet excluding its
+// checksum; length bytes are read from r and checksummed incrementally, and
+// then the 4 byte checksum is read and compared. The data read from r is
+// discarded.
+//
+// If r ends before the checksum has been read, io.ErrUnexpectedEOF is
+// returned.
+func VerifyChecksumReader(r io.Reader, length int) error {
+	if length < 0 {
+		return fmt.Errorf("packet length must not be negative: %d", length)
+	}
+
+	// Large enough for a typical Packet in a single read.
+	var (
+		buf [512]byte
+		crc uint32
+	)
+
+	for length > 0 {
+		n := length
+		if n > len(buf) {
+			n = len(buf)
+		}
+
+		if _, err := io.ReadFull(r, buf[:n]); err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+
+			return err
+		}
+
+		crc = crc32.Update(crc, crcTable, buf[:n])
+		length -= n
+	}
+
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+
+		return err
 	}
 
-	if length == 0 {
+	if crc != binary.LittleEndian.Uint32(buf[:4]) {
+		return errInvalidChecksum
+	}
+
+	return nil
+}
+
+// decodeTags decodes a Packet from b without verifying its checksum. b must
+// contain exactly one Packet whose declared length has already been
+// validated, and whose checksum has already been verified if needed, such as
+// by the unmarshal methods or by a Reader which framed the Packet itself.
+// If noCopy is true, the Data of each Tag refers to b. At most maxTags Tags
+// are decoded before errTooManyTags is returned.
+func (p *Packet) decodeTags(b []byte, noCopy bool, maxTags int) error {
+	p.Type = binary.BigEndian.Uint16(b[0:2])
+
+	if len(b) == 8 {
+		p.Tags = nil
 		return nil
 	}
 
 	p.Tags = make([]Tag, 0)
 	for i := 4; i < len(b)-4; {
+		typ, data, next, err := nextTag(b, i)
+		if err != nil {
+			return err
+		}
+		i = next
+
+		if len(p.Tags) == maxTags {
+			return errTooManyTags
+		}
+
+		if noCopy {
+			// Limit the capacity so appending to the data cannot overwrite
+			// the following bytes of b.
+			p.Tags = append(p.Tags, Tag{
+				Type: typ,
+				Data: data[:len(data):len(data)],
+			})
+			continue
+		}
+
 		t := Tag{
-			Type: b[i],
+			Type: typ,
+			Data: make([]byte, len(data)),
 		}
-		i++
+		copy(t.Data, data)
+
+		p.Tags = append(p.Tags, t)
+	}
 
-		tlen, consumed, err := readTagLength(b[i : i+2])
+	return nil
+}
+
+// CountTags returns the number of Tags in the Packet in b, which must contain
+// exactly one Packet. The length of the Packet and each of its Tags is
+// validated, but the checksum is not verified and no Tag data is copied, so
+// CountTags is cheaper than UnmarshalBinary when only the number of Tags is
+// needed.
+func CountTags(b []byte) (int, error) {
+	if len(b) < 8 || packetLength(b) != len(b) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	var n int
+	for i := 4; i < len(b)-4; n++ {
+		_, _, next, err := nextTag(b, i)
 		if err != nil {
-			return err
+			return 0, err
 		}
-		i += consumed
+		i = next
+	}
 
-		// Don't allow a misleading tag length value.
-		if len(b[i:])-4 < tlen {
-			return io.ErrUnexpectedEOF
+	return n, nil
+}
+
+// nextTag decodes the Tag which begins at index i of the Packet in b, and
+// returns its type, its data, and the index of the following Tag. b must
+// contain exactly one Packet whose declared length has already been
+// validated. The returned data aliases b.
+func nextTag(b []byte, i int) (typ uint8, data []byte, next int, err error) {
+	typ = b[i]
+	i++
+
+	tlen, consumed, err := readTagLength(b[i : i+2])
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	i += consumed
+
+	// Don't allow a misleading tag length value.
+	if len(b[i:])-4 < tlen {
+		return 0, nil, 0, io.ErrUnexpectedEOF
+	}
+
+	return typ, b[i : i+tlen], i + tlen, nil
+}
+
+// String returns a human-readable representation of a Packet. The data of
+// Tags defined by the HDHomeRun protocol is decoded according to its type;
+// for example, get/set names and values are printed as strings. The data of
+// unknown Tags is printed in hexadecimal.
+func (p *Packet) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+
+	var b strings.Builder
+
+	b.WriteString("Packet{Type: ")
+	if name, ok := typeNames[p.Type]; ok {
+		b.WriteString(name)
+	} else {
+		fmt.Fprintf(&b, "%#04x", p.Type)
+	}
+
+	b.WriteString(", Tags: [")
+	for i, t := range p.Tags {
+		if i > 0 {
+			b.WriteString(", ")
 		}
 
-		t.Data = make([]byte, len(b[i:i+tlen]))
-		copy(t.Data, b[i:i+tlen])
-		i += tlen
+		b.WriteString(t.String())
+	}
+	b.WriteString("]}")
 
-		p.Tags = append(p.Tags, t)
+	return b.String()
+}
+
+// String returns a human-readable representation of a Tag, decoding its data
+// according to its type.
+func (t Tag) String() string {
+	return fmt.Sprintf("%s: %s", tagName(t.Type), formatTagData(t))
+}
+
+// tagName returns the human-readable name of a Tag type, or its hexadecimal
+// value if the type is unknown.
+func tagName(typ uint8) string {
+	if name, ok := tagNames[typ]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("%#02x", typ)
+}
+
+// StringN returns the data of a Tag as a string. String values sent by
+// HDHomeRun devices, such as get/set names and values, are always terminated
+// by exactly one trailing NUL byte; if trimNul is true, a single trailing NUL
+// is removed. Any other NUL bytes, including those within the data, are kept.
+func (t Tag) StringN(trimNul bool) string {
+	if trimNul {
+		return bytesStr(t.Data)
+	}
+
+	return string(t.Data)
+}
+
+// formatTagData formats the data of a Tag according to its type. Data which
+// does not match the expected format for its type is printed in hexadecimal.
+func formatTagData(t Tag) string {
+	switch t.Type {
+	case libhdhomerun.TagGetsetName, libhdhomerun.TagGetsetValue,
+		libhdhomerun.TagErrorMessage, libhdhomerun.TagBaseUrl,
+		libhdhomerun.TagDeviceAuthStr:
+		return strconv.Quote(bytesStr(t.Data))
+	case libhdhomerun.TagDeviceType, libhdhomerun.TagGetsetLockkey:
+		if len(t.Data) == 4 {
+			return strconv.FormatUint(uint64(binary.BigEndian.Uint32(t.Data)), 10)
+		}
+	case libhdhomerun.TagTunerCount:
+		if len(t.Data) == 1 {
+			return strconv.Itoa(int(t.Data[0]))
+		}
+	}
+
+	// Device IDs are conventionally printed in hexadecimal as well.
+	return hex.EncodeToString(t.Data)
+}
+
+// typeNames are human-readable names for Packet types.
+var typeNames = map[uint16]string{
+	libhdhomerun.TypeDiscoverReq: "discover request",
+	libhdhomerun.TypeDiscoverRpy: "discover reply",
+	libhdhomerun.TypeGetsetReq:   "getset request",
+	libhdhomerun.TypeGetsetRpy:   "getset reply",
+	libhdhomerun.TypeUpgradeReq:  "upgrade request",
+	libhdhomerun.TypeUpgradeRpy:  "upgrade reply",
+}
+
+// tagNames are human-readable names for Tag types.
+var tagNames = map[uint8]string{
+	libhdhomerun.TagDeviceType:    "device type",
+	libhdhomerun.TagDeviceId:      "device ID",
+	libhdhomerun.TagGetsetName:    "getset name",
+	libhdhomerun.TagGetsetValue:   "getset value",
+	libhdhomerun.TagGetsetLockkey: "getset lockkey",
+	libhdhomerun.TagErrorMessage:  "error message",
+	libhdhomerun.TagTunerCount:    "tuner count",
+	libhdhomerun.TagDeviceAuthBin: "device auth bin",
+	libhdhomerun.TagBaseUrl:       "base URL",
+	libhdhomerun.TagDeviceAuthStr: "device auth str",
+}
+
+// Dedup removes Tags with duplicate types from a Packet, keeping only the data
+// from the last Tag of each type, which matches how HDHomeRun devices
+// interpret a Packet with duplicate Tags. The remaining Tags are kept in the
+// order in which each type first appeared.
+//
+// The data of any Tag types specified in concat are instead concatenated in
+// order into a single Tag. None of the Tag types defined by the HDHomeRun
+// protocol are repeatable, so concat is only useful for application-defined
+// Tag types.
+func (p *Packet) Dedup(concat ...uint8) {
+	// Track the index of the output Tag for each type.
+	idx := make(map[uint8]int, len(p.Tags))
+	tags := make([]Tag, 0, len(p.Tags))
+
+	for _, t := range p.Tags {
+		i, ok := idx[t.Type]
+		if !ok {
+			idx[t.Type] = len(tags)
+			tags = append(tags, t)
+			continue
+		}
+
+		if !isConcat(t.Type, concat) {
+			// Last tag wins.
+			tags[i].Data = t.Data
+			continue
+		}
+
+		// Copy so that the data of the original Tags is not modified.
+		data := make([]byte, 0, len(tags[i].Data)+len(t.Data))
+		data = append(data, tags[i].Data...)
+		tags[i].Data = append(data, t.Data...)
+	}
+
+	p.Tags = tags
+}
+
+// IsRequest reports whether the Packet's type is a request type defined by
+// the HDHomeRun protocol. Unknown types are neither requests nor replies.
+func (p *Packet) IsRequest() bool {
+	switch p.Type {
+	case libhdhomerun.TypeDiscoverReq, libhdhomerun.TypeGetsetReq,
+		libhdhomerun.TypeUpgradeReq:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsReply reports whether the Packet's type is a reply type defined by the
+// HDHomeRun protocol. Unknown types are neither requests nor replies.
+func (p *Packet) IsReply() bool {
+	switch p.Type {
+	case libhdhomerun.TypeDiscoverRpy, libhdhomerun.TypeGetsetRpy,
+		libhdhomerun.TypeUpgradeRpy:
+		return true
+	default:
+		return false
+	}
+}
+
+// replyType returns the reply type expected in response to a request of type
+// typ. If typ is not a known request type, it returns false.
+func replyType(typ uint16) (uint16, bool) {
+	switch typ {
+	case libhdhomerun.TypeDiscoverReq:
+		return libhdhomerun.TypeDiscoverRpy, true
+	case libhdhomerun.TypeGetsetReq:
+		return libhdhomerun.TypeGetsetRpy, true
+	case libhdhomerun.TypeUpgradeReq:
+		return libhdhomerun.TypeUpgradeRpy, true
+	default:
+		return 0, false
+	}
+}
+
+// checkReplyType returns errUnexpectedReplyType if rep is not the type of
+// reply expected for req. Requests of unknown types accept any reply.
+func checkReplyType(req, rep *Packet) error {
+	want, ok := replyType(req.Type)
+	if ok && rep.Type != want {
+		return errUnexpectedReplyType
+	}
+
+	return nil
+}
+
+// Tag returns a pointer to the first of the Packet's Tags with the specified
+// type, or nil if no such Tag is present.
+//
+// The returned Tag is the Packet's own Tag rather than a copy, so modifying it
+// or its Data modifies the Packet. If the Packet was decoded using
+// UnmarshalBinaryNoCopy, the Data also refers to the decoded buffer. Use
+// TagCopy to retain a Tag independently of the Packet.
+func (p *Packet) Tag(typ uint8) *Tag {
+	if p == nil {
+		return nil
+	}
+
+	for i := range p.Tags {
+		if p.Tags[i].Type == typ {
+			return &p.Tags[i]
+		}
+	}
+
+	return nil
+}
+
+// TagCopy is like Tag, but it returns a copy of the Tag whose Data does not
+// refer to the Packet, and reports whether the Tag was present.
+func (p *Packet) TagCopy(typ uint8) (Tag, bool) {
+	t := p.Tag(typ)
+	if t == nil {
+		return Tag{}, false
+	}
+
+	// Preserve the distinction between nil and empty Data.
+	var data []byte
+	if t.Data != nil {
+		data = make([]byte, len(t.Data))
+		copy(data, t.Data)
+	}
+
+	return Tag{
+		Type: t.Type,
+		Data: data,
+	}, true
+}
+
+// Require returns an error naming each of the Tag types in tags which is not
+// present in the Packet, or nil if all of them are present.
+func (p *Packet) Require(tags ...uint8) error {
+	if p == nil {
+		return errNilPacket
+	}
+
+	var missing []string
+	for _, typ := range tags {
+		if p.Tag(typ) == nil {
+			missing = append(missing, tagName(typ))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("packet is missing required tags: %s", strings.Join(missing, ", "))
 	}
 
 	return nil
 }
 
+// Err returns an error if the Packet carries any error message Tags. A device
+// reply normally carries at most one, but if more are present, the returned
+// *Error describes the first and holds the remainder in its Others field, so
+// that no error reported by the device is lost. Err returns nil if the
+// Packet carries no error message Tags.
+func (p *Packet) Err() error {
+	if p == nil {
+		return errNilPacket
+	}
+
+	var err *Error
+	for _, t := range p.Tags {
+		if t.Type != libhdhomerun.TagErrorMessage {
+			continue
+		}
+
+		if err == nil {
+			err = newError(t.Data)
+			continue
+		}
+
+		err.Others = append(err.Others, newError(t.Data))
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	return err
+}
+
+// isConcat reports whether typ is present in concat.
+func isConcat(typ uint8, concat []uint8) bool {
+	for _, c := range concat {
+		if c == typ {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checksum computes the checksum of b using crcTable.
+func checksum(b []byte) uint32 {
+	return crc32.Checksum(b, crcTable)
+}
+
+// isKnownType determines if typ is a Packet type defined by the HDHomeRun
+// protocol.
+func isKnownType(typ uint16) bool {
+	switch typ {
+	case libhdhomerun.TypeDiscoverReq, libhdhomerun.TypeDiscoverRpy,
+		libhdhomerun.TypeGetsetReq, libhdhomerun.TypeGetsetRpy,
+		libhdhomerun.TypeUpgradeReq, libhdhomerun.TypeUpgradeRpy:
+		return true
+	default:
+		return false
+	}
+}
+
 // Variable tag length format reading and writing functions as described in:
 // https://github.com/Silicondust/libhdhomerun/blob/master/hdhomerun_pkt.h
 
+// tagLength returns the number of bytes needed to encode a Tag with n bytes
+// of data, including its type and length.
+func tagLength(n int) int {
+	// Tag length may be 2 bytes for larger numbers.
+	tlen := 1
+	if n >= largeTagLength {
+		tlen = 2
+	}
+
+	return 1 + tlen + n
+}
+
 // writeTagLength writes the value of n into b using the variable length tag
 // length algorithm used by HDHomeRun devices. It returns the number of bytes
 // consumed by the length value.
@@ -152,8 +1097,8 @@ func writeTagLength(n int, b []byte) (consumed int, err error) {
 	}
 
 	// Pack length into two bytes, marked by MSB set.
-	b[0] |= 0x80 | byte(n&0xff)
-	b[1] |= byte(n >> 7)
+	b[0] = 0x80 | byte(n&0x7f)
+	b[1] = byte(n >> 7)
 
 	return 2, nil
 }
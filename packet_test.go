@@ -2,12 +2,20 @@ package hdhomerun
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"math"
+	"net"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/joydip/hdhomerun/internal/libhdhomerun"
 )
 
 var packetTests = []struct {
@@ -63,6 +71,34 @@ var packetTests = []struct {
 			0x5d, 0x52, 0x64, 0xf2,
 		},
 	},
+	{
+		name: "empty tags",
+		p: &Packet{
+			Type: 2,
+			Tags: []Tag{
+				{
+					Type: 3,
+					Data: []byte{},
+				},
+				{
+					Type: 4,
+					Data: []byte{0xff},
+				},
+				{
+					Type: 5,
+					Data: []byte{},
+				},
+			},
+		},
+		b: []byte{
+			0x00, 0x02,
+			0x00, 0x07,
+			0x03, 0x00,
+			0x04, 0x01, 0xff,
+			0x05, 0x00,
+			0x58, 0x73, 0x8c, 0xda,
+		},
+	},
 	{
 		name: "large tags",
 		p: &Packet{
@@ -83,93 +119,1878 @@ var packetTests = []struct {
 				{0xd2, 0xc9, 0x42, 0x2c},
 			}
 
-			var buf bytes.Buffer
-			for _, b := range bs {
-				buf.Write(b)
+			var buf bytes.Buffer
+			for _, b := range bs {
+				buf.Write(b)
+			}
+
+			return buf.Bytes()
+		}(),
+	},
+	{
+		name: "discover request",
+		p: &Packet{
+			Type: libhdhomerun.TypeDiscoverReq,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagDeviceType,
+					Data: []byte{0xff, 0xff, 0xff, 0xff},
+				},
+				{
+					Type: libhdhomerun.TagDeviceId,
+					Data: []byte{0xff, 0xff, 0xff, 0xff},
+				},
+			},
+		},
+		// Identical to mustDiscoverPacket with wildcard type and ID.
+		b: []byte{
+			0x00, 0x02,
+			0x00, 0x0c,
+			0x01, 0x04, 0xff, 0xff, 0xff, 0xff,
+			0x02, 0x04, 0xff, 0xff, 0xff, 0xff,
+			0x73, 0xcc, 0x7d, 0x8f,
+		},
+	},
+	{
+		name: "discover reply",
+		p: &Packet{
+			Type: libhdhomerun.TypeDiscoverRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagDeviceType,
+					Data: []byte{0x00, 0x00, 0x00, 0x01},
+				},
+				{
+					Type: libhdhomerun.TagDeviceId,
+					Data: []byte{0x10, 0x40, 0xa2, 0xb3},
+				},
+				{
+					Type: libhdhomerun.TagBaseUrl,
+					Data: []byte("http://192.168.1.100:80"),
+				},
+				{
+					Type: libhdhomerun.TagTunerCount,
+					Data: []byte{0x02},
+				},
+			},
+		},
+		b: []byte{
+			0x00, 0x03,
+			0x00, 0x28,
+			0x01, 0x04, 0x00, 0x00, 0x00, 0x01,
+			0x02, 0x04, 0x10, 0x40, 0xa2, 0xb3,
+			0x2a, 0x17, 0x68, 0x74, 0x74, 0x70, 0x3a, 0x2f, 0x2f, 0x31, 0x39,
+			0x32, 0x2e, 0x31, 0x36, 0x38, 0x2e, 0x31, 0x2e, 0x31, 0x30, 0x30,
+			0x3a, 0x38, 0x30,
+			0x10, 0x01, 0x02,
+			0xd5, 0x16, 0x47, 0x18,
+		},
+	},
+	{
+		name: "getset query request",
+		p:    newGetSetRequest("/sys/model", nil),
+		b: []byte{
+			0x00, 0x04,
+			0x00, 0x0d,
+			0x03, 0x0b, 0x2f, 0x73, 0x79, 0x73, 0x2f, 0x6d, 0x6f, 0x64, 0x65,
+			0x6c, 0x00,
+			0x8f, 0x5b, 0x54, 0xb5,
+		},
+	},
+	{
+		name: "getset set request with lock key",
+		p: func() *Packet {
+			p := newGetSetRequest("/tuner0/channel", strBytes("auto:509000000"))
+			(&Client{lockkey: 1234}).addLockKey(p)
+			return p
+		}(),
+		b: []byte{
+			0x00, 0x04,
+			0x00, 0x29,
+			0x03, 0x10, 0x2f, 0x74, 0x75, 0x6e, 0x65, 0x72, 0x30, 0x2f, 0x63,
+			0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x00,
+			0x04, 0x0f, 0x61, 0x75, 0x74, 0x6f, 0x3a, 0x35, 0x30, 0x39, 0x30,
+			0x30, 0x30, 0x30, 0x30, 0x30, 0x00,
+			0x15, 0x04, 0x00, 0x00, 0x04, 0xd2,
+			0xaa, 0x6d, 0x28, 0xa4,
+		},
+	},
+	{
+		name: "getset reply",
+		p: &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/sys/model"),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("hdhomerun5_atsc"),
+				},
+			},
+		},
+		b: []byte{
+			0x00, 0x05,
+			0x00, 0x1f,
+			0x03, 0x0b, 0x2f, 0x73, 0x79, 0x73, 0x2f, 0x6d, 0x6f, 0x64, 0x65,
+			0x6c, 0x00,
+			0x04, 0x10, 0x68, 0x64, 0x68, 0x6f, 0x6d, 0x65, 0x72, 0x75, 0x6e,
+			0x35, 0x5f, 0x61, 0x74, 0x73, 0x63, 0x00,
+			0x1e, 0x5f, 0xd1, 0x21,
+		},
+	},
+	{
+		name: "getset error reply",
+		p: &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/sys/foo"),
+				},
+				{
+					Type: libhdhomerun.TagErrorMessage,
+					Data: strBytes(errorPrefix + unknownGetSet),
+				},
+			},
+		},
+		b: []byte{
+			0x00, 0x05,
+			0x00, 0x2c,
+			0x03, 0x09, 0x2f, 0x73, 0x79, 0x73, 0x2f, 0x66, 0x6f, 0x6f, 0x00,
+			0x05, 0x1f, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x3a, 0x20, 0x75, 0x6e,
+			0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x20, 0x67, 0x65, 0x74, 0x73, 0x65,
+			0x74, 0x20, 0x76, 0x61, 0x72, 0x69, 0x61, 0x62, 0x6c, 0x65, 0x00,
+			0xed, 0xf6, 0x86, 0xe8,
+		},
+	},
+	{
+		name: "getset reply with large value",
+		p: &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/tuner0/streaminfo"),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes(strings.Repeat("3: 5.1 KPIX-HD\n", 10) + "tsid=0x0123\n"),
+				},
+			},
+		},
+		b: func() []byte {
+			bs := [][]byte{
+				{0x00, 0x05},
+				{0x00, 0xbb},
+				{0x03, 0x13},
+				[]byte("/tuner0/streaminfo\x00"),
+				// 163 bytes, which requires a two byte tag length.
+				{0x04, 0xa3, 0x01},
+				[]byte(strings.Repeat("3: 5.1 KPIX-HD\n", 10) + "tsid=0x0123\n\x00"),
+				{0xe2, 0x77, 0x43, 0x9b},
+			}
+
+			var buf bytes.Buffer
+			for _, b := range bs {
+				buf.Write(b)
+			}
+
+			return buf.Bytes()
+		}(),
+	},
+	// Upgrade requests are omitted because their payload is raw firmware
+	// data rather than tags, so they cannot be represented by a Packet.
+	{
+		name: "upgrade reply",
+		p: &Packet{
+			Type: libhdhomerun.TypeUpgradeRpy,
+		},
+		b: []byte{
+			0x00, 0x07,
+			0x00, 0x00,
+			0x99, 0xc9, 0x0b, 0x24,
+		},
+	},
+}
+
+func TestPacketMarshalUnmarshalBinary(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb, err := tt.p.MarshalBinary()
+			if err != nil {
+				t.Fatalf("unexpected error marshaling packet: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, pb); diff != "" {
+				t.Fatalf("unexpected packet bytes (-want +got):\n%s", diff)
+			}
+
+			p := new(Packet)
+			if err := p.UnmarshalBinary(pb); err != nil {
+				t.Fatalf("unexpected error unmarshaling packet: %v", err)
+			}
+
+			if diff := diffPackets(tt.p, p); diff != "" {
+				t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPacketMarshalBinaryNilTagData(t *testing.T) {
+	// Nil data is encoded the same as empty data, but is always decoded as
+	// empty, non-nil data.
+	p := &Packet{
+		Type: 2,
+		Tags: []Tag{{Type: 3}},
+	}
+
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal packet: %v", err)
+	}
+
+	want := []byte{
+		0x00, 0x02,
+		0x00, 0x02,
+		0x03, 0x00,
+	}
+	if diff := cmp.Diff(want, pb[:len(pb)-4]); diff != "" {
+		t.Fatalf("unexpected packet bytes (-want +got):\n%s", diff)
+	}
+
+	for _, noCopy := range []bool{false, true} {
+		var got Packet
+		unmarshal := got.UnmarshalBinary
+		if noCopy {
+			unmarshal = got.UnmarshalBinaryNoCopy
+		}
+
+		if err := unmarshal(pb); err != nil {
+			t.Fatalf("failed to unmarshal packet: %v", err)
+		}
+
+		if d := got.Tags[0].Data; d == nil || len(d) != 0 {
+			t.Fatalf("expected empty, non-nil data (no copy: %v), but got: %#v", noCopy, d)
+		}
+	}
+}
+
+func TestPacketNilEmptyTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []Tag
+		nil  bool
+	}{
+		{
+			name: "nil",
+			nil:  true,
+		},
+		{
+			name: "empty",
+			tags: []Tag{},
+			nil:  true,
+		},
+		{
+			name: "populated",
+			tags: []Tag{{
+				Type: 1,
+				Data: []byte{0xff},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb, err := (&Packet{Type: 2, Tags: tt.tags}).MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal packet: %v", err)
+			}
+
+			for _, noCopy := range []bool{false, true} {
+				// Decode into a Packet which already holds Tags to verify
+				// they are replaced.
+				got := &Packet{
+					Tags: []Tag{{Type: 3}},
+				}
+
+				unmarshal := got.UnmarshalBinary
+				if noCopy {
+					unmarshal = got.UnmarshalBinaryNoCopy
+				}
+
+				if err := unmarshal(pb); err != nil {
+					t.Fatalf("failed to unmarshal packet: %v", err)
+				}
+
+				if diff := cmp.Diff(tt.nil, got.Tags == nil); diff != "" {
+					t.Fatalf("unexpected nil tags (no copy: %v) (-want +got):\n%s", noCopy, diff)
+				}
+
+				if diff := cmp.Diff(len(tt.tags), len(got.Tags)); diff != "" {
+					t.Fatalf("unexpected number of tags (no copy: %v) (-want +got):\n%s", noCopy, diff)
+				}
+
+				b, err := got.MarshalBinary()
+				if err != nil {
+					t.Fatalf("failed to marshal packet: %v", err)
+				}
+
+				if diff := cmp.Diff(pb, b); diff != "" {
+					t.Fatalf("unexpected packet bytes (no copy: %v) (-want +got):\n%s", noCopy, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestPacketUnmarshalBinaryError(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{
+			name: "empty",
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "short",
+			b:    bytes.Repeat([]byte{0x00}, 7),
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "checksum",
+			b:    bytes.Repeat([]byte{0x00}, 8),
+			err:  errInvalidChecksum,
+		},
+		{
+			name: "fuzz",
+			b:    []byte("\x1dx˩\xd5D\xd5D\xf3e;\xbe\x1c\xc3F\xbe"),
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "fuzz",
+			b:    []byte("11\x98\xd3\x14\x06R;Q"),
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "fuzz",
+			b:    []byte("reQl\x00\x00\x01\x00V\x00\x80\a\xaf\xaep\xff\xee"),
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "fuzz",
+			b:    []byte("\xa8\xd9\x00\x00\x10\x00\\f\xbfｿD\x1e\xa2\x8d"),
+			err:  io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := new(Packet)
+			err := p.UnmarshalBinary(tt.b)
+
+			if want, got := tt.err, err; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v", want, got)
+			}
+		})
+	}
+}
+
+// discoverReply is a discovery reply from an HDHomeRun tuner. Its tags are
+// in the order that the device transmits them, which is not sorted by type,
+// and it includes a lineup URL tag (0x27) which this package does not model.
+var discoverReply = []byte{
+	0x00, 0x03, 0x00, 0x67, 0x01, 0x04, 0x00, 0x00, 0x00, 0x01, 0x02, 0x04,
+	0x10, 0x40, 0xa2, 0xb3, 0x2a, 0x17, 0x68, 0x74, 0x74, 0x70, 0x3a, 0x2f,
+	0x2f, 0x31, 0x39, 0x32, 0x2e, 0x31, 0x36, 0x38, 0x2e, 0x31, 0x2e, 0x31,
+	0x30, 0x30, 0x3a, 0x38, 0x30, 0x10, 0x01, 0x02, 0x2b, 0x18, 0x71, 0x33,
+	0x55, 0x6a, 0x35, 0x47, 0x69, 0x58, 0x78, 0x54, 0x71, 0x77, 0x67, 0x57,
+	0x6c, 0x47, 0x72, 0x42, 0x71, 0x69, 0x50, 0x78, 0x45, 0x7a, 0x27, 0x23,
+	0x68, 0x74, 0x74, 0x70, 0x3a, 0x2f, 0x2f, 0x31, 0x39, 0x32, 0x2e, 0x31,
+	0x36, 0x38, 0x2e, 0x31, 0x2e, 0x31, 0x30, 0x30, 0x3a, 0x38, 0x30, 0x2f,
+	0x6c, 0x69, 0x6e, 0x65, 0x75, 0x70, 0x2e, 0x6a, 0x73, 0x6f, 0x6e, 0xd5,
+	0x0e, 0x61, 0xb1,
+}
+
+func TestPacketMarshalBinaryTo(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Too small by one byte.
+			short := make([]byte, len(tt.b)-1)
+			if _, err := tt.p.MarshalBinaryTo(short); err != io.ErrShortBuffer {
+				t.Fatalf("expected short buffer error, but got: %v", err)
+			}
+
+			// A reusable buffer larger than any Packet, which still holds
+			// data from previous use.
+			b := bytes.Repeat([]byte{0xff}, libhdhomerun.MaxPacketSize)
+			n, err := tt.p.MarshalBinaryTo(b)
+			if err != nil {
+				t.Fatalf("failed to marshal packet: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, b[:n]); diff != "" {
+				t.Fatalf("unexpected packet bytes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPacketMarshalHeader(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := tt.p.MarshalHeader()
+			if err != nil {
+				t.Fatalf("failed to marshal header: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b[:4], h[:]); diff != "" {
+				t.Fatalf("unexpected header bytes (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		var p *Packet
+		if _, err := p.MarshalHeader(); err != errNilPacket {
+			t.Fatalf("expected nil packet error, but got: %v", err)
+		}
+	})
+}
+
+func TestPacketMarshalTagsTooLong(t *testing.T) {
+	// Two tags whose combined length cannot fit in the header.
+	p := &Packet{
+		Tags: []Tag{
+			{Data: make([]byte, math.MaxUint16/2)},
+			{Data: make([]byte, math.MaxUint16/2)},
+		},
+	}
+
+	if _, err := p.MarshalBinary(); err != errTagsTooLong {
+		t.Fatalf("expected tags too long error from MarshalBinary, but got: %v", err)
+	}
+
+	if _, err := p.MarshalBinaryTo(make([]byte, 2*math.MaxUint16)); err != errTagsTooLong {
+		t.Fatalf("expected tags too long error from MarshalBinaryTo, but got: %v", err)
+	}
+
+	if _, err := p.MarshalHeader(); err != errTagsTooLong {
+		t.Fatalf("expected tags too long error from MarshalHeader, but got: %v", err)
+	}
+}
+
+func TestPacketWriteToUDP(t *testing.T) {
+	listen := func() net.PacketConn {
+		c, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+
+		return c
+	}
+
+	src, dst := listen(), listen()
+	defer src.Close()
+	defer dst.Close()
+
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := tt.p.WriteToUDP(src, dst.LocalAddr())
+			if err != nil {
+				t.Fatalf("failed to write packet: %v", err)
+			}
+
+			if diff := cmp.Diff(len(tt.b), n); diff != "" {
+				t.Fatalf("unexpected number of bytes written (-want +got):\n%s", diff)
+			}
+
+			if err := dst.SetReadDeadline(time.Now().Add(1 * time.Second)); err != nil {
+				t.Fatalf("failed to set deadline: %v", err)
+			}
+
+			b := make([]byte, libhdhomerun.MaxPacketSize)
+			n, _, err = dst.ReadFrom(b)
+			if err != nil {
+				t.Fatalf("failed to read packet: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, b[:n]); diff != "" {
+				t.Fatalf("unexpected packet bytes (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("too large", func(t *testing.T) {
+		p := &Packet{
+			Type: libhdhomerun.TypeGetsetReq,
+			Tags: []Tag{{
+				Type: libhdhomerun.TagGetsetValue,
+				Data: make([]byte, libhdhomerun.MaxPacketSize),
+			}},
+		}
+
+		if _, err := p.WriteToUDP(src, dst.LocalAddr()); err == nil {
+			t.Fatal("expected an error, but none occurred")
+		}
+	})
+}
+
+func TestPacketRoundTripDiscoverReply(t *testing.T) {
+	p := new(Packet)
+	if err := p.UnmarshalBinary(discoverReply); err != nil {
+		t.Fatalf("failed to unmarshal discover reply: %v", err)
+	}
+
+	// Tags must be decoded in wire order.
+	want := []uint8{
+		libhdhomerun.TagDeviceType,
+		libhdhomerun.TagDeviceId,
+		libhdhomerun.TagBaseUrl,
+		libhdhomerun.TagTunerCount,
+		libhdhomerun.TagDeviceAuthStr,
+		0x27,
+	}
+
+	got := make([]uint8, 0, len(p.Tags))
+	for _, tag := range p.Tags {
+		got = append(got, tag.Type)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected tag order (-want +got):\n%s", diff)
+	}
+
+	// Re-encoding must reproduce the original bytes exactly.
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal discover reply: %v", err)
+	}
+
+	if diff := cmp.Diff(discoverReply, pb); diff != "" {
+		t.Fatalf("unexpected discover reply bytes (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	marshal := func(p *Packet) []byte {
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal packet: %v", err)
+		}
+
+		return b
+	}
+
+	setReq := newGetSetRequest("/tuner0/channel", strBytes("auto:8"))
+	setReq.Tags = append(setReq.Tags, Tag{
+		Type: libhdhomerun.TagGetsetLockkey,
+		Data: []byte{0x00, 0x00, 0x00, 0x2a},
+	})
+
+	tests := []struct {
+		name string
+		b    []byte
+		v    interface{}
+	}{
+		{
+			name: "discover request",
+			b:    mustDiscoverPacket(DeviceTypeTuner, []byte{0xff, 0xff, 0xff, 0xff}, 0),
+			v: &DiscoverRequest{
+				Type: DeviceTypeTuner,
+				ID:   "ffffffff",
+			},
+		},
+		{
+			name: "get request",
+			b:    marshal(newGetSetRequest("/sys/model", nil)),
+			v: &GetSetRequest{
+				Name: "/sys/model",
+			},
+		},
+		{
+			name: "set request",
+			b:    marshal(setReq),
+			v: &GetSetRequest{
+				Name:    "/tuner0/channel",
+				Set:     true,
+				Value:   "auto:8",
+				LockKey: 42,
+			},
+		},
+		{
+			name: "get/set reply",
+			b: marshal(&Packet{
+				Type: libhdhomerun.TypeGetsetRpy,
+				Tags: []Tag{
+					{
+						Type: libhdhomerun.TagGetsetName,
+						Data: strBytes("/sys/model"),
+					},
+					{
+						Type: libhdhomerun.TagGetsetValue,
+						Data: strBytes("hdhomerun5_atsc"),
+					},
+				},
+			}),
+			v: &GetSetReply{
+				Name:  "/sys/model",
+				Value: "hdhomerun5_atsc",
+			},
+		},
+		{
+			name: "upgrade reply",
+			b:    marshal(&Packet{Type: libhdhomerun.TypeUpgradeRpy}),
+			v:    &Packet{Type: libhdhomerun.TypeUpgradeRpy},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Decode(tt.b)
+			if err != nil {
+				t.Fatalf("failed to decode packet: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.v, v); diff != "" {
+				t.Fatalf("unexpected decoded value (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("discover reply", func(t *testing.T) {
+		v, err := Decode(discoverReply)
+		if err != nil {
+			t.Fatalf("failed to decode packet: %v", err)
+		}
+
+		d, ok := v.(*DiscoveredDevice)
+		if !ok {
+			t.Fatalf("expected *DiscoveredDevice, but got: %T", v)
+		}
+
+		if d.ID == "" || d.Type != DeviceTypeTuner || d.Addrs != nil {
+			t.Fatalf("unexpected discovered device: %#v", d)
+		}
+	})
+
+	t.Run("get/set reply error", func(t *testing.T) {
+		v, err := Decode(marshal(&Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/sys/notexist"),
+				},
+				{
+					Type: libhdhomerun.TagErrorMessage,
+					Data: strBytes(errorPrefix + unknownGetSet),
+				},
+			},
+		}))
+		if err != nil {
+			t.Fatalf("failed to decode packet: %v", err)
+		}
+
+		rep, ok := v.(*GetSetReply)
+		if !ok {
+			t.Fatalf("expected *GetSetReply, but got: %T", v)
+		}
+
+		if !IsNotExist(rep.Err) {
+			t.Fatalf("expected not exist error, but got: %v", rep.Err)
+		}
+	})
+}
+
+func TestPacketUnmarshalBinaryStrict(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Lenient mode accepts any type.
+			if err := new(Packet).UnmarshalBinary(tt.b); err != nil {
+				t.Fatalf("unexpected error unmarshaling packet: %v", err)
+			}
+
+			// Strict mode only accepts types defined by the protocol.
+			err := new(Packet).UnmarshalBinaryStrict(tt.b)
+
+			switch tt.p.Type {
+			case libhdhomerun.TypeDiscoverReq, libhdhomerun.TypeDiscoverRpy,
+				libhdhomerun.TypeGetsetReq, libhdhomerun.TypeGetsetRpy,
+				libhdhomerun.TypeUpgradeReq, libhdhomerun.TypeUpgradeRpy:
+				if err != nil {
+					t.Fatalf("unexpected error unmarshaling known packet type: %v", err)
+				}
+			default:
+				if err == nil {
+					t.Fatal("expected an error for unknown packet type, but none occurred")
+				}
+			}
+		})
+	}
+}
+
+func TestPacketUnmarshalBinaryNoCRC(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Zero the checksum so that only the lenient method succeeds.
+			b := make([]byte, len(tt.b))
+			copy(b, tt.b)
+			copy(b[len(b)-4:], []byte{0x00, 0x00, 0x00, 0x00})
+
+			if err := new(Packet).UnmarshalBinary(b); err != errInvalidChecksum {
+				t.Fatalf("expected invalid checksum error, but got: %v", err)
+			}
+
+			var p Packet
+			if err := p.UnmarshalBinaryNoCRC(b); err != nil {
+				t.Fatalf("failed to unmarshal packet: %v", err)
+			}
+
+			if diff := diffPackets(tt.p, &p); diff != "" {
+				t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+			}
+
+			// Length consistency is still enforced.
+			if err := new(Packet).UnmarshalBinaryNoCRC(b[:len(b)-1]); err != io.ErrUnexpectedEOF {
+				t.Fatalf("expected unexpected EOF, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestPacketUnmarshalBinaryChecked(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Zero the checksum of a copy to produce a bad checksum.
+			bad := make([]byte, len(tt.b))
+			copy(bad, tt.b)
+			copy(bad[len(bad)-4:], []byte{0x00, 0x00, 0x00, 0x00})
+
+			for _, c := range []struct {
+				b  []byte
+				ok bool
+			}{
+				{b: tt.b, ok: true},
+				{b: bad, ok: false},
+			} {
+				var p Packet
+				ok, err := p.UnmarshalBinaryChecked(c.b)
+				if err != nil {
+					t.Fatalf("failed to unmarshal packet: %v", err)
+				}
+
+				if diff := cmp.Diff(c.ok, ok); diff != "" {
+					t.Fatalf("unexpected checksum result (-want +got):\n%s", diff)
+				}
+
+				if diff := diffPackets(tt.p, &p); diff != "" {
+					t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+				}
+			}
+
+			// Length consistency is still enforced.
+			if _, err := new(Packet).UnmarshalBinaryChecked(bad[:len(bad)-1]); err != io.ErrUnexpectedEOF {
+				t.Fatalf("expected unexpected EOF, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsHDHomeRunPacket(t *testing.T) {
+	valid := packetTests[2].b
+
+	badCRC := make([]byte, len(valid))
+	copy(badCRC, valid)
+	badCRC[len(badCRC)-1]++
+
+	tests := []struct {
+		name string
+		b    []byte
+		ok   bool
+	}{
+		{
+			name: "valid",
+			b:    valid,
+			ok:   true,
+		},
+		{
+			name: "empty",
+		},
+		{
+			name: "foreign",
+			b:    []byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\n\r\n"),
+		},
+		{
+			name: "bad CRC",
+			b:    badCRC,
+		},
+		{
+			name: "truncated",
+			b:    valid[:len(valid)-1],
+		},
+		{
+			name: "trailing data",
+			b:    append(append([]byte(nil), valid...), 0x00),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.ok, IsHDHomeRunPacket(tt.b)); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = IsHDHomeRunPacket(valid)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, but got: %v", allocs)
+	}
+}
+
+func TestPacketTagTagCopy(t *testing.T) {
+	b := make([]byte, len(packetTests[2].b))
+	copy(b, packetTests[2].b)
+
+	var p Packet
+	if err := p.UnmarshalBinaryNoCopy(b); err != nil {
+		t.Fatalf("failed to unmarshal packet: %v", err)
+	}
+
+	if tag := p.Tag(0xff); tag != nil {
+		t.Fatalf("expected no tag, but got: %v", tag)
+	}
+	if _, ok := p.TagCopy(0xff); ok {
+		t.Fatal("expected no tag copy")
+	}
+
+	tag := p.Tag(4)
+	if tag == nil {
+		t.Fatal("expected a tag, but got none")
+	}
+
+	cp, ok := p.TagCopy(4)
+	if !ok {
+		t.Fatal("expected a tag copy, but got none")
+	}
+
+	want := Tag{Type: 4, Data: []byte{0xaa, 0xbb, 0xcc}}
+	if diff := cmp.Diff(want, cp); diff != "" {
+		t.Fatalf("unexpected tag copy (-want +got):\n%s", diff)
+	}
+
+	// Modifying the Tag modifies the Packet and the buffer it was decoded
+	// from, but not the copy.
+	tag.Data[0] = 0x00
+
+	if diff := cmp.Diff(byte(0x00), p.Tags[1].Data[0]); diff != "" {
+		t.Fatalf("unexpected packet tag data (-want +got):\n%s", diff)
+	}
+	if !bytes.Contains(b, []byte{0x00, 0xbb, 0xcc}) {
+		t.Fatal("expected tag to alias decoded buffer")
+	}
+	if diff := cmp.Diff(want, cp); diff != "" {
+		t.Fatalf("tag copy was modified (-want +got):\n%s", diff)
+	}
+
+	// Modifying the copy affects nothing else.
+	cp.Data[1] = 0x00
+	if diff := cmp.Diff(byte(0xbb), tag.Data[1]); diff != "" {
+		t.Fatalf("unexpected packet tag data (-want +got):\n%s", diff)
+	}
+
+	if (*Packet)(nil).Tag(4) != nil {
+		t.Fatal("expected no tag from nil packet")
+	}
+}
+
+func TestPacketErr(t *testing.T) {
+	errTag := func(msg string) Tag {
+		return Tag{
+			Type: libhdhomerun.TagErrorMessage,
+			Data: strBytes(errorPrefix + msg),
+		}
+	}
+
+	tests := []struct {
+		name string
+		p    *Packet
+		err  *Error
+	}{
+		{
+			name: "no errors",
+			p: &Packet{
+				Type: libhdhomerun.TypeGetsetRpy,
+				Tags: []Tag{{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/sys/model"),
+				}},
+			},
+		},
+		{
+			name: "one error",
+			p: &Packet{
+				Type: libhdhomerun.TypeGetsetRpy,
+				Tags: []Tag{errTag(unknownGetSet)},
+			},
+			err: &Error{Message: unknownGetSet},
+		},
+		{
+			name: "two errors",
+			p: &Packet{
+				Type: libhdhomerun.TypeGetsetRpy,
+				Tags: []Tag{
+					errTag(unknownGetSet),
+					{
+						Type: libhdhomerun.TagGetsetName,
+						Data: strBytes("/sys/model"),
+					},
+					errTag(resourceLocked + " 192.168.1.10"),
+				},
+			},
+			err: &Error{
+				Message: unknownGetSet,
+				Others: []*Error{{
+					Message: resourceLocked + " 192.168.1.10",
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Err()
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			herr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("expected *Error, but got: %#v", err)
+			}
+
+			if diff := cmp.Diff(tt.err, herr); diff != "" {
+				t.Fatalf("unexpected error (-want +got):\n%s", diff)
+			}
+
+			// The first error determines the kind of the aggregate error.
+			if !IsNotExist(err) {
+				t.Fatalf("expected not exist error, but got: %v", err)
+			}
+
+			for _, o := range tt.err.Others {
+				if !strings.Contains(err.Error(), o.Message) {
+					t.Fatalf("error string does not contain %q: %v", o.Message, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPacketRequire(t *testing.T) {
+	p := &Packet{
+		Type: libhdhomerun.TypeGetsetRpy,
+		Tags: []Tag{
+			{
+				Type: libhdhomerun.TagGetsetName,
+				Data: strBytes("/sys/model"),
+			},
+			{
+				Type: libhdhomerun.TagGetsetValue,
+				Data: strBytes("hdhomerun3_atsc"),
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		p    *Packet
+		tags []uint8
+		err  string
+	}{
+		{
+			name: "none required",
+			p:    &Packet{},
+		},
+		{
+			name: "all present",
+			p:    p,
+			tags: []uint8{libhdhomerun.TagGetsetName, libhdhomerun.TagGetsetValue},
+		},
+		{
+			name: "all missing",
+			p:    &Packet{Type: libhdhomerun.TypeGetsetRpy},
+			tags: []uint8{libhdhomerun.TagGetsetName, libhdhomerun.TagGetsetValue},
+			err:  "packet is missing required tags: getset name, getset value",
+		},
+		{
+			name: "partially present",
+			p:    p,
+			tags: []uint8{libhdhomerun.TagGetsetName, libhdhomerun.TagGetsetLockkey, 0xfe},
+			err:  "packet is missing required tags: getset lockkey, 0xfe",
+		},
+		{
+			name: "nil packet",
+			tags: []uint8{libhdhomerun.TagGetsetName},
+			err:  errNilPacket.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if err := tt.p.Require(tt.tags...); err != nil {
+				got = err.Error()
+			}
+
+			if diff := cmp.Diff(tt.err, got); diff != "" {
+				t.Fatalf("unexpected error (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPacketUnmarshalBinaryNoCopy(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := make([]byte, len(tt.b))
+			copy(b, tt.b)
+
+			var p Packet
+			if err := p.UnmarshalBinaryNoCopy(b); err != nil {
+				t.Fatalf("failed to unmarshal packet: %v", err)
+			}
+
+			if diff := diffPackets(tt.p, &p); diff != "" {
+				t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+			}
+
+			// Each tag's data must alias b, and must not be able to grow
+			// into the bytes which follow it.
+			for i, tag := range p.Tags {
+				if len(tag.Data) == 0 {
+					continue
+				}
+
+				if cap(tag.Data) != len(tag.Data) {
+					t.Fatalf("tag %d: capacity %d exceeds length %d", i, cap(tag.Data), len(tag.Data))
+				}
+
+				tag.Data[0] ^= 0xff
+				ok := bytes.Contains(b, tag.Data)
+				tag.Data[0] ^= 0xff
+
+				if !ok {
+					t.Fatalf("tag %d: data does not refer to input buffer", i)
+				}
+			}
+
+			// Checksum and length are still enforced.
+			bad := make([]byte, len(b))
+			copy(bad, b)
+			bad[len(bad)-1]++
+
+			if err := new(Packet).UnmarshalBinaryNoCopy(bad); err != errInvalidChecksum {
+				t.Fatalf("expected invalid checksum error, but got: %v", err)
+			}
+
+			if err := new(Packet).UnmarshalBinaryNoCopy(b[:len(b)-1]); err != io.ErrUnexpectedEOF {
+				t.Fatalf("expected unexpected EOF, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestCountTags(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := CountTags(tt.b)
+			if err != nil {
+				t.Fatalf("failed to count tags: %v", err)
+			}
+
+			if diff := cmp.Diff(len(tt.p.Tags), n); diff != "" {
+				t.Fatalf("unexpected number of tags (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("discover reply", func(t *testing.T) {
+		n, err := CountTags(discoverReply)
+		if err != nil {
+			t.Fatalf("failed to count tags: %v", err)
+		}
+
+		if diff := cmp.Diff(6, n); diff != "" {
+			t.Fatalf("unexpected number of tags (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, b := range [][]byte{
+			// Too short.
+			{0x00, 0x01, 0x00},
+			// Misleading packet length.
+			{0x00, 0x01, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00},
+			// Misleading tag length.
+			{0x00, 0x01, 0x00, 0x02, 0x01, 0x05, 0x00, 0x00, 0x00, 0x00},
+		} {
+			if _, err := CountTags(b); err == nil {
+				t.Fatalf("expected an error for %x, but none occurred", b)
+			}
+		}
+	})
+}
+
+func TestPacketIsRequestIsReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      uint16
+		req, rpy bool
+	}{
+		{
+			name: "discover request",
+			typ:  libhdhomerun.TypeDiscoverReq,
+			req:  true,
+		},
+		{
+			name: "discover reply",
+			typ:  libhdhomerun.TypeDiscoverRpy,
+			rpy:  true,
+		},
+		{
+			name: "getset request",
+			typ:  libhdhomerun.TypeGetsetReq,
+			req:  true,
+		},
+		{
+			name: "getset reply",
+			typ:  libhdhomerun.TypeGetsetRpy,
+			rpy:  true,
+		},
+		{
+			name: "upgrade request",
+			typ:  libhdhomerun.TypeUpgradeReq,
+			req:  true,
+		},
+		{
+			name: "upgrade reply",
+			typ:  libhdhomerun.TypeUpgradeRpy,
+			rpy:  true,
+		},
+		{
+			name: "zero",
+			typ:  0x0000,
+		},
+		{
+			name: "unknown odd",
+			typ:  0x0009,
+		},
+		{
+			name: "unknown even",
+			typ:  0xfffe,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Packet{Type: tt.typ}
+
+			if diff := cmp.Diff(tt.req, p.IsRequest()); diff != "" {
+				t.Fatalf("unexpected request classification (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.rpy, p.IsReply()); diff != "" {
+				t.Fatalf("unexpected reply classification (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPacketLength(t *testing.T) {
+	for i := 0; i < libhdhomerun.MinPeekLength; i++ {
+		if _, err := PacketLength(make([]byte, i)); err != io.ErrUnexpectedEOF {
+			t.Fatalf("expected unexpected EOF for %d byte buffer, but got: %v", i, err)
+		}
+	}
+
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Only the header is needed.
+			n, err := PacketLength(tt.b[:libhdhomerun.MinPeekLength])
+			if err != nil {
+				t.Fatalf("failed to get packet length: %v", err)
+			}
+
+			if diff := cmp.Diff(len(tt.b), n); diff != "" {
+				t.Fatalf("unexpected packet length (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPeekType(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		if _, err := PeekType(make([]byte, i)); err != io.ErrUnexpectedEOF {
+			t.Fatalf("expected unexpected EOF for %d byte buffer, but got: %v", i, err)
+		}
+	}
+
+	types := []uint16{
+		libhdhomerun.TypeDiscoverReq,
+		libhdhomerun.TypeDiscoverRpy,
+		libhdhomerun.TypeGetsetReq,
+		libhdhomerun.TypeGetsetRpy,
+		libhdhomerun.TypeUpgradeReq,
+		libhdhomerun.TypeUpgradeRpy,
+	}
+
+	for _, typ := range types {
+		t.Run(fmt.Sprintf("%#04x", typ), func(t *testing.T) {
+			b, err := NewPacket(typ, 0).MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal packet: %v", err)
+			}
+
+			// Only the type is needed.
+			var got uint16
+			allocs := testing.AllocsPerRun(10, func() {
+				got, err = PeekType(b[:2])
+			})
+			if err != nil {
+				t.Fatalf("failed to peek packet type: %v", err)
+			}
+
+			if diff := cmp.Diff(typ, got); diff != "" {
+				t.Fatalf("unexpected packet type (-want +got):\n%s", diff)
+			}
+
+			if allocs != 0 {
+				t.Fatalf("expected no allocations, but got %v", allocs)
+			}
+		})
+	}
+}
+
+func TestPacketNilReceiver(t *testing.T) {
+	var p *Packet
+
+	if _, err := p.MarshalBinary(); err != errNilPacket {
+		t.Fatalf("expected nil packet error from MarshalBinary, but got: %v", err)
+	}
+
+	if _, err := p.MarshalBinaryTo(make([]byte, 8)); err != errNilPacket {
+		t.Fatalf("expected nil packet error from MarshalBinaryTo, but got: %v", err)
+	}
+
+	b := packetTests[1].b
+
+	if err := p.UnmarshalBinary(b); err != errNilPacket {
+		t.Fatalf("expected nil packet error from UnmarshalBinary, but got: %v", err)
+	}
+
+	if _, err := p.UnmarshalBinaryN(b); err != errNilPacket {
+		t.Fatalf("expected nil packet error from UnmarshalBinaryN, but got: %v", err)
+	}
+
+	if err := p.UnmarshalBinaryStrict(b); err != errNilPacket {
+		t.Fatalf("expected nil packet error from UnmarshalBinaryStrict, but got: %v", err)
+	}
+
+	if err := p.UnmarshalBinaryNoCRC(b); err != errNilPacket {
+		t.Fatalf("expected nil packet error from UnmarshalBinaryNoCRC, but got: %v", err)
+	}
+
+	if err := p.UnmarshalBinaryNoCopy(b); err != errNilPacket {
+		t.Fatalf("expected nil packet error from UnmarshalBinaryNoCopy, but got: %v", err)
+	}
+
+	if _, err := p.UnmarshalBinaryChecked(b); err != errNilPacket {
+		t.Fatalf("expected nil packet error from UnmarshalBinaryChecked, but got: %v", err)
+	}
+}
+
+func TestPacketMaxTags(t *testing.T) {
+	// Build a Packet of zero length Tags, which is the cheapest way to
+	// declare a large number of Tags.
+	tagsPacket := func(n int) []byte {
+		p := NewPacket(libhdhomerun.TypeGetsetRpy, n)
+		for i := 0; i < n; i++ {
+			p.Tags = append(p.Tags, Tag{Type: libhdhomerun.TagGetsetName})
+		}
+
+		b, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal packet: %v", err)
+		}
+
+		return b
+	}
+
+	tests := []struct {
+		name    string
+		d       *Decoder
+		n       int
+		tooMany bool
+	}{
+		{
+			name: "default limit",
+			d:    &Decoder{},
+			n:    DefaultMaxTags,
+		},
+		{
+			name:    "default limit exceeded",
+			d:       &Decoder{},
+			n:       DefaultMaxTags + 1,
+			tooMany: true,
+		},
+		{
+			name: "custom limit",
+			d:    &Decoder{MaxTags: 4},
+			n:    4,
+		},
+		{
+			name:    "custom limit exceeded",
+			d:       &Decoder{MaxTags: 4},
+			n:       5,
+			tooMany: true,
+		},
+		{
+			name: "raised limit",
+			d:    &Decoder{MaxTags: DefaultMaxTags * 2},
+			n:    DefaultMaxTags + 1,
+		},
+		{
+			name:    "negative limit",
+			d:       &Decoder{MaxTags: -1},
+			n:       DefaultMaxTags + 1,
+			tooMany: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tagsPacket(tt.n)
+
+			p, err := tt.d.Decode(b)
+			if tt.tooMany {
+				if err != errTooManyTags {
+					t.Fatalf("expected too many tags error, but got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode packet: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.n, len(p.Tags)); diff != "" {
+				t.Fatalf("unexpected number of tags (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// UnmarshalBinary always applies the default limit.
+	var p Packet
+	if err := p.UnmarshalBinary(tagsPacket(DefaultMaxTags + 1)); err != errTooManyTags {
+		t.Fatalf("expected too many tags error from UnmarshalBinary, but got: %v", err)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	want := &Packet{
+		Type: libhdhomerun.TypeGetsetReq,
+		Tags: []Tag{{
+			Type: libhdhomerun.TagGetsetName,
+			Data: strBytes("/sys/model"),
+		}},
+	}
+
+	good, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal packet: %v", err)
+	}
+
+	bad := append([]byte(nil), good...)
+	bad[len(bad)-1]++
+
+	tests := []struct {
+		name string
+		d    Decoder
+		b    []byte
+		err  error
+	}{
+		{
+			name: "copy, CRC, good",
+			b:    good,
+		},
+		{
+			name: "copy, CRC, bad",
+			b:    bad,
+			err:  errInvalidChecksum,
+		},
+		{
+			name: "copy, no CRC, good",
+			d:    Decoder{NoCRC: true},
+			b:    good,
+		},
+		{
+			name: "copy, no CRC, bad",
+			d:    Decoder{NoCRC: true},
+			b:    bad,
+		},
+		{
+			name: "no copy, CRC, good",
+			d:    Decoder{NoCopy: true},
+			b:    good,
+		},
+		{
+			name: "no copy, CRC, bad",
+			d:    Decoder{NoCopy: true},
+			b:    bad,
+			err:  errInvalidChecksum,
+		},
+		{
+			name: "no copy, no CRC, good",
+			d:    Decoder{NoCopy: true, NoCRC: true},
+			b:    good,
+		},
+		{
+			name: "no copy, no CRC, bad",
+			d:    Decoder{NoCopy: true, NoCRC: true},
+			b:    bad,
+		},
+		{
+			name: "max size",
+			d:    Decoder{MaxSize: len(good)},
+			b:    good,
+		},
+		{
+			name: "max size exceeded",
+			d:    Decoder{MaxSize: len(good) - 1},
+			b:    good,
+			err:  errPacketTooLarge,
+		},
+		{
+			name: "max tags exceeded",
+			d:    Decoder{MaxTags: 1, NoCopy: true, NoCRC: true},
+			b: func() []byte {
+				p := &Packet{Tags: []Tag{{}, {}}}
+				b, _ := p.MarshalBinary()
+				return b
+			}(),
+			err: errTooManyTags,
+		},
+		{
+			name: "short",
+			d:    Decoder{NoCRC: true},
+			b:    good[:len(good)-1],
+			err:  io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Decode a copy of the input so aliasing can be checked.
+			b := append([]byte(nil), tt.b...)
+
+			p, err := tt.d.Decode(b)
+			if err != tt.err {
+				t.Fatalf("unexpected error: want %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(want, p); diff != "" {
+				t.Fatalf("unexpected packet (-want +got):\n%s", diff)
 			}
 
-			return buf.Bytes()
-		}(),
-	},
-	// TODO(mdlayher): tests with large tag values.
+			// Tag data must refer to b only when NoCopy is set.
+			b[6]++
+			aliased := p.Tags[0].Data[0] != want.Tags[0].Data[0]
+			if aliased != tt.d.NoCopy {
+				t.Fatalf("unexpected tag data aliasing: want %v, got %v",
+					tt.d.NoCopy, aliased)
+			}
+		})
+	}
 }
 
-func TestPacketMarshalUnmarshalBinary(t *testing.T) {
+func TestPacketUnmarshalBinaryN(t *testing.T) {
+	// Concatenate every test packet into a single buffer, followed by some
+	// trailing garbage which is not a complete packet.
+	var buf bytes.Buffer
 	for _, tt := range packetTests {
-		t.Run(tt.name, func(t *testing.T) {
-			pb, err := tt.p.MarshalBinary()
-			if err != nil {
-				t.Fatalf("unexpected error marshaling packet: %v", err)
-			}
+		buf.Write(tt.b)
+	}
+	buf.Write([]byte{0xff, 0xff, 0xff})
 
-			if diff := cmp.Diff(tt.b, pb); diff != "" {
-				t.Fatalf("unexpected packet bytes (-want +got):\n%s", diff)
-			}
+	b := buf.Bytes()
+	for _, tt := range packetTests {
+		p := new(Packet)
+		n, err := p.UnmarshalBinaryN(b)
+		if err != nil {
+			t.Fatalf("unexpected error unmarshaling %q packet: %v", tt.name, err)
+		}
 
-			p := new(Packet)
-			if err := p.UnmarshalBinary(pb); err != nil {
-				t.Fatalf("unexpected error unmarshaling packet: %v", err)
-			}
+		if diff := cmp.Diff(len(tt.b), n); diff != "" {
+			t.Fatalf("unexpected %q packet length (-want +got):\n%s", tt.name, diff)
+		}
 
-			if diff := cmp.Diff(tt.p, p); diff != "" {
-				t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+		if diff := diffPackets(tt.p, p); diff != "" {
+			t.Fatalf("unexpected %q packet (-want +got):\n%s", tt.name, diff)
+		}
+
+		b = b[n:]
+	}
+
+	if _, err := new(Packet).UnmarshalBinaryN(b); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected unexpected EOF for trailing bytes, but got: %v", err)
+	}
+}
+
+func TestPacketDedup(t *testing.T) {
+	tests := []struct {
+		name   string
+		tags   []Tag
+		concat []uint8
+		want   []Tag
+	}{
+		{
+			name: "no tags",
+			tags: []Tag{},
+			want: []Tag{},
+		},
+		{
+			name: "no duplicates",
+			tags: []Tag{
+				{Type: 1, Data: []byte{0x01}},
+				{Type: 2, Data: []byte{0x02}},
+			},
+			want: []Tag{
+				{Type: 1, Data: []byte{0x01}},
+				{Type: 2, Data: []byte{0x02}},
+			},
+		},
+		{
+			name: "last wins",
+			tags: []Tag{
+				{Type: 1, Data: []byte{0x01}},
+				{Type: 2, Data: []byte{0x02}},
+				{Type: 1, Data: []byte{0x03}},
+			},
+			want: []Tag{
+				{Type: 1, Data: []byte{0x03}},
+				{Type: 2, Data: []byte{0x02}},
+			},
+		},
+		{
+			name: "concatenate",
+			tags: []Tag{
+				{Type: 1, Data: []byte{0x01}},
+				{Type: 2, Data: []byte{0x02}},
+				{Type: 1, Data: []byte{0x03}},
+				{Type: 2, Data: []byte{0x04}},
+				{Type: 1, Data: []byte{0x05}},
+			},
+			concat: []uint8{1},
+			want: []Tag{
+				{Type: 1, Data: []byte{0x01, 0x03, 0x05}},
+				{Type: 2, Data: []byte{0x04}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Packet{Tags: tt.tags}
+			p.Dedup(tt.concat...)
+
+			if diff := cmp.Diff(tt.want, p.Tags); diff != "" {
+				t.Fatalf("unexpected tags (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
-func TestPacketUnmarshalBinaryError(t *testing.T) {
+// TestNumericTagsBigEndian guards the invariant that every numeric Tag used
+// by this package is big-endian. libhdhomerun encodes all multi-byte integers
+// using hdhomerun_pkt_write_u16 and hdhomerun_pkt_write_u32, which write the
+// most significant byte first, and no Tag defined in hdhomerun_pkt.h is
+// little-endian; only the trailing checksum of a Packet is. New numeric Tag
+// accessors must also be big-endian.
+func TestNumericTagsBigEndian(t *testing.T) {
+	// Asymmetric values which decode differently in each byte order.
+	const u32 = 0x01020304
+	want := []byte{0x01, 0x02, 0x03, 0x04}
+
+	t.Run("device type", func(t *testing.T) {
+		pb := mustDiscoverPacket(DeviceType(u32), []byte{0xff, 0xff, 0xff, 0xff}, 0)
+
+		var p Packet
+		if err := p.UnmarshalBinary(pb); err != nil {
+			t.Fatalf("failed to unmarshal packet: %v", err)
+		}
+
+		if diff := cmp.Diff(want, p.Tags[0].Data); diff != "" {
+			t.Fatalf("unexpected device type tag (-want +got):\n%s", diff)
+		}
+
+		p.Type = libhdhomerun.TypeDiscoverRpy
+		d, err := newDiscoveredDevice("", p)
+		if err != nil {
+			t.Fatalf("failed to parse device: %v", err)
+		}
+
+		if diff := cmp.Diff(DeviceType(u32), d.Type); diff != "" {
+			t.Fatalf("unexpected device type (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("lock key", func(t *testing.T) {
+		c := &Client{lockkey: u32}
+
+		var p Packet
+		c.addLockKey(&p)
+
+		if diff := cmp.Diff(want, p.Tags[0].Data); diff != "" {
+			t.Fatalf("unexpected lock key tag (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		pb, err := (&Packet{Type: 0x0102}).MarshalBinary()
+		if err != nil {
+			t.Fatalf("failed to marshal packet: %v", err)
+		}
+
+		// Type and length; the checksum is the only little-endian field.
+		if diff := cmp.Diff([]byte{0x01, 0x02, 0x00, 0x00}, pb[:4]); diff != "" {
+			t.Fatalf("unexpected packet header (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestPacketString(t *testing.T) {
 	tests := []struct {
 		name string
-		b    []byte
-		err  error
+		p    *Packet
+		s    string
 	}{
+		{
+			name: "nil",
+			s:    "<nil>",
+		},
 		{
 			name: "empty",
-			err:  io.ErrUnexpectedEOF,
+			p:    &Packet{Type: 0x0009},
+			s:    "Packet{Type: 0x0009, Tags: []}",
 		},
 		{
-			name: "short",
-			b:    bytes.Repeat([]byte{0x00}, 7),
-			err:  io.ErrUnexpectedEOF,
+			name: "getset",
+			p: &Packet{
+				Type: libhdhomerun.TypeGetsetReq,
+				Tags: []Tag{
+					{
+						Type: libhdhomerun.TagGetsetName,
+						Data: strBytes("/sys/model"),
+					},
+					{
+						Type: libhdhomerun.TagGetsetValue,
+						Data: strBytes("hdhomerun4_atsc"),
+					},
+					{
+						Type: libhdhomerun.TagGetsetLockkey,
+						Data: []byte{0x00, 0x00, 0x04, 0xd2},
+					},
+				},
+			},
+			s: `Packet{Type: getset request, Tags: [getset name: "/sys/model", getset value: "hdhomerun4_atsc", getset lockkey: 1234]}`,
 		},
 		{
-			name: "checksum",
-			b:    bytes.Repeat([]byte{0x00}, 8),
-			err:  errInvalidChecksum,
+			name: "mixed",
+			p: &Packet{
+				Type: libhdhomerun.TypeDiscoverRpy,
+				Tags: []Tag{
+					{
+						Type: libhdhomerun.TagDeviceType,
+						Data: []byte{0x00, 0x00, 0x00, 0x01},
+					},
+					{
+						Type: libhdhomerun.TagDeviceId,
+						Data: []byte{0xde, 0xad, 0xbe, 0xef},
+					},
+					{
+						Type: libhdhomerun.TagTunerCount,
+						Data: []byte{0x02},
+					},
+					{
+						Type: libhdhomerun.TagBaseUrl,
+						Data: []byte("http://192.168.1.10:80"),
+					},
+					{
+						Type: libhdhomerun.TagErrorMessage,
+						Data: strBytes("unknown getset variable"),
+					},
+					{
+						// Malformed: too long for a tuner count.
+						Type: libhdhomerun.TagTunerCount,
+						Data: []byte{0x00, 0x02},
+					},
+					{
+						Type: 0x99,
+						Data: []byte{0x0a, 0x0b},
+					},
+				},
+			},
+			s: `Packet{Type: discover reply, Tags: [device type: 1, device ID: deadbeef, tuner count: 2, base URL: "http://192.168.1.10:80", error message: "unknown getset variable", tuner count: 0002, 0x99: 0a0b]}`,
 		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.s, tt.p.String()); diff != "" {
+				t.Fatalf("unexpected packet string (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTagStringN(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		trim, keep string
+	}{
 		{
-			name: "fuzz",
-			b:    []byte("\x1dx˩\xd5D\xd5D\xf3e;\xbe\x1c\xc3F\xbe"),
-			err:  io.ErrUnexpectedEOF,
+			name: "empty",
 		},
 		{
-			name: "fuzz",
-			b:    []byte("11\x98\xd3\x14\x06R;Q"),
-			err:  io.ErrUnexpectedEOF,
+			name: "trailing NUL",
+			data: []byte("hdhomerun5_atsc\x00"),
+			trim: "hdhomerun5_atsc",
+			keep: "hdhomerun5_atsc\x00",
 		},
 		{
-			name: "fuzz",
-			b:    []byte("reQl\x00\x00\x01\x00V\x00\x80\a\xaf\xaep\xff\xee"),
-			err:  io.ErrUnexpectedEOF,
+			name: "no NUL",
+			data: []byte("hdhomerun5_atsc"),
+			trim: "hdhomerun5_atsc",
+			keep: "hdhomerun5_atsc",
 		},
 		{
-			name: "fuzz",
-			b:    []byte("\xa8\xd9\x00\x00\x10\x00\\f\xbfｿD\x1e\xa2\x8d"),
-			err:  io.ErrUnexpectedEOF,
+			name: "internal NUL",
+			data: []byte("foo\x00bar\x00"),
+			trim: "foo\x00bar",
+			keep: "foo\x00bar\x00",
+		},
+		{
+			name: "two trailing NULs",
+			data: []byte("foo\x00\x00"),
+			trim: "foo\x00",
+			keep: "foo\x00\x00",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := new(Packet)
-			err := p.UnmarshalBinary(tt.b)
+			tag := Tag{
+				Type: libhdhomerun.TagGetsetValue,
+				Data: tt.data,
+			}
 
-			if want, got := tt.err, err; !reflect.DeepEqual(want, got) {
-				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v", want, got)
+			if diff := cmp.Diff(tt.trim, tag.StringN(true)); diff != "" {
+				t.Fatalf("unexpected trimmed string (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.keep, tag.StringN(false)); diff != "" {
+				t.Fatalf("unexpected untrimmed string (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_checksum(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The default table must produce the checksums of the expected
+			// packet bytes.
+			want := binary.LittleEndian.Uint32(tt.b[len(tt.b)-4:])
+			if diff := cmp.Diff(want, checksum(tt.b[:len(tt.b)-4])); diff != "" {
+				t.Fatalf("unexpected checksum (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// A different table must be used by both marshaling and unmarshaling.
+	table := crcTable
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+	defer func() { crcTable = table }()
+
+	p := packetTests[1].p
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	if bytes.Equal(packetTests[1].b, pb) {
+		t.Fatal("expected a different checksum with the Castagnoli table")
+	}
+
+	if err := new(Packet).UnmarshalBinary(pb); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if err := new(Packet).UnmarshalBinary(packetTests[1].b); err != errInvalidChecksum {
+		t.Fatalf("expected invalid checksum with IEEE bytes, but got: %v", err)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	for _, tt := range packetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			length := len(tt.b) - 4
+
+			if err := VerifyChecksum(tt.b); err != nil {
+				t.Fatalf("failed to verify checksum: %v", err)
+			}
+			if err := VerifyChecksumReader(bytes.NewReader(tt.b), length); err != nil {
+				t.Fatalf("failed to verify checksum from reader: %v", err)
+			}
+
+			bad := make([]byte, len(tt.b))
+			copy(bad, tt.b)
+			bad[len(bad)-1]++
+
+			if err := VerifyChecksum(bad); err != errInvalidChecksum {
+				t.Fatalf("expected invalid checksum error, but got: %v", err)
+			}
+			if err := VerifyChecksumReader(bytes.NewReader(bad), length); err != errInvalidChecksum {
+				t.Fatalf("expected invalid checksum error from reader, but got: %v", err)
+			}
+
+			// Short input at every possible truncation point.
+			for i := 0; i < len(tt.b); i++ {
+				if err := VerifyChecksumReader(bytes.NewReader(tt.b[:i]), length); err != io.ErrUnexpectedEOF {
+					t.Fatalf("expected unexpected EOF for %d bytes, but got: %v", i, err)
+				}
 			}
 		})
 	}
+
+	if err := VerifyChecksum([]byte{0x00, 0x00, 0x00}); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected unexpected EOF, but got: %v", err)
+	}
+	if err := VerifyChecksumReader(bytes.NewReader(nil), -1); err == nil {
+		t.Fatal("expected an error for negative length, but none occurred")
+	}
 }
 
 func Test_readWriteTagLength(t *testing.T) {
@@ -271,8 +2092,145 @@ func Test_readWriteTagLengthBufferError(t *testing.T) {
 	}
 }
 
+func Test_diffPackets(t *testing.T) {
+	a := &Packet{
+		Type: libhdhomerun.TypeGetsetRpy,
+		Tags: []Tag{
+			{
+				Type: libhdhomerun.TagGetsetName,
+				Data: []byte{0xaa},
+			},
+			{
+				Type: libhdhomerun.TagGetsetValue,
+				Data: []byte{0xbb, 0xcc},
+			},
+		},
+	}
+
+	if diff := diffPackets(a, a); diff != "" {
+		t.Fatalf("expected no difference for identical packets, but got:\n%s", diff)
+	}
+
+	b := &Packet{
+		Type: libhdhomerun.TypeGetsetReq,
+		Tags: []Tag{
+			a.Tags[0],
+			{
+				Type: libhdhomerun.TagGetsetValue,
+				Data: []byte{0xbb, 0xdd},
+			},
+			{
+				Type: 0xff,
+				Data: []byte{},
+			},
+		},
+	}
+
+	want := strings.Join([]string{
+		"- type: 0x0005",
+		"+ type: 0x0004",
+		"  tag 0: getset name (0x03), length 1, data aa",
+		"- tag 1: getset value (0x04), length 2, data bbcc",
+		"+ tag 1: getset value (0x04), length 2, data bbdd",
+		"+ tag 2: unknown (0xff), length 0, data empty",
+		"",
+	}, "\n")
+
+	if diff := cmp.Diff(want, diffPackets(a, b)); diff != "" {
+		t.Fatalf("unexpected packet diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewPacket(t *testing.T) {
+	tests := []struct {
+		name   string
+		tagCap int
+		cap    int
+	}{
+		{
+			name:   "negative",
+			tagCap: -1,
+		},
+		{
+			name: "zero",
+		},
+		{
+			name:   "hint",
+			tagCap: 4,
+			cap:    4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPacket(libhdhomerun.TypeGetsetReq, tt.tagCap)
+
+			if diff := cmp.Diff(libhdhomerun.TypeGetsetReq, int(p.Type)); diff != "" {
+				t.Fatalf("unexpected packet type (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(0, len(p.Tags)); diff != "" {
+				t.Fatalf("unexpected number of tags (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.cap, cap(p.Tags)); diff != "" {
+				t.Fatalf("unexpected tags capacity (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func BenchmarkNewPacket(b *testing.B) {
+	const n = 16
+	tag := Tag{
+		Type: libhdhomerun.TagGetsetName,
+		Data: []byte("/test"),
+	}
+
+	for _, tagCap := range []int{0, n} {
+		b.Run(fmt.Sprintf("cap %d", tagCap), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p := NewPacket(libhdhomerun.TypeGetsetReq, tagCap)
+				for j := 0; j < n; j++ {
+					p.Tags = append(p.Tags, tag)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkPacketMarshalBinary(b *testing.B) {
-	for _, bb := range packetTests {
+	// Also benchmark a packet with many tags, which stresses the tag counting
+	// pass in MarshalBinary.
+	many := &Packet{
+		Type: 4,
+		Tags: make([]Tag, 64),
+	}
+	for i := range many.Tags {
+		many.Tags[i] = Tag{
+			Type: 3,
+			Data: []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		}
+	}
+
+	bbs := []struct {
+		name string
+		p    *Packet
+	}{{
+		name: "many tags",
+		p:    many,
+	}}
+
+	for _, tt := range packetTests {
+		bbs = append(bbs, struct {
+			name string
+			p    *Packet
+		}{
+			name: tt.name,
+			p:    tt.p,
+		})
+	}
+
+	for _, bb := range bbs {
 		b.Run(bb.name, func(b *testing.B) {
 			b.ReportAllocs()
 			for i := 0; i < b.N; i++ {
@@ -284,6 +2242,43 @@ func BenchmarkPacketMarshalBinary(b *testing.B) {
 	}
 }
 
+func BenchmarkVerifyChecksum(b *testing.B) {
+	// A maximum size packet, such as a channel lineup.
+	pb, err := (&Packet{
+		Type: libhdhomerun.TypeGetsetRpy,
+		Tags: []Tag{{
+			Type: libhdhomerun.TagGetsetValue,
+			Data: make([]byte, libhdhomerun.MaxPayloadSize-3),
+		}},
+	}).MarshalBinary()
+	if err != nil {
+		b.Fatalf("failed to marshal: %v", err)
+	}
+
+	b.Run("buffer", func(b *testing.B) {
+		b.SetBytes(int64(len(pb)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := VerifyChecksum(pb); err != nil {
+				b.Fatalf("failed to verify: %v", err)
+			}
+		}
+	})
+
+	b.Run("reader", func(b *testing.B) {
+		r := bytes.NewReader(pb)
+
+		b.SetBytes(int64(len(pb)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			r.Reset(pb)
+			if err := VerifyChecksumReader(r, len(pb)-4); err != nil {
+				b.Fatalf("failed to verify: %v", err)
+			}
+		}
+	})
+}
+
 func BenchmarkPacketUnmarshalBinary(b *testing.B) {
 	for _, bb := range packetTests {
 		b.Run(bb.name, func(b *testing.B) {
@@ -297,3 +2292,136 @@ func BenchmarkPacketUnmarshalBinary(b *testing.B) {
 		})
 	}
 }
+
+func BenchmarkPacketUnmarshalBinaryNoCopy(b *testing.B) {
+	// Data larger than 127 bytes requires a two byte tag length.
+	sizes := []struct {
+		name string
+		n    int
+	}{
+		{name: "small", n: 8},
+		{name: "large", n: 200},
+	}
+
+	for _, tags := range []int{1, 10, 100} {
+		for _, size := range sizes {
+			p := NewPacket(libhdhomerun.TypeGetsetRpy, tags)
+			for i := 0; i < tags; i++ {
+				p.Tags = append(p.Tags, Tag{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: bytes.Repeat([]byte{'a'}, size.n),
+				})
+			}
+
+			pb, err := p.MarshalBinary()
+			if err != nil {
+				b.Fatalf("failed to marshal: %v", err)
+			}
+
+			name := fmt.Sprintf("%d tags %s", tags, size.name)
+
+			b.Run(name+" copy", func(b *testing.B) {
+				var p Packet
+				b.SetBytes(int64(len(pb)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := p.UnmarshalBinary(pb); err != nil {
+						b.Fatalf("failed to unmarshal: %v", err)
+					}
+				}
+			})
+
+			b.Run(name+" nocopy", func(b *testing.B) {
+				var p Packet
+				b.SetBytes(int64(len(pb)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := p.UnmarshalBinaryNoCopy(pb); err != nil {
+						b.Fatalf("failed to unmarshal: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// diffPackets produces a readable, tag-by-tag diff of two Packets, or an
+// empty string if they are identical. Lines prefixed with "-" are from want,
+// and lines prefixed with "+" are from got.
+func diffPackets(want, got *Packet) string {
+	if want == nil || got == nil {
+		if want == got {
+			return ""
+		}
+
+		return fmt.Sprintf("- packet: %v\n+ packet: %v\n", want, got)
+	}
+
+	var (
+		buf  bytes.Buffer
+		diff bool
+	)
+
+	if want.Type != got.Type {
+		diff = true
+		fmt.Fprintf(&buf, "- type: %#04x\n+ type: %#04x\n", want.Type, got.Type)
+	}
+
+	if (want.Tags == nil) != (got.Tags == nil) {
+		diff = true
+		fmt.Fprintf(&buf, "- tags nil: %v\n+ tags nil: %v\n", want.Tags == nil, got.Tags == nil)
+	}
+
+	n := len(want.Tags)
+	if len(got.Tags) > n {
+		n = len(got.Tags)
+	}
+
+	for i := 0; i < n; i++ {
+		var w, g string
+		if i < len(want.Tags) {
+			w = formatTestTag(i, want.Tags[i])
+		}
+		if i < len(got.Tags) {
+			g = formatTestTag(i, got.Tags[i])
+		}
+
+		switch {
+		case w == g:
+			fmt.Fprintf(&buf, "  %s\n", w)
+			continue
+		case w == "":
+			fmt.Fprintf(&buf, "+ %s\n", g)
+		case g == "":
+			fmt.Fprintf(&buf, "- %s\n", w)
+		default:
+			fmt.Fprintf(&buf, "- %s\n+ %s\n", w, g)
+		}
+
+		diff = true
+	}
+
+	if !diff {
+		return ""
+	}
+
+	return buf.String()
+}
+
+// formatTestTag formats a Tag at index i for diffPackets.
+func formatTestTag(i int, t Tag) string {
+	name, ok := tagNames[t.Type]
+	if !ok {
+		name = "unknown"
+	}
+
+	data := hex.EncodeToString(t.Data)
+	switch {
+	case t.Data == nil:
+		data = "nil"
+	case len(t.Data) == 0:
+		data = "empty"
+	}
+
+	return fmt.Sprintf("tag %d: %s (%#02x), length %d, data %s", i, name, t.Type, len(t.Data), data)
+}
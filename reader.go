@@ -0,0 +1,159 @@
+package hdhomerun
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+)
+
+// A Reader reads Packets from a stream, such as a TCP connection to an
+// HDHomeRun device.
+//
+// A Reader's read methods must not be called concurrently, but Stats may be
+// called concurrently with them.
+type Reader struct {
+	// Statistics, accessed atomically. Kept first for 64-bit alignment on
+	// 32-bit platforms.
+	packets, bytes, checksumErrors, truncated uint64
+
+	r *bufio.Reader
+}
+
+// ReaderStats contains statistics about the Packets read by a Reader, which
+// can be used to diagnose the quality of a link to a device.
+type ReaderStats struct {
+	// PacketsRead is the number of Packets successfully read.
+	PacketsRead uint64
+
+	// BytesRead is the number of bytes read from the stream, including the
+	// bytes of Packets which could not be decoded.
+	BytesRead uint64
+
+	// ChecksumErrors is the number of Packets discarded due to an invalid
+	// checksum.
+	ChecksumErrors uint64
+
+	// TruncatedReads is the number of Packets cut short by the end of the
+	// stream.
+	TruncatedReads uint64
+}
+
+// Stats returns statistics about the Packets read by the Reader so far.
+func (r *Reader) Stats() ReaderStats {
+	return ReaderStats{
+		PacketsRead:    atomic.LoadUint64(&r.packets),
+		BytesRead:      atomic.LoadUint64(&r.bytes),
+		ChecksumErrors: atomic.LoadUint64(&r.checksumErrors),
+		TruncatedReads: atomic.LoadUint64(&r.truncated),
+	}
+}
+
+// NewReader creates a Reader which reads Packets from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// NewReaderSize creates a Reader which reads Packets from r, and buffers
+// at least size bytes from r at a time.
+func NewReaderSize(r io.Reader, size int) *Reader {
+	return &Reader{
+		r: bufio.NewReaderSize(r, size),
+	}
+}
+
+// ReadPacket reads a single Packet from the stream.
+//
+// If the stream ends cleanly on a Packet boundary, ReadPacket returns io.EOF.
+// If the stream ends partway through a Packet, ReadPacket returns
+// io.ErrUnexpectedEOF.
+func (r *Reader) ReadPacket() (*Packet, error) {
+	return r.readPacket(true)
+}
+
+// ReadPacketNoCRC is like ReadPacket, but it reads Packets from a stream which
+// omits the trailing checksum of each Packet entirely, such as a capture which
+// dropped the checksums. Packets are framed using only their declared length,
+// and no checksum is verified.
+//
+// ReadPacketNoCRC is unsafe for use with live network traffic, because
+// corrupted Packets will be decoded without error. It is intended only for
+// replaying captures.
+func (r *Reader) ReadPacketNoCRC() (*Packet, error) {
+	return r.readPacket(false)
+}
+
+// readPacket reads a single Packet from the stream, which includes a
+// checksum if crc is true, and updates the Reader's statistics.
+func (r *Reader) readPacket(crc bool) (*Packet, error) {
+	p, n, err := r.read(crc)
+	atomic.AddUint64(&r.bytes, uint64(n))
+
+	switch err {
+	case nil:
+		atomic.AddUint64(&r.packets, 1)
+	case errInvalidChecksum:
+		atomic.AddUint64(&r.checksumErrors, 1)
+	case io.ErrUnexpectedEOF:
+		atomic.AddUint64(&r.truncated, 1)
+	}
+
+	return p, err
+}
+
+// read reads a single Packet from the stream, which includes a checksum if
+// crc is true. It returns the number of bytes read from the stream, even if
+// an error occurs.
+func (r *Reader) read(crc bool) (*Packet, int, error) {
+	// Read the type and length header to determine how many more bytes
+	// make up this Packet. io.ReadFull returns io.EOF only if no bytes
+	// were read at all.
+	var hdr [4]byte
+	n, err := io.ReadFull(r.r, hdr[:])
+	if err != nil {
+		return nil, n, err
+	}
+
+	length := int(binary.BigEndian.Uint16(hdr[2:4]))
+
+	// Always leave room for a checksum, so the Packet can be decoded the
+	// same way whether or not the stream contains one.
+	b := make([]byte, 2+2+length+4)
+	copy(b, hdr[:])
+
+	body := b[4:]
+	if !crc {
+		body = b[4 : len(b)-4]
+	}
+
+	// Any EOF at this point means the Packet was truncated.
+	nn, err := io.ReadFull(r.r, body)
+	n += nn
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, n, err
+	}
+
+	// The Packet was framed using its own header, so its length needs no
+	// further validation. Only verify the checksum, if present, before
+	// decoding.
+	if crc {
+		if err := VerifyChecksum(b); err != nil {
+			return nil, n, err
+		}
+	}
+
+	// b was allocated for this Packet alone, so its Tags can refer to b
+	// directly rather than to a copy.
+	p := new(Packet)
+	if err := p.decodeTags(b, true, DefaultMaxTags); err != nil {
+		return nil, n, err
+	}
+
+	return p, n, nil
+}
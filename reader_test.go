@@ -0,0 +1,202 @@
+package hdhomerun
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/joydip/hdhomerun/internal/libhdhomerun"
+)
+
+func TestReaderReadPacket(t *testing.T) {
+	// Concatenate every test packet into a single stream.
+	var buf bytes.Buffer
+	for _, tt := range packetTests {
+		buf.Write(tt.b)
+	}
+
+	r := NewReader(&buf)
+	for _, tt := range packetTests {
+		p, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("failed to read %q packet: %v", tt.name, err)
+		}
+
+		if diff := diffPackets(tt.p, p); diff != "" {
+			t.Fatalf("unexpected %q packet (-want +got):\n%s", tt.name, diff)
+		}
+	}
+
+	// The stream ended cleanly on a packet boundary.
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Fatalf("expected io.EOF, but got: %v", err)
+	}
+}
+
+func TestReaderReadPacketNoCRC(t *testing.T) {
+	// Concatenate every test packet into a single stream, dropping each
+	// packet's checksum as some capture tools do.
+	var buf bytes.Buffer
+	for _, tt := range packetTests {
+		buf.Write(tt.b[:len(tt.b)-4])
+	}
+
+	r := NewReader(&buf)
+	for _, tt := range packetTests {
+		p, err := r.ReadPacketNoCRC()
+		if err != nil {
+			t.Fatalf("failed to read %q packet: %v", tt.name, err)
+		}
+
+		if diff := diffPackets(tt.p, p); diff != "" {
+			t.Fatalf("unexpected %q packet (-want +got):\n%s", tt.name, diff)
+		}
+	}
+
+	if _, err := r.ReadPacketNoCRC(); err != io.EOF {
+		t.Fatalf("expected io.EOF, but got: %v", err)
+	}
+
+	// The declared length must not exceed the available bytes.
+	b := packetTests[2].b
+	r = NewReader(bytes.NewReader(b[:len(b)-5]))
+	if _, err := r.ReadPacketNoCRC(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected unexpected EOF, but got: %v", err)
+	}
+}
+
+func TestReaderReadPacketError(t *testing.T) {
+	// Use the "two tags" packet as the basis for truncated streams.
+	b := packetTests[2].b
+
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{
+			name: "clean close",
+			err:  io.EOF,
+		},
+		{
+			name: "partial header",
+			b:    b[:2],
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "header only",
+			b:    b[:4],
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "partial tags",
+			b:    b[:9],
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "partial checksum",
+			b:    b[:len(b)-1],
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "checksum",
+			b:    append(append([]byte(nil), b[:len(b)-1]...), 0x00),
+			err:  errInvalidChecksum,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(tt.b)).ReadPacket()
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v", want, got)
+			}
+		})
+	}
+}
+
+func TestReaderStats(t *testing.T) {
+	good := packetTests[2].b
+
+	bad := make([]byte, len(good))
+	copy(bad, good)
+	bad[len(bad)-1]++
+
+	// Two good packets, a corrupted one which can be skipped, another good
+	// one, and then a truncated one.
+	var buf bytes.Buffer
+	for _, b := range [][]byte{good, good, bad, good, good[:len(good)-2]} {
+		buf.Write(b)
+	}
+	total := buf.Len()
+
+	r := NewReader(&buf)
+	var errs []error
+	for {
+		_, err := r.ReadPacket()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if diff := cmp.Diff(1, len(errs)); diff != "" {
+		t.Fatalf("unexpected number of errors (-want +got):\n%s", diff)
+	}
+
+	want := ReaderStats{
+		PacketsRead:    3,
+		BytesRead:      uint64(total),
+		ChecksumErrors: 1,
+		TruncatedReads: 1,
+	}
+
+	if diff := cmp.Diff(want, r.Stats()); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	// A clean end of stream does not change any statistics.
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Fatalf("expected io.EOF, but got: %v", err)
+	}
+
+	if diff := cmp.Diff(want, r.Stats()); diff != "" {
+		t.Fatalf("unexpected stats after EOF (-want +got):\n%s", diff)
+	}
+}
+
+func BenchmarkReaderReadPacket(b *testing.B) {
+	// Data larger than 127 bytes requires a two byte tag length.
+	for _, n := range []int{8, 200} {
+		p := NewPacket(libhdhomerun.TypeGetsetRpy, 10)
+		for i := 0; i < 10; i++ {
+			p.Tags = append(p.Tags, Tag{
+				Type: libhdhomerun.TagGetsetValue,
+				Data: bytes.Repeat([]byte{'a'}, n),
+			})
+		}
+
+		pb, err := p.MarshalBinary()
+		if err != nil {
+			b.Fatalf("failed to marshal: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("%d bytes", len(pb)), func(b *testing.B) {
+			br := bytes.NewReader(pb)
+			r := NewReader(br)
+
+			b.SetBytes(int64(len(pb)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				br.Reset(pb)
+				if _, err := r.ReadPacket(); err != nil {
+					b.Fatalf("failed to read packet: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package hdhomerun
+
+import (
+	"io"
+	"path"
+	"sync"
+)
+
+// A ReconnectingClient is a Client which transparently reconnects to an
+// HDHomeRun device when its connection is dropped, such as when the device
+// restarts or a network path is briefly interrupted. It is intended for long
+// running programs which hold a connection to a device for an extended
+// period. ReconnectingClients are safe for concurrent use.
+//
+// When a request fails because the connection was dropped, the
+// ReconnectingClient dials the device again, restores its lock key and any
+// tuner locks it acquired using Set, and retries the request once. If the
+// retry also fails, its error is returned.
+type ReconnectingClient struct {
+	addr        string
+	options     []ClientOption
+	onReconnect func(err error)
+
+	mu      sync.Mutex
+	c       *Client
+	lockkey uint32
+
+	// If not nil, the error which dropped the connection, when a previous
+	// reconnection attempt failed.
+	dropped error
+
+	// Tuner lock resources set by this client, and their values.
+	locks map[string]string
+}
+
+// DialReconnecting dials a TCP connection to an HDHomeRun device, and returns
+// a ReconnectingClient which uses the input options each time it connects.
+//
+// If onReconnect is not nil, it is invoked after each successful reconnection
+// with the error which caused the connection to be dropped. It is invoked
+// before the request which triggered the reconnection returns, and may
+// itself use the ReconnectingClient.
+func DialReconnecting(addr string, onReconnect func(err error), options ...ClientOption) (*ReconnectingClient, error) {
+	c, err := Dial(addr, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReconnectingClient{
+		addr:        addr,
+		options:     options,
+		onReconnect: onReconnect,
+		c:           c,
+		locks:       make(map[string]string),
+	}, nil
+}
+
+// SetLockKey sets the lock key sent with each set request. See
+// Client.SetLockKey for details.
+func (rc *ReconnectingClient) SetLockKey(key uint32) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.lockkey = key
+	rc.c.SetLockKey(key)
+}
+
+// Query performs a read-only query. See Client.Query for details.
+func (rc *ReconnectingClient) Query(query string) ([]byte, error) {
+	return rc.do(func(c *Client) ([]byte, error) {
+		return c.Query(query)
+	})
+}
+
+// Set sets a value. See Client.Set for details.
+//
+// If name is the lock key of a tuner, such as "/tuner0/lockkey", the lock is
+// acquired again after any subsequent reconnection, until it is released by
+// setting the lock key to "none".
+//
+// Like any other request, a Set which fails because the connection was
+// dropped is sent again after reconnecting. The device may have applied the
+// first Set before the connection was dropped, so Set should not be used for
+// values which must not be set twice, such as "/sys/restart".
+func (rc *ReconnectingClient) Set(name, value string) ([]byte, error) {
+	return rc.do(func(c *Client) ([]byte, error) {
+		b, err := c.Set(name, value)
+		if err != nil {
+			return nil, err
+		}
+
+		if path.Base(name) == "lockkey" {
+			switch value {
+			case "none", "force":
+				delete(rc.locks, name)
+			default:
+				rc.locks[name] = value
+			}
+		}
+
+		return b, nil
+	})
+}
+
+// Close closes the ReconnectingClient's current connection.
+func (rc *ReconnectingClient) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return rc.c.Close()
+}
+
+// do invokes fn with the current Client, and reconnects and retries fn once
+// if the connection was dropped. The onReconnect callback is invoked for
+// each reconnection once rc.mu is released, so that it may use rc.
+func (rc *ReconnectingClient) do(fn func(c *Client) ([]byte, error)) ([]byte, error) {
+	b, causes, err := rc.doLocked(fn)
+
+	if rc.onReconnect != nil {
+		for _, cause := range causes {
+			rc.onReconnect(cause)
+		}
+	}
+
+	return b, err
+}
+
+// doLocked implements do while holding rc.mu, and returns the cause of each
+// successful reconnection.
+func (rc *ReconnectingClient) doLocked(fn func(c *Client) ([]byte, error)) ([]byte, []error, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	var causes []error
+
+	// A previous reconnection attempt failed, so try again before issuing
+	// the request.
+	if rc.dropped != nil {
+		cause := rc.dropped
+		if err := rc.reconnect(cause); err != nil {
+			return nil, causes, err
+		}
+		causes = append(causes, cause)
+	}
+
+	b, err := fn(rc.c)
+	if err == nil || !isConnDropped(err) {
+		return b, causes, err
+	}
+
+	if rerr := rc.reconnect(err); rerr != nil {
+		return nil, causes, rerr
+	}
+	causes = append(causes, err)
+
+	b, err = fn(rc.c)
+	return b, causes, err
+}
+
+// reconnect replaces the current Client with a new connection to the device,
+// restoring its lock key and tuner locks. rc.mu must be held.
+func (rc *ReconnectingClient) reconnect(cause error) error {
+	_ = rc.c.Close()
+	rc.dropped = cause
+
+	c, err := Dial(rc.addr, rc.options...)
+	if err != nil {
+		return err
+	}
+
+	c.SetLockKey(rc.lockkey)
+	for name, value := range rc.locks {
+		if _, err := c.Set(name, value); err != nil {
+			_ = c.Close()
+			return err
+		}
+	}
+
+	rc.c = c
+	rc.dropped = nil
+
+	return nil
+}
+
+// isConnDropped determines if err indicates that a connection was dropped
+// while sending a request or reading its reply.
+func isConnDropped(err error) bool {
+	return err == io.ErrUnexpectedEOF || isConnClosed(err)
+}
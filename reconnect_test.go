@@ -0,0 +1,213 @@
+package hdhomerun
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/joydip/hdhomerun/internal/libhdhomerun"
+)
+
+func TestReconnectingClient(t *testing.T) {
+	// The device drops the first connection when it receives a query for
+	// "/drop".
+	addr, requests, done := testReconnectingDevice(t, func(conn int, name string) bool {
+		return conn == 0 && name == "/drop"
+	})
+	defer done()
+
+	var reconnects int
+	rc, err := DialReconnecting(addr, func(err error) {
+		reconnects++
+	})
+	if err != nil {
+		t.Fatalf("failed to dial device: %v", err)
+	}
+	defer rc.Close()
+
+	rc.SetLockKey(1234)
+
+	if _, err := rc.Set("/tuner0/lockkey", "1234"); err != nil {
+		t.Fatalf("failed to lock tuner: %v", err)
+	}
+
+	// The query is retried on the second connection.
+	if _, err := rc.Query("/drop"); err != nil {
+		t.Fatalf("failed to query after reconnect: %v", err)
+	}
+
+	if diff := cmp.Diff(1, reconnects); diff != "" {
+		t.Fatalf("unexpected number of reconnects (-want +got):\n%s", diff)
+	}
+
+	want := []string{
+		"0 /tuner0/lockkey=1234 (lock 1234)",
+		"0 /drop",
+		// The lock is acquired again before the query is retried.
+		"1 /tuner0/lockkey=1234 (lock 1234)",
+		"1 /drop",
+	}
+
+	if diff := cmp.Diff(want, requests()); diff != "" {
+		t.Fatalf("unexpected requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestReconnectingClientRetryOnce(t *testing.T) {
+	// The device drops every connection.
+	addr, requests, done := testReconnectingDevice(t, func(_ int, _ string) bool {
+		return true
+	})
+	defer done()
+
+	rc, err := DialReconnecting(addr, nil)
+	if err != nil {
+		t.Fatalf("failed to dial device: %v", err)
+	}
+	defer rc.Close()
+
+	if _, err := rc.Query("/drop"); !isConnDropped(err) {
+		t.Fatalf("expected a dropped connection error, but got: %v", err)
+	}
+
+	// One request on the original connection, and one retry.
+	want := []string{"0 /drop", "1 /drop"}
+
+	if diff := cmp.Diff(want, requests()); diff != "" {
+		t.Fatalf("unexpected requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestReconnectingClientCallbackQuery(t *testing.T) {
+	// The device drops the first connection when it receives a query for
+	// "/drop".
+	addr, requests, done := testReconnectingDevice(t, func(conn int, name string) bool {
+		return conn == 0 && name == "/drop"
+	})
+	defer done()
+
+	// The callback uses the client, which must not deadlock.
+	var rc *ReconnectingClient
+	rc, err := DialReconnecting(addr, func(_ error) {
+		if _, err := rc.Query("/callback"); err != nil {
+			panicf("failed to query from callback: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to dial device: %v", err)
+	}
+	defer rc.Close()
+
+	if _, err := rc.Query("/drop"); err != nil {
+		t.Fatalf("failed to query after reconnect: %v", err)
+	}
+
+	want := []string{"0 /drop", "1 /drop", "1 /callback"}
+
+	if diff := cmp.Diff(want, requests()); diff != "" {
+		t.Fatalf("unexpected requests (-want +got):\n%s", diff)
+	}
+}
+
+// testReconnectingDevice creates a listener that emulates an HDHomeRun
+// device which accepts any number of connections, and echoes the name of
+// each get/set request as its value. If drop returns true for a request, the
+// connection is closed instead of replying. It returns the device's address,
+// and a function which returns a description of each request received.
+// Invoke the done closure to clean up resources.
+func testReconnectingDevice(t *testing.T, drop func(conn int, name string) bool) (string, func() []string, func()) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to start TCP listener: %v", err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		reqs []string
+	)
+
+	record := func(conn int, req *Packet) string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var name, value, lock string
+		for _, t := range req.Tags {
+			switch t.Type {
+			case libhdhomerun.TagGetsetName:
+				name = bytesStr(t.Data)
+			case libhdhomerun.TagGetsetValue:
+				value = "=" + bytesStr(t.Data)
+			case libhdhomerun.TagGetsetLockkey:
+				lock = " (lock " + formatTagData(t) + ")"
+			}
+		}
+
+		reqs = append(reqs, fmt.Sprintf("%d %s%s%s", conn, name, value, lock))
+		return name
+	}
+
+	handle := func(conn int, c net.Conn) {
+		defer c.Close()
+
+		r := NewReader(c)
+		for {
+			req, err := r.ReadPacket()
+			if err != nil {
+				if err == io.EOF || strings.Contains(err.Error(), "use of closed network connection") {
+					return
+				}
+
+				panicf("failed to read request: %v", err)
+			}
+
+			if drop(conn, record(conn, req)) {
+				return
+			}
+
+			res, _ := echoQuery(req)
+			pb, err := res.MarshalBinary()
+			if err != nil {
+				panicf("failed to marshal response: %v", err)
+			}
+
+			if _, err := c.Write(pb); err != nil {
+				panicf("failed to write response: %v", err)
+			}
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := 0; ; i++ {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				handle(i, c)
+			}(i)
+		}
+	}()
+
+	requests := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), reqs...)
+	}
+
+	return l.Addr().String(), requests, func() {
+		_ = l.Close()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,137 @@
+package hdhomerun
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scanInterval is the amount of time Scan waits between retrieving the
+// progress of a channel scan.
+var scanInterval = 1 * time.Second
+
+// Scan starts a channel scan on the Tuner by setting its "scan" value, and
+// waits for the scan to finish. If progress is not nil, it is invoked with
+// the progress of the scan each time the progress is retrieved.
+//
+// If the context is canceled before the scan finishes, Scan aborts the scan
+// and resets the Tuner using Reset, so the Tuner is not left scanning, and
+// then returns the context's error.
+func (t *Tuner) Scan(ctx context.Context, progress func(p *ScanProgress)) error {
+	if _, err := t.set("scan", "start"); err != nil {
+		return err
+	}
+
+	var last time.Time
+	for {
+		if err := ctx.Err(); err != nil {
+			return t.abortScan(err)
+		}
+		if err := waitInterval(ctx, last, scanInterval); err != nil {
+			return t.abortScan(err)
+		}
+		last = time.Now()
+
+		b, err := t.query("scan")
+		if err != nil {
+			return err
+		}
+
+		p, err := ParseScanProgress(bytesStr(b))
+		if err != nil {
+			return err
+		}
+
+		if progress != nil {
+			progress(p)
+		}
+
+		if p.Done {
+			return nil
+		}
+	}
+}
+
+// abortScan aborts a channel scan and releases the Tuner after the context
+// passed to Scan is canceled, and returns the context's error cerr.
+func (t *Tuner) abortScan(cerr error) error {
+	if _, err := t.set("scan", "abort"); err != nil {
+		return err
+	}
+
+	if err := t.Reset(); err != nil {
+		return err
+	}
+
+	return cerr
+}
+
+// ScanProgress is the progress of a channel scan on an HDHomeRun tuner, as
+// reported by the tuner's "scan" value.
+type ScanProgress struct {
+	// Done reports whether the scan has finished. If true, the remaining
+	// fields are unset.
+	Done bool
+
+	// Remaining is the number of channels remaining in the scan.
+	Remaining int
+
+	// ChannelMap and Channel are the channel map and channel number which
+	// are currently being scanned, such as "us-bcast" and 57.
+	ChannelMap ChannelMap
+	Channel    int
+}
+
+// ParseScanProgress parses a scan progress value such as
+// "scanning:13 (us-bcast:57)" into a ScanProgress. The value "none" indicates
+// that the scan has finished. Any fields after the channel are ignored.
+func ParseScanProgress(s string) (*ScanProgress, error) {
+	if IsNone(s) {
+		return &ScanProgress{Done: true}, nil
+	}
+
+	ss := strings.Fields(s)
+	if len(ss) < 2 {
+		return nil, fmt.Errorf("malformed scan progress: %q", s)
+	}
+
+	// Number of channels remaining, such as "scanning:13".
+	state := strings.SplitN(ss[0], ":", 2)
+	if len(state) != 2 || state[0] != "scanning" {
+		return nil, fmt.Errorf("malformed scan state: %q", ss[0])
+	}
+
+	remaining, err := strconv.Atoi(state[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// Current channel map and channel, such as "(us-bcast:57)".
+	cur := ss[1]
+	if !strings.HasPrefix(cur, "(") || !strings.HasSuffix(cur, ")") {
+		return nil, fmt.Errorf("malformed scan channel: %q", cur)
+	}
+
+	mch := strings.SplitN(strings.Trim(cur, "()"), ":", 2)
+	if len(mch) != 2 || mch[0] == "" {
+		return nil, fmt.Errorf("malformed scan channel: %q", cur)
+	}
+
+	m, err := ParseChannelMap(mch[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := strconv.Atoi(mch[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScanProgress{
+		Remaining:  remaining,
+		ChannelMap: m,
+		Channel:    ch,
+	}, nil
+}
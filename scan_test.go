@@ -0,0 +1,215 @@
+package hdhomerun
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/joydip/hdhomerun/internal/libhdhomerun"
+)
+
+func TestParseScanProgress(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		p    *ScanProgress
+		ok   bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "no channel",
+			s:    "scanning:13",
+		},
+		{
+			name: "bad state",
+			s:    "foo:13 (us-bcast:57)",
+		},
+		{
+			name: "bad remaining",
+			s:    "scanning:foo (us-bcast:57)",
+		},
+		{
+			name: "no parentheses",
+			s:    "scanning:13 us-bcast:57",
+		},
+		{
+			name: "no channel number",
+			s:    "scanning:13 (us-bcast)",
+		},
+		{
+			name: "bad channel number",
+			s:    "scanning:13 (us-bcast:foo)",
+		},
+		{
+			name: "bad channel map",
+			s:    "scanning:13 (usbcast:57)",
+		},
+		{
+			name: "done",
+			s:    "none",
+			p:    &ScanProgress{Done: true},
+			ok:   true,
+		},
+		{
+			name: "broadcast",
+			s:    "scanning:13 (us-bcast:57)",
+			p: &ScanProgress{
+				Remaining:  13,
+				ChannelMap: ChannelMap{Country: "us", Medium: "bcast"},
+				Channel:    57,
+			},
+			ok: true,
+		},
+		{
+			name: "cable with trailing fields",
+			s:    "scanning:134 (us-cable:2) lock=none ss=0",
+			p: &ScanProgress{
+				Remaining:  134,
+				ChannelMap: ChannelMap{Country: "us", Medium: "cable"},
+				Channel:    2,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseScanProgress(tt.s)
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.p, p); diff != "" {
+				t.Fatalf("unexpected scan progress (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerScan(t *testing.T) {
+	interval := scanInterval
+	scanInterval = 5 * time.Millisecond
+	defer func() { scanInterval = interval }()
+
+	tests := []struct {
+		name     string
+		progress []string
+		cancel   int
+		sets     []string
+		ok       bool
+	}{
+		{
+			name:     "complete",
+			progress: []string{"scanning:2 (us-bcast:57)", "scanning:1 (us-bcast:58)", "none"},
+			sets:     []string{"/tuner0/scan=start"},
+			ok:       true,
+		},
+		{
+			name:     "canceled",
+			progress: []string{"scanning:2 (us-bcast:57)", "scanning:1 (us-bcast:58)"},
+			cancel:   2,
+			sets: []string{
+				"/tuner0/scan=start",
+				"/tuner0/scan=abort",
+				"/tuner0/channel=none",
+				"/tuner0/target=none",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				sets     []string
+				progress = tt.progress
+			)
+
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				var name, value string
+				var set bool
+				for _, tag := range req.Tags {
+					switch tag.Type {
+					case libhdhomerun.TagGetsetName:
+						name = bytesStr(tag.Data)
+					case libhdhomerun.TagGetsetValue:
+						value = bytesStr(tag.Data)
+						set = true
+					}
+				}
+
+				if set {
+					sets = append(sets, name+"="+value)
+				} else {
+					// The scan never finishes unless canceled.
+					value = progress[0]
+					if len(progress) > 1 {
+						progress = progress[1:]
+					}
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes(name),
+						},
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(value),
+						},
+					},
+				}, nil
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var got []string
+			err := c.Tuner(0).Scan(ctx, func(p *ScanProgress) {
+				if p.Done {
+					got = append(got, "done")
+				} else {
+					got = append(got, fmt.Sprintf("%s:%d", p.ChannelMap, p.Channel))
+				}
+
+				if len(got) == tt.cancel {
+					cancel()
+				}
+			})
+
+			done()
+
+			if tt.ok && err != nil {
+				t.Fatalf("failed to scan: %v", err)
+			}
+			if !tt.ok && err != context.Canceled {
+				t.Fatalf("expected context canceled, but got: %v", err)
+			}
+
+			want := []string{"us-bcast:57", "us-bcast:58"}
+			if tt.ok {
+				want = append(want, "done")
+			}
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("unexpected progress (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.sets, sets); diff != "" {
+				t.Fatalf("unexpected set requests (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
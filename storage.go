@@ -0,0 +1,111 @@
+package hdhomerun
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// A StorageDevice is an HDHomeRun storage (DVR) device. Storage devices are
+// found using the same discovery mechanism as tuners, but their recordings
+// are accessed using an HTTP API at the device's URL.
+type StorageDevice struct {
+	d *DiscoveredDevice
+	c *http.Client
+}
+
+// NewStorageDevice creates a StorageDevice from a DiscoveredDevice, which
+// must have a URL. If c is nil, http.DefaultClient is used.
+func NewStorageDevice(d *DiscoveredDevice, c *http.Client) (*StorageDevice, error) {
+	if d.URL == nil {
+		return nil, errors.New("storage device has no URL")
+	}
+
+	return &StorageDevice{
+		d: d,
+		c: c,
+	}, nil
+}
+
+// StorageStatus is the status of a StorageDevice.
+type StorageStatus struct {
+	FriendlyName string
+	StorageID    string
+	StorageURL   string
+	TotalSpace   uint64
+	FreeSpace    uint64
+}
+
+// Status retrieves the status of a StorageDevice, including its free space.
+func (s *StorageDevice) Status(ctx context.Context) (*StorageStatus, error) {
+	var st StorageStatus
+	if err := getJSON(ctx, s.c, s.d.URL.String()+"/discover.json", &st); err != nil {
+		return nil, err
+	}
+
+	return &st, nil
+}
+
+// FreeSpace retrieves the free space in bytes available to a StorageDevice.
+func (s *StorageDevice) FreeSpace(ctx context.Context) (uint64, error) {
+	st, err := s.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return st.FreeSpace, nil
+}
+
+// A Recording is a recording stored on a StorageDevice.
+type Recording struct {
+	Title        string
+	EpisodeTitle string
+	Category     string
+	ChannelName  string
+	StartTime    time.Time
+	EndTime      time.Time
+	PlayURL      string
+}
+
+// Recordings retrieves a list of recordings stored on a StorageDevice.
+func (s *StorageDevice) Recordings(ctx context.Context) ([]Recording, error) {
+	st, err := s.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if st.StorageURL == "" {
+		return nil, errors.New("storage device did not report a recordings URL")
+	}
+
+	// Recording times are reported as UNIX timestamps.
+	var raw []struct {
+		Title        string
+		EpisodeTitle string
+		Category     string
+		ChannelName  string
+		StartTime    int64
+		EndTime      int64
+		PlayURL      string
+	}
+
+	if err := getJSON(ctx, s.c, st.StorageURL, &raw); err != nil {
+		return nil, err
+	}
+
+	rs := make([]Recording, 0, len(raw))
+	for _, r := range raw {
+		rs = append(rs, Recording{
+			Title:        r.Title,
+			EpisodeTitle: r.EpisodeTitle,
+			Category:     r.Category,
+			ChannelName:  r.ChannelName,
+			StartTime:    time.Unix(r.StartTime, 0),
+			EndTime:      time.Unix(r.EndTime, 0),
+			PlayURL:      r.PlayURL,
+		})
+	}
+
+	return rs, nil
+}
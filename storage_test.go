@@ -0,0 +1,91 @@
+package hdhomerun
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStorageDevice(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/discover.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(w, `{
+			"FriendlyName": "HDHomeRun SERVIO",
+			"StorageID": "1234ABCD-0000-0000-0000-000000000000",
+			"StorageURL": "%s/recorded_files.json",
+			"TotalSpace": 2000000000000,
+			"FreeSpace": 1500000000000
+		}`, srv.URL)
+	})
+
+	mux.HandleFunc("/recorded_files.json", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintf(w, `[{
+			"Title": "The News",
+			"EpisodeTitle": "Evening Edition",
+			"Category": "news",
+			"ChannelName": "KTVU",
+			"StartTime": 1500000000,
+			"EndTime": 1500003600,
+			"PlayURL": "%s/recorded/play?id=1"
+		}]`, srv.URL)
+	})
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+
+	s, err := NewStorageDevice(&DiscoveredDevice{
+		ID:   "1234abcd",
+		Type: DeviceTypeStorage,
+		URL:  u,
+	}, srv.Client())
+	if err != nil {
+		t.Fatalf("failed to create storage device: %v", err)
+	}
+
+	ctx := context.Background()
+
+	free, err := s.FreeSpace(ctx)
+	if err != nil {
+		t.Fatalf("failed to get free space: %v", err)
+	}
+
+	if diff := cmp.Diff(uint64(1500000000000), free); diff != "" {
+		t.Fatalf("unexpected free space (-want +got):\n%s", diff)
+	}
+
+	rs, err := s.Recordings(ctx)
+	if err != nil {
+		t.Fatalf("failed to get recordings: %v", err)
+	}
+
+	want := []Recording{{
+		Title:        "The News",
+		EpisodeTitle: "Evening Edition",
+		Category:     "news",
+		ChannelName:  "KTVU",
+		StartTime:    time.Unix(1500000000, 0),
+		EndTime:      time.Unix(1500003600, 0),
+		PlayURL:      srv.URL + "/recorded/play?id=1",
+	}}
+
+	if diff := cmp.Diff(want, rs); diff != "" {
+		t.Fatalf("unexpected recordings (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewStorageDeviceNoURL(t *testing.T) {
+	if _, err := NewStorageDevice(&DiscoveredDevice{}, nil); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
@@ -0,0 +1,225 @@
+package hdhomerun
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// tsPacketSize is the size of an MPEG transport stream packet.
+	tsPacketSize = 188
+
+	// tsSyncByte is the sync byte which begins each MPEG transport stream
+	// packet.
+	tsSyncByte = 0x47
+
+	// tsSyncPackets is the number of consecutive packets which must begin
+	// with a sync byte for a stream to be considered aligned.
+	tsSyncPackets = 5
+
+	// patPID and patTableID identify the program association table, which
+	// is always carried in packets with PID 0.
+	patPID     = 0x0000
+	patTableID = 0x00
+)
+
+// errNoPAT is returned when ParsePAT finds no program association table.
+var errNoPAT = errors.New("no program association table found in transport stream")
+
+// ValidateTSAlignment finds the offset of the first MPEG transport stream
+// packet in b, which can be used to realign a video stream after data is
+// lost in transit.
+//
+// An offset is only considered valid if a sync byte appears at that offset
+// and at each 188 byte interval after it for the next four packets, or as
+// many as b contains. Packets beyond those are not checked, so that a corrupt
+// packet later in b does not prevent alignment. If no valid offset is found
+// within the first 188 bytes of b, ValidateTSAlignment returns false.
+func ValidateTSAlignment(b []byte) (offset int, ok bool) {
+	for off := 0; off < tsPacketSize && off < len(b); off++ {
+		if isTSAligned(b[off:]) {
+			return off, true
+		}
+	}
+
+	return 0, false
+}
+
+// isTSAligned determines if b begins with a transport stream packet and
+// contains a sync byte at the beginning of each of the following packets,
+// up to a total of tsSyncPackets.
+func isTSAligned(b []byte) bool {
+	for i := 0; i < len(b) && i < tsSyncPackets*tsPacketSize; i += tsPacketSize {
+		if b[i] != tsSyncByte {
+			return false
+		}
+	}
+
+	return true
+}
+
+// A ProgramEntry is an entry in an MPEG transport stream program association
+// table (PAT), which maps a program to the PID of its program map table
+// (PMT).
+type ProgramEntry struct {
+	// Number is the MPEG-TS program number, as used by Program.
+	Number uint16
+
+	// PMTPID is the PID of the packets carrying the program's PMT.
+	PMTPID uint16
+}
+
+// ParsePAT finds the first current program association table in the MPEG
+// transport stream ts, such as data captured from a Tuner's stream, and
+// returns its program entries. It is an alternative to Tuner.Programs which
+// requires no control connection, and requires ts to contain at least one
+// complete PAT.
+//
+// ParsePAT only parses the PAT; it does not demultiplex the stream or parse
+// the PMTs it refers to. The entry for program number 0, which refers to
+// the network information table rather than a program, is omitted. PAT
+// sections which span more than one packet are not supported, which in
+// practice limits a PAT to 42 programs.
+//
+// Packets without a sync byte or with their transport error indicator set,
+// and sections which are corrupt or unsupported, are skipped in favor of a
+// later PAT in ts. If no valid PAT is found, the error from the last invalid
+// section is returned.
+func ParsePAT(ts []byte) ([]ProgramEntry, error) {
+	off, ok := ValidateTSAlignment(ts)
+	if !ok {
+		return nil, errors.New("transport stream is not aligned to MPEG-TS packets")
+	}
+
+	// Captured streams often contain corrupt packets, so skip any invalid
+	// sections and report the last error only if no valid PAT follows.
+	lastErr := errNoPAT
+	for b := ts[off:]; len(b) >= tsPacketSize; b = b[tsPacketSize:] {
+		pkt := b[:tsPacketSize]
+		if pkt[0] != tsSyncByte || pkt[1]&0x80 != 0 {
+			// Lost sync, or the transport_error_indicator is set.
+			continue
+		}
+
+		section, ok := patSection(pkt)
+		if !ok {
+			continue
+		}
+
+		ps, ok, err := parsePATSection(section)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !ok {
+			// Not yet applicable; keep looking.
+			continue
+		}
+
+		return ps, nil
+	}
+
+	return nil, lastErr
+}
+
+// patSection returns the PAT section which begins in the transport stream
+// packet pkt, if pkt carries one.
+func patSection(pkt []byte) ([]byte, bool) {
+	pid := uint16(pkt[1]&0x1f)<<8 | uint16(pkt[2])
+	if pid != patPID || pkt[1]&0x40 == 0 {
+		// Not a PAT packet, or no section begins in this packet.
+		return nil, false
+	}
+
+	payload := pkt[4:]
+	switch pkt[3] >> 4 & 0x3 {
+	case 1:
+		// Payload only.
+	case 3:
+		// Adaptation field followed by payload.
+		n := 1 + int(payload[0])
+		if n >= len(payload) {
+			return nil, false
+		}
+		payload = payload[n:]
+	default:
+		// No payload.
+		return nil, false
+	}
+
+	// Skip the pointer field and any bytes it points past.
+	n := 1 + int(payload[0])
+	if n >= len(payload) || payload[n] != patTableID {
+		return nil, false
+	}
+
+	return payload[n:], true
+}
+
+// parsePATSection parses a PAT section. It returns false if the section is
+// not yet applicable.
+func parsePATSection(b []byte) ([]ProgramEntry, bool, error) {
+	// Table ID, section length, transport stream ID, version, section
+	// numbers, and CRC.
+	const minLen = 12
+
+	if len(b) < 3 {
+		return nil, false, errors.New("PAT section too short")
+	}
+
+	n := 3 + (int(b[1]&0x0f)<<8 | int(b[2]))
+	if n < minLen || n > len(b) {
+		return nil, false, fmt.Errorf("invalid PAT section length: %d", n)
+	}
+	b = b[:n]
+
+	if mpegCRC32(b) != 0 {
+		return nil, false, errors.New("PAT section CRC mismatch")
+	}
+
+	if b[5]&0x01 == 0 {
+		// The current_next_indicator is not set.
+		return nil, false, nil
+	}
+
+	entries := b[8 : n-4]
+	if len(entries)%4 != 0 {
+		return nil, false, fmt.Errorf("malformed PAT entries length: %d", len(entries))
+	}
+
+	ps := make([]ProgramEntry, 0, len(entries)/4)
+	for i := 0; i < len(entries); i += 4 {
+		e := entries[i : i+4]
+
+		num := uint16(e[0])<<8 | uint16(e[1])
+		if num == 0 {
+			// Network information table.
+			continue
+		}
+
+		ps = append(ps, ProgramEntry{
+			Number: num,
+			PMTPID: uint16(e[2]&0x1f)<<8 | uint16(e[3]),
+		})
+	}
+
+	return ps, true, nil
+}
+
+// mpegCRC32 computes the MPEG-2 CRC32 of b. The CRC of a section including
+// its trailing CRC field is zero.
+func mpegCRC32(b []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, c := range b {
+		crc ^= uint32(c) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
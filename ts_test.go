@@ -0,0 +1,204 @@
+package hdhomerun
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateTSAlignment(t *testing.T) {
+	// packets creates n transport stream packets with payloads which do not
+	// contain a sync byte.
+	packets := func(n int) []byte {
+		pkt := append([]byte{tsSyncByte}, bytes.Repeat([]byte{0xff}, tsPacketSize-1)...)
+		return bytes.Repeat(pkt, n)
+	}
+
+	tests := []struct {
+		name   string
+		b      []byte
+		offset int
+		ok     bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "no sync",
+			b:    bytes.Repeat([]byte{0xff}, tsPacketSize*2),
+		},
+		{
+			name:   "aligned",
+			b:      packets(3),
+			offset: 0,
+			ok:     true,
+		},
+		{
+			name:   "partial packet",
+			b:      append([]byte{0xff, 0xff, 0xff}, packets(3)...),
+			offset: 3,
+			ok:     true,
+		},
+		{
+			name: "false sync",
+			// A sync byte in the payload of the partial packet, which is
+			// not followed by another at the next interval.
+			b:      append([]byte{0xff, tsSyncByte, 0xff}, packets(3)...),
+			offset: 3,
+			ok:     true,
+		},
+		{
+			name: "beyond window",
+			b:    append(bytes.Repeat([]byte{0xff}, tsPacketSize), packets(2)...),
+		},
+		{
+			name: "lost sync",
+			b: func() []byte {
+				b := packets(3)
+				b[tsPacketSize] = 0xff
+				return b
+			}(),
+		},
+		{
+			name: "lost sync after window",
+			b: func() []byte {
+				b := packets(tsSyncPackets + 2)
+				b[tsSyncPackets*tsPacketSize] = 0xff
+				return b
+			}(),
+			offset: 0,
+			ok:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, ok := ValidateTSAlignment(tt.b)
+
+			if ok != tt.ok {
+				t.Fatalf("unexpected alignment result: %v", ok)
+			}
+
+			if offset != tt.offset {
+				t.Fatalf("unexpected offset: want %d, got %d", tt.offset, offset)
+			}
+		})
+	}
+}
+
+func TestParsePAT(t *testing.T) {
+	// packet creates a transport stream packet from a hex-encoded header and
+	// payload, padded with stuffing bytes.
+	packet := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			panicf("failed to decode packet: %v", err)
+		}
+
+		return append(b, bytes.Repeat([]byte{0xff}, tsPacketSize-len(b))...)
+	}
+
+	var (
+		// A PAT as carried in an ATSC broadcast, with the NIT on PID 0x10 and
+		// programs 3 and 4 on PMT PIDs 0x30 and 0x40.
+		pat = packet("474000100000b0150001c100000000e0100003e0300004e040799c292f")
+
+		// The same PAT with its current_next_indicator cleared and its CRC
+		// updated to match.
+		next = packet("474000100000b0150001c000000000e0100003e0300004e040a493c85d")
+
+		// A PAT with a corrupt CRC.
+		corrupt = packet("474000100000b0150001c100000000e0100003e0300004e040799c2930")
+
+		// A null packet.
+		null = packet("471fff10")
+
+		// A packet which has lost its sync byte.
+		nosync = packet("ff1fff10")
+
+		// The PAT with its transport_error_indicator set.
+		tei = packet("47c000100000b0150001c100000000e0100003e0300004e040799c292f")
+
+		concat = func(bs ...[]byte) []byte { return bytes.Join(bs, nil) }
+	)
+
+	want := []ProgramEntry{
+		{Number: 3, PMTPID: 0x30},
+		{Number: 4, PMTPID: 0x40},
+	}
+
+	tests := []struct {
+		name string
+		ts   []byte
+		ps   []ProgramEntry
+		ok   bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "no PAT",
+			ts:   concat(null, null),
+		},
+		{
+			name: "only corrupt",
+			ts:   concat(null, corrupt, null),
+		},
+		{
+			name: "only next",
+			ts:   concat(next, null),
+		},
+		{
+			name: "current",
+			ts:   concat(null, pat, null, pat),
+			ps:   want,
+			ok:   true,
+		},
+		{
+			name: "corrupt then current",
+			ts:   concat(null, corrupt, pat),
+			ps:   want,
+			ok:   true,
+		},
+		{
+			name: "only transport error",
+			ts:   concat(null, tei, null),
+		},
+		{
+			// The stream is aligned by the null packets which precede
+			// the corrupt packets.
+			name: "lost sync around current",
+			ts:   concat(null, null, null, null, null, nosync, pat, nosync),
+			ps:   want,
+			ok:   true,
+		},
+		{
+			name: "partial packet",
+			ts:   concat([]byte{0xff, 0xff}, null, next, pat),
+			ps:   want,
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, err := ParsePAT(tt.ts)
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.ps, ps); diff != "" {
+				t.Fatalf("unexpected program entries (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
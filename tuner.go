@@ -3,10 +3,14 @@ package hdhomerun
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // A StopReason is a reason why a tuner's network stream has stopped.
@@ -37,6 +41,11 @@ func (t *Tuner) Debug() (*TunerDebug, error) {
 		return nil, err
 	}
 
+	return parseTunerDebug(b)
+}
+
+// parseTunerDebug parses a tuner's "debug" value into a TunerDebug.
+func parseTunerDebug(b []byte) (*TunerDebug, error) {
 	debug := new(TunerDebug)
 	s := bufio.NewScanner(bytes.NewReader(b))
 	for s.Scan() {
@@ -49,6 +58,67 @@ func (t *Tuner) Debug() (*TunerDebug, error) {
 	return debug, s.Err()
 }
 
+// DebugValues retrieves the Tuner's raw debugging information as a map of
+// key/value pairs. Each key is qualified by the name of its status line, so
+// the "ss" value from the "tun:" line is stored under the key "tun.ss".
+//
+// Unlike Debug, DebugValues retains keys which are not otherwise recognized,
+// exposing low-level signal metrics which are not parsed into TunerDebug.
+func (t *Tuner) DebugValues() (map[string]string, error) {
+	b, err := t.query("debug")
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		ss := strings.Fields(bytesStr(s.Bytes()))
+		switch {
+		case len(ss) == 0:
+			// Probably an empty line.
+			continue
+		case len(ss) < 2:
+			return nil, fmt.Errorf("malformed tuner status line: %q", s.Text())
+		}
+
+		kvs, err := kvStrings(ss[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := strings.TrimSuffix(ss[0], ":")
+		for _, kv := range kvs {
+			values[prefix+"."+kv[0]] = kv[1]
+		}
+	}
+
+	return values, s.Err()
+}
+
+// TargetErrors retrieves the number of errors the Tuner has encountered while
+// sending its stream to its network target, as reported by the "err" value
+// of the "net:" line of its debugging information. An increasing count
+// indicates network delivery problems.
+func (t *Tuner) TargetErrors() (uint64, error) {
+	values, err := t.DebugValues()
+	if err != nil {
+		return 0, err
+	}
+
+	s, ok := values["net.err"]
+	if !ok {
+		return 0, errors.New("tuner debug information has no network error count")
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed network error count %q: %v", s, err)
+	}
+
+	return n, nil
+}
+
 // VChannel retrieves the virtual channel the Tuner is tuned to.
 func (t *Tuner) VChannel() (string, error) {
 	b, err := t.query("vchannel")
@@ -59,10 +129,593 @@ func (t *Tuner) VChannel() (string, error) {
 	return string(b[:len(b)-1]), nil
 }
 
+// Channel retrieves the physical channel the Tuner is tuned to. If the Tuner
+// is not tuned to a channel, Channel returns nil.
+func (t *Tuner) Channel() (*Channel, error) {
+	b, err := t.query("channel")
+	if err != nil {
+		return nil, err
+	}
+
+	s := bytesStr(b)
+	if IsNone(s) {
+		return nil, nil
+	}
+
+	ch, err := ParseChannel(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ch, nil
+}
+
+// Target retrieves the network target the Tuner is streaming to, such as
+// "udp://192.168.1.10:5000". If the Tuner has no target, Target returns an
+// empty string.
+func (t *Tuner) Target() (string, error) {
+	b, err := t.query("target")
+	if err != nil {
+		return "", err
+	}
+
+	return noneEmpty(bytesStr(b)), nil
+}
+
+// SetChannel tunes the Tuner to the specified physical channel.
+func (t *Tuner) SetChannel(ch Channel) error {
+	_, err := t.set("channel", ch.String())
+	return err
+}
+
+// TuneAuto tunes the Tuner to the specified frequency, letting the device
+// detect the modulation. It is a shortcut for SetChannel with ModulationAuto.
+func (t *Tuner) TuneAuto(frequencyHz uint64) error {
+	return t.SetChannel(Channel{
+		Modulation:  ModulationAuto,
+		FrequencyHz: frequencyHz,
+	})
+}
+
+// Programs retrieves the programs carried by the physical channel the Tuner
+// is tuned to, as reported by its "streaminfo" value. If the Tuner is not
+// tuned to a channel, or the device has not yet identified any programs,
+// Programs returns no Programs and no error.
+func (t *Tuner) Programs() ([]Program, error) {
+	b, err := t.query("streaminfo")
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePrograms(bytesStr(b))
+}
+
+// WatchStreamInfo polls the Tuner's programs at the specified interval using
+// Programs, and sends the programs on the returned Program channel whenever
+// they change, such as after a channel change. The initial programs are
+// always sent.
+//
+// If an error occurs, it is sent on the returned error channel and polling
+// stops. Both channels are closed when polling stops, either due to an error
+// or because the context is canceled.
+func (t *Tuner) WatchStreamInfo(ctx context.Context, interval time.Duration) (<-chan []Program, <-chan error) {
+	psC := make(chan []Program)
+	errC := make(chan error, 1)
+
+	go func() {
+		defer close(psC)
+		defer close(errC)
+
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+
+		var (
+			last  []Program
+			first = true
+		)
+
+		for {
+			ps, err := t.Programs()
+			if err != nil {
+				errC <- err
+				return
+			}
+
+			if first || !programsEqual(last, ps) {
+				select {
+				case <-ctx.Done():
+					return
+				case psC <- ps:
+				}
+
+				first = false
+				last = ps
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+
+	return psC, errC
+}
+
+// programsEqual reports whether a and b contain the same Programs in the same
+// order.
+func programsEqual(a, b []Program) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// channelChangeInterval is the amount of time OnChannelChange waits between
+// retrieving the Tuner's programs.
+var channelChangeInterval = 1 * time.Second
+
+// OnChannelChange watches the Tuner's programs using WatchStreamInfo, and
+// invokes fn with the previous and current programs each time they change,
+// such as after a channel change. The initial programs are not considered a
+// change.
+//
+// fn is invoked on the calling goroutine, one change at a time, so it needs
+// no synchronization of its own. OnChannelChange blocks until the context is
+// canceled, in which case the context's error is returned, or until the
+// programs cannot be retrieved, in which case that error is returned.
+func (t *Tuner) OnChannelChange(ctx context.Context, fn func(old, new []Program)) error {
+	psC, errC := t.WatchStreamInfo(ctx, channelChangeInterval)
+
+	var (
+		last  []Program
+		first = true
+	)
+
+	for ps := range psC {
+		if !first {
+			fn(last, ps)
+		}
+
+		first = false
+		last = ps
+	}
+
+	// The error channel is closed before the programs channel, so any error
+	// is already available.
+	if err := <-errC; err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// SelectProgram filters the Tuner's stream to the program with the specified
+// number, such as the Number of a Program returned by Programs.
+func (t *Tuner) SelectProgram(number uint32) error {
+	_, err := t.set("program", strconv.FormatUint(uint64(number), 10))
+	return err
+}
+
+// tuneProgramInterval is the amount of time TuneProgram waits between
+// retrieving the programs on a channel.
+var tuneProgramInterval = 250 * time.Millisecond
+
+// TuneProgram tunes the Tuner to the specified physical channel, waits for
+// the device to identify the programs carried by the channel, and then
+// selects a program to stream. The first viewable program whose name
+// contains "HD" is preferred, and otherwise the first viewable program is
+// selected. Encrypted, control, and empty programs are never selected.
+//
+// TuneProgram returns the selected Program. If the context is canceled before
+// a viewable program is found, the context's error is returned.
+func (t *Tuner) TuneProgram(ctx context.Context, ch Channel) (*Program, error) {
+	if err := t.SetChannel(ch); err != nil {
+		return nil, err
+	}
+
+	var last time.Time
+	for {
+		if err := waitInterval(ctx, last, tuneProgramInterval); err != nil {
+			return nil, err
+		}
+		last = time.Now()
+
+		ps, err := t.Programs()
+		if err != nil {
+			return nil, err
+		}
+
+		p := chooseProgram(ps)
+		if p == nil {
+			// The device may not have finished reading the channel's
+			// program tables; try again.
+			continue
+		}
+
+		if err := t.SelectProgram(p.Number); err != nil {
+			return nil, err
+		}
+
+		return p, nil
+	}
+}
+
+// chooseProgram chooses the program TuneProgram selects from ps, or returns
+// nil if no program is viewable.
+func chooseProgram(ps []Program) *Program {
+	var first *Program
+	for i := range ps {
+		p := &ps[i]
+		if !p.Viewable() {
+			continue
+		}
+
+		if strings.Contains(p.Name, "HD") {
+			return p
+		}
+
+		if first == nil {
+			first = p
+		}
+	}
+
+	return first
+}
+
+// A Program is a program carried by a physical channel, such as one of the
+// subchannels of an ATSC broadcast.
+type Program struct {
+	// Number is the MPEG-TS program number, which is passed to
+	// Tuner.SelectProgram.
+	Number uint32
+
+	// VChannel is the virtual channel number of the program, such as "20.1",
+	// or "0" if the program has no virtual channel.
+	VChannel string
+
+	// Name is the name of the program, such as "KBDI-HD". It may be empty.
+	Name string
+
+	// Encrypted, NoData, and Control report whether the device flagged the
+	// program as encrypted, as carrying no data, or as a control channel
+	// which carries no video.
+	Encrypted bool
+	NoData    bool
+	Control   bool
+}
+
+// Viewable reports whether the Program can be streamed and viewed.
+func (p Program) Viewable() bool {
+	return !p.Encrypted && !p.NoData && !p.Control
+}
+
+// parsePrograms parses the lines of a "streaminfo" value, such as
+// "3: 20.1 KBDI-HD" or "6: 0 (control)". Other lines, such as the
+// "tsid=0x0b1f" line, are ignored.
+func parsePrograms(s string) ([]Program, error) {
+	var ps []Program
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || IsNone(line) || !strings.Contains(line, ":") {
+			continue
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		n, err := strconv.ParseUint(kv[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed program line %q: %v", line, err)
+		}
+
+		p := Program{Number: uint32(n)}
+
+		// Flags such as "(encrypted)" follow the virtual channel and name.
+		rest := strings.TrimSpace(kv[1])
+		for strings.HasSuffix(rest, ")") {
+			i := strings.LastIndex(rest, "(")
+			if i == -1 {
+				break
+			}
+
+			switch rest[i+1 : len(rest)-1] {
+			case "encrypted":
+				p.Encrypted = true
+			case "no data":
+				p.NoData = true
+			case "control":
+				p.Control = true
+			}
+
+			rest = strings.TrimSpace(rest[:i])
+		}
+
+		fs := strings.SplitN(rest, " ", 2)
+		p.VChannel = fs[0]
+		if len(fs) == 2 {
+			p.Name = strings.TrimSpace(fs[1])
+		}
+
+		ps = append(ps, p)
+	}
+
+	return ps, nil
+}
+
+// PlotSample retrieves a set of constellation plot samples from the Tuner's
+// demodulator, which can be used to visualize signal quality. The Tuner must
+// be tuned to a channel.
+func (t *Tuner) PlotSample() ([]PlotSample, error) {
+	b, err := t.query("plotsample")
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePlotSamples(bytesStr(b))
+}
+
+// A PlotSample is an in-phase/quadrature sample from a Tuner's demodulator.
+// Each component is a signed 12-bit value in the range [-2048, 2047].
+type PlotSample struct {
+	Real int
+	Imag int
+}
+
+// parsePlotSamples parses space-delimited plot samples. Each sample is a
+// hexadecimal value which packs the real component in its upper 12 bits
+// and the imaginary component in its lower 12 bits, each in two's
+// complement form.
+func parsePlotSamples(s string) ([]PlotSample, error) {
+	fs := strings.Fields(s)
+	samples := make([]PlotSample, 0, len(fs))
+	for _, f := range fs {
+		v, err := strconv.ParseUint(f, 16, 24)
+		if err != nil {
+			return nil, fmt.Errorf("malformed plot sample %q: %v", f, err)
+		}
+
+		samples = append(samples, PlotSample{
+			Real: signExtend12(v >> 12),
+			Imag: signExtend12(v),
+		})
+	}
+
+	return samples, nil
+}
+
+// signExtend12 converts the lower 12 bits of v from two's complement form
+// into a signed integer.
+func signExtend12(v uint64) int {
+	v &= 0x0fff
+	if v&0x0800 != 0 {
+		return int(v) - 0x1000
+	}
+
+	return int(v)
+}
+
+// ForceUnlock forcibly releases any lock held on the Tuner by another client,
+// such as a client which crashed while holding the lock.
+//
+// ForceUnlock should be used with care: if another client is actively using
+// the Tuner, its stream will be interrupted and its lock revoked without
+// warning.
+func (t *Tuner) ForceUnlock() error {
+	_, err := t.set("lockkey", "force")
+	return err
+}
+
+// LockOwner returns the IP address of the client which holds the Tuner's
+// lock, as reported by its "lockkey" value, so that a client can identify
+// the owner before deciding whether to use ForceUnlock. If the Tuner is not
+// locked, LockOwner returns nil.
+func (t *Tuner) LockOwner() (net.IP, error) {
+	b, err := t.query("lockkey")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLockOwner(bytesStr(b))
+}
+
+// parseLockOwner parses a tuner's "lockkey" value, which is either the IP
+// address of the lock owner or a sentinel which indicates no owner.
+func parseLockOwner(s string) (net.IP, error) {
+	s = strings.TrimSpace(s)
+	if IsNone(s) || s == "force" {
+		// Unlocked, or the lock was just forcibly released.
+		return nil, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("malformed lock owner: %q", s)
+	}
+
+	return ip, nil
+}
+
+// Reset returns the Tuner to an idle state by clearing its channel and
+// target, and releasing its lock if the Client is configured with a lock key
+// using SetLockKey. Calling Reset on an idle Tuner has no effect.
+func (t *Tuner) Reset() error {
+	if _, err := t.set("channel", "none"); err != nil {
+		return err
+	}
+
+	if _, err := t.set("target", "none"); err != nil {
+		return err
+	}
+
+	if t.c.lockKey() == 0 {
+		return nil
+	}
+
+	_, err := t.set("lockkey", "none")
+	return err
+}
+
 // query performs a Client query prefixed with this Tuner's base path.
 func (t *Tuner) query(query string) ([]byte, error) {
-	base := fmt.Sprintf("/tuner%d/", t.Index)
-	return t.c.Query(path.Join(base, query))
+	name, err := TunerResource(t.Index, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.c.Query(name)
+}
+
+// set performs a Client set prefixed with this Tuner's base path.
+func (t *Tuner) set(name, value string) ([]byte, error) {
+	name, err := TunerResource(t.Index, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.c.Set(name, value)
+}
+
+// TunerResource returns the get/set name of a resource belonging to the
+// tuner with the specified index, such as "/tuner0/channel" for tuner 0 and
+// resource "channel". It returns an error if tuner is negative.
+func TunerResource(tuner int, resource string) (string, error) {
+	if tuner < 0 {
+		return "", fmt.Errorf("tuner index must not be negative: %d", tuner)
+	}
+
+	return path.Join(fmt.Sprintf("/tuner%d", tuner), resource), nil
+}
+
+// ModulationAuto is the Channel modulation which requests that the device
+// detect the modulation automatically.
+const ModulationAuto = "auto"
+
+// A Channel is a physical channel which a Tuner can tune to, such as
+// "qam:489000000".
+type Channel struct {
+	// Modulation is the modulation used to tune the channel, such as "qam"
+	// or "8vsb". See ModulationAuto for automatic modulation detection.
+	Modulation string
+
+	// FrequencyHz is the frequency of the channel in hertz.
+	FrequencyHz uint64
+}
+
+// ParseChannel parses a channel in "modulation:frequency" format, such as
+// "qam:489000000" or "auto:489000000", into a Channel.
+func ParseChannel(s string) (Channel, error) {
+	ss := strings.Split(s, ":")
+	if len(ss) != 2 || ss[0] == "" {
+		return Channel{}, fmt.Errorf("malformed channel: %q", s)
+	}
+
+	f, err := strconv.ParseUint(ss[1], 10, 64)
+	if err != nil {
+		return Channel{}, err
+	}
+
+	return Channel{
+		Modulation:  ss[0],
+		FrequencyHz: f,
+	}, nil
+}
+
+// String returns the string representation of a Channel, in the same format
+// accepted by ParseChannel.
+func (c Channel) String() string {
+	return fmt.Sprintf("%s:%d", c.Modulation, c.FrequencyHz)
+}
+
+// TunerCaps describes the channel maps and modulations supported by a Tuner.
+type TunerCaps struct {
+	// ChannelMaps are the channel maps the Tuner can use.
+	ChannelMaps []ChannelMap
+
+	// Modulations are the modulations the Tuner can tune, such as "8vsb".
+	// AutoModulations are the modulations which request that the Tuner
+	// detect the modulation automatically, such as "auto".
+	Modulations     []string
+	AutoModulations []string
+}
+
+// Capabilities returns the channel maps and modulations supported by the
+// Tuner. On devices whose tuners differ in capability, each tuner reports its
+// own features as its "features" value. Otherwise, the device's Features are
+// used, since every tuner shares them.
+func (t *Tuner) Capabilities() (*TunerCaps, error) {
+	var features map[string][]string
+	b, err := t.query("features")
+	switch {
+	case err == nil:
+		features = parseFeatures(bytesStr(b))
+	case IsNotExist(err):
+		features, err = t.c.Features()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	maps, err := parseChannelMaps(features["channelmap"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &TunerCaps{
+		ChannelMaps:     maps,
+		Modulations:     features["modulation"],
+		AutoModulations: features["auto-modulation"],
+	}, nil
+}
+
+// SupportsChannel reports whether a Tuner with these capabilities can tune
+// ch using its modulation.
+func (tc *TunerCaps) SupportsChannel(ch Channel) bool {
+	return hasString(tc.Modulations, ch.Modulation) ||
+		hasString(tc.AutoModulations, ch.Modulation)
+}
+
+// A ChannelMap is a channel map which a Tuner uses to interpret channel
+// numbers, such as "us-bcast". Each channel map applies to the channels of
+// one country or region, received using one medium.
+type ChannelMap struct {
+	// Country is the country or region code of the channel map, such as
+	// "us" or "eu".
+	Country string
+
+	// Medium is the medium of the channel map, such as "bcast" for
+	// broadcast antenna, or "cable", "hrc", and "irc" for varieties of cable.
+	Medium string
+}
+
+// ParseChannelMap parses a channel map in "country-medium" format, such as
+// "us-bcast" or "eu-cable", into a ChannelMap. ParseChannelMap only checks
+// the format of s; use Client.ChannelMaps to determine which channel maps a
+// device supports.
+func ParseChannelMap(s string) (ChannelMap, error) {
+	ss := strings.Split(s, "-")
+	if len(ss) != 2 || ss[0] == "" || ss[1] == "" {
+		return ChannelMap{}, fmt.Errorf("malformed channel map: %q", s)
+	}
+
+	return ChannelMap{
+		Country: ss[0],
+		Medium:  ss[1],
+	}, nil
+}
+
+// String returns the string representation of a ChannelMap, in the same
+// format accepted by ParseChannelMap.
+func (m ChannelMap) String() string {
+	return m.Country + "-" + m.Medium
 }
 
 // TunerDebug contains debugging information about an HDHomeRun TV tuner.
@@ -81,12 +734,19 @@ type TunerDebug struct {
 	Network         *NetworkStatus
 }
 
-// TODO(mdlayher): determine if Channel, Lock, and Debug fields merit
-// their own special types.
+// TODO(mdlayher): determine if Lock and Debug fields merit their own
+// special types.
 
 // TunerStatus is the status of an HDHomeRun tuner.
+//
+// Channel and Lock are empty if the tuner reports them as "none", such as
+// when the tuner is not tuned to a channel. ChannelInfo is Channel parsed
+// using ParseChannel, and is the zero Channel if Channel is empty. A nil
+// TunerStatus in TunerDebug indicates that the tuner reported no status at
+// all.
 type TunerStatus struct {
 	Channel              string
+	ChannelInfo          Channel
 	Lock                 string
 	SignalStrength       int
 	SignalToNoiseQuality int
@@ -166,9 +826,18 @@ func (td *TunerDebug) parseTuner(kvs [][2]string) error {
 	for _, kv := range kvs {
 		switch kv[0] {
 		case "ch":
-			cc.Channel = kv[1]
+			cc.Channel = noneEmpty(kv[1])
+			if cc.Channel == "" {
+				break
+			}
+
+			ch, err := ParseChannel(cc.Channel)
+			if err != nil {
+				return err
+			}
+			cc.ChannelInfo = ch
 		case "lock":
-			cc.Lock = kv[1]
+			cc.Lock = noneEmpty(kv[1])
 		case "dbg":
 			cc.Debug = kv[1]
 		}
@@ -301,6 +970,15 @@ func (td *TunerDebug) parseNetwork(kvs [][2]string) error {
 	return nil
 }
 
+// noneEmpty returns s, or the empty string if s is the "none" sentinel.
+func noneEmpty(s string) string {
+	if IsNone(s) {
+		return ""
+	}
+
+	return s
+}
+
 // kvStrings parses a slice of strings in key=value format into a slice
 // of key/value pairs.
 func kvStrings(ss []string) ([][2]string, error) {
@@ -1,7 +1,12 @@
 package hdhomerun
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/joydip/hdhomerun/internal/libhdhomerun"
@@ -26,6 +31,10 @@ func TestClientTunerDebug(t *testing.T) {
 			name: "bad integer",
 			s:    `tun: ss=foo`,
 		},
+		{
+			name: "bad channel",
+			s:    `tun: ch=qam`,
+		},
 		{
 			name:  "unhandled key",
 			s:     `foo: bar=0`,
@@ -41,10 +50,9 @@ func TestClientTunerDebug(t *testing.T) {
 			net: pps=10 err=11 stop=0
 			`,
 			debug: &TunerDebug{
+				// "none" indicates that the channel and lock are unset.
 				Tuner: &TunerStatus{
-					Channel: "none",
-					Lock:    "none",
-					Debug:   "0",
+					Debug: "0",
 				},
 				Device: &DeviceStatus{
 					BitsPerSecond: 1,
@@ -74,7 +82,11 @@ func TestClientTunerDebug(t *testing.T) {
 			s:    `tun: ch=qam:249000000 lock=qam256:249000000 ss=100 snq=100 seq=100 dbg=-383/-6666`,
 			debug: &TunerDebug{
 				Tuner: &TunerStatus{
-					Channel:              "qam:249000000",
+					Channel: "qam:249000000",
+					ChannelInfo: Channel{
+						Modulation:  "qam",
+						FrequencyHz: 249000000,
+					},
 					Lock:                 "qam256:249000000",
 					SignalStrength:       100,
 					SignalToNoiseQuality: 100,
@@ -84,6 +96,25 @@ func TestClientTunerDebug(t *testing.T) {
 			},
 			ok: true,
 		},
+		{
+			name: "tuned auto",
+			s:    `tun: ch=auto:593000000 lock=8vsb:593000000 ss=81 snq=75 seq=100 dbg=-410/6904`,
+			debug: &TunerDebug{
+				Tuner: &TunerStatus{
+					Channel: "auto:593000000",
+					ChannelInfo: Channel{
+						Modulation:  ModulationAuto,
+						FrequencyHz: 593000000,
+					},
+					Lock:                 "8vsb:593000000",
+					SignalStrength:       81,
+					SignalToNoiseQuality: 75,
+					SymbolErrorQuality:   100,
+					Debug:                "-410/6904",
+				},
+			},
+			ok: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -127,3 +158,1260 @@ func TestClientTunerDebug(t *testing.T) {
 		})
 	}
 }
+
+func TestTunerDebugValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		values map[string]string
+		ok     bool
+	}{
+		{
+			name: "bad status",
+			s:    `tun:`,
+		},
+		{
+			name: "bad key=value",
+			s:    `tun: ch`,
+		},
+		{
+			name: "OK",
+			s: `tun: ch=qam:249000000 lock=qam256:249000000 ss=100 snq=100 seq=100 dbg=-383/-6666
+			dev: bps=1 resync=2 overflow=3
+			cc:  bps=4 resync=5 overflow=6
+			ts:  bps=7 te=8 crc=9 foo=bar
+			net: pps=10 err=11 stop=0
+			`,
+			values: map[string]string{
+				"tun.ch":       "qam:249000000",
+				"tun.lock":     "qam256:249000000",
+				"tun.ss":       "100",
+				"tun.snq":      "100",
+				"tun.seq":      "100",
+				"tun.dbg":      "-383/-6666",
+				"dev.bps":      "1",
+				"dev.resync":   "2",
+				"dev.overflow": "3",
+				"cc.bps":       "4",
+				"cc.resync":    "5",
+				"cc.overflow":  "6",
+				"ts.bps":       "7",
+				"ts.te":        "8",
+				"ts.crc":       "9",
+				"ts.foo":       "bar",
+				"net.pps":      "10",
+				"net.err":      "11",
+				"net.stop":     "0",
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes("/tuner0/debug"),
+						},
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.s),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			got, err := c.Tuner(0).DebugValues()
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error during query: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.values, got); diff != "" {
+				t.Fatalf("unexpected debug values (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerTargetErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    uint64
+		ok   bool
+	}{
+		{
+			name: "OK",
+			s: "tun: ch=auto:593000000 lock=8vsb:593000000 ss=81 snq=75 seq=100 dbg=-410/6904\n" +
+				"dev: bps=19394080 resync=0 overflow=0\n" +
+				"ts:  bps=19394080 te=0 crc=0\n" +
+				"net: pps=1845 err=4294967296 stop=0\n",
+			n:  4294967296,
+			ok: true,
+		},
+		{
+			name: "no network status",
+			s:    "tun: ch=none lock=none ss=0 snq=0 seq=0 dbg=-4/0\n",
+		},
+		{
+			name: "negative",
+			s:    "net: pps=0 err=-1 stop=0\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes("/tuner1/debug"),
+						},
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.s),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			n, err := c.Tuner(1).TargetErrors()
+			if tt.ok && err != nil {
+				t.Fatalf("failed to get target errors: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.n, n); diff != "" {
+				t.Fatalf("unexpected target errors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerPlotSample(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		samples []PlotSample
+		ok      bool
+	}{
+		{
+			name: "bad hex",
+			s:    "00f00f zzz",
+		},
+		{
+			name: "too large",
+			s:    "1000000",
+		},
+		{
+			name:    "empty",
+			samples: []PlotSample{},
+			ok:      true,
+		},
+		{
+			name: "OK",
+			s:    "00f00f 7ff800 800fff 123edc",
+			samples: []PlotSample{
+				{Real: 15, Imag: 15},
+				{Real: 2047, Imag: -2048},
+				{Real: -2048, Imag: -1},
+				{Real: 291, Imag: -292},
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes("/tuner0/plotsample"),
+						},
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.s),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			got, err := c.Tuner(0).PlotSample()
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error during query: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.samples, got); diff != "" {
+				t.Fatalf("unexpected plot samples (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// streaminfo is a "streaminfo" value captured from a tuner tuned to an ATSC
+// broadcast.
+const streaminfo = "1: 20.1 KBDI-HD\n" +
+	"2: 20.2 KBDI-2\n" +
+	"3: 20.3 Create (encrypted)\n" +
+	"4: 20.4\n" +
+	"5: 0 (no data)\n" +
+	"6: 0 (control)\n" +
+	"tsid=0x0B1F\n"
+
+var streaminfoPrograms = []Program{
+	{Number: 1, VChannel: "20.1", Name: "KBDI-HD"},
+	{Number: 2, VChannel: "20.2", Name: "KBDI-2"},
+	{Number: 3, VChannel: "20.3", Name: "Create", Encrypted: true},
+	{Number: 4, VChannel: "20.4"},
+	{Number: 5, VChannel: "0", NoData: true},
+	{Number: 6, VChannel: "0", Control: true},
+}
+
+func TestTunerPrograms(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		programs []Program
+		ok       bool
+	}{
+		{
+			name:     "streaminfo",
+			s:        streaminfo,
+			programs: streaminfoPrograms,
+			ok:       true,
+		},
+		{
+			name: "not tuned",
+			s:    "none",
+			ok:   true,
+		},
+		{
+			name: "no programs yet",
+			s:    "tsid=0x0B1F\n",
+			ok:   true,
+		},
+		{
+			name: "bad program number",
+			s:    "x: 20.1 KBDI-HD\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes("/tuner0/streaminfo"),
+						},
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.s),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			programs, err := c.Tuner(0).Programs()
+			if err != nil && tt.ok {
+				t.Fatalf("failed to get programs: %v", err)
+			}
+			if err == nil && !tt.ok {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.programs, programs); diff != "" {
+				t.Fatalf("unexpected programs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerWatchStreamInfo(t *testing.T) {
+	const (
+		a = "1: 20.1 KBDI-HD\n2: 20.2 KBDI-2\ntsid=0x0B1F\n"
+		b = "3: 4.1 KWGN\ntsid=0x0C21\n"
+	)
+
+	// Programs only change in the second, fourth, and sixth values. The
+	// last value repeats until the watch stops.
+	var (
+		mu    sync.Mutex
+		infos = []string{a, a, b, b, "none", "none", a}
+	)
+
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		value := infos[0]
+		if len(infos) > 1 {
+			infos = infos[1:]
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/tuner0/streaminfo"),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes(value),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	psC, errC := c.Tuner(0).WatchStreamInfo(ctx, 5*time.Millisecond)
+
+	var got [][]Program
+	for i := 0; i < 4; i++ {
+		select {
+		case ps := <-psC:
+			got = append(got, ps)
+		case err := <-errC:
+			t.Fatalf("failed to watch stream info: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for programs")
+		}
+	}
+
+	want := [][]Program{
+		{
+			{Number: 1, VChannel: "20.1", Name: "KBDI-HD"},
+			{Number: 2, VChannel: "20.2", Name: "KBDI-2"},
+		},
+		{
+			{Number: 3, VChannel: "4.1", Name: "KWGN"},
+		},
+		nil,
+		{
+			{Number: 1, VChannel: "20.1", Name: "KBDI-HD"},
+			{Number: 2, VChannel: "20.2", Name: "KBDI-2"},
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected programs (-want +got):\n%s", diff)
+	}
+
+	// No more changes occur, and both channels close once canceled.
+	cancel()
+
+	for ps := range psC {
+		t.Fatalf("unexpected programs after cancelation: %v", ps)
+	}
+	for err := range errC {
+		t.Fatalf("unexpected error after cancelation: %v", err)
+	}
+}
+
+func TestTunerWatchStreamInfoError(t *testing.T) {
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/tuner0/streaminfo"),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("x: 20.1 KBDI-HD\n"),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	psC, errC := c.Tuner(0).WatchStreamInfo(context.Background(), 5*time.Millisecond)
+
+	if err := <-errC; err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if _, ok := <-psC; ok {
+		t.Fatal("expected programs channel to be closed")
+	}
+}
+
+func TestTunerOnChannelChange(t *testing.T) {
+	interval := channelChangeInterval
+	channelChangeInterval = 5 * time.Millisecond
+	defer func() { channelChangeInterval = interval }()
+
+	const (
+		a = "1: 20.1 KBDI-HD\n2: 20.2 KBDI-2\ntsid=0x0B1F\n"
+		b = "3: 4.1 KWGN\ntsid=0x0C21\n"
+	)
+
+	// The channel changes once. The last value repeats until the watch stops.
+	infos := []string{a, a, b}
+
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		// Requests are handled one at a time by the device's goroutine.
+		value := infos[0]
+		if len(infos) > 1 {
+			infos = infos[1:]
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes("/tuner0/streaminfo"),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes(value),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int
+	err := c.Tuner(0).OnChannelChange(ctx, func(old, new []Program) {
+		calls++
+
+		want := []Program{
+			{Number: 1, VChannel: "20.1", Name: "KBDI-HD"},
+			{Number: 2, VChannel: "20.2", Name: "KBDI-2"},
+		}
+		if diff := cmp.Diff(want, old); diff != "" {
+			t.Errorf("unexpected old programs (-want +got):\n%s", diff)
+		}
+
+		want = []Program{{Number: 3, VChannel: "4.1", Name: "KWGN"}}
+		if diff := cmp.Diff(want, new); diff != "" {
+			t.Errorf("unexpected new programs (-want +got):\n%s", diff)
+		}
+
+		// Stop watching after the first change.
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context canceled error, but got: %v", err)
+	}
+
+	if diff := cmp.Diff(1, calls); diff != "" {
+		t.Fatalf("unexpected number of callbacks (-want +got):\n%s", diff)
+	}
+}
+
+func TestTunerTuneProgram(t *testing.T) {
+	interval := tuneProgramInterval
+	tuneProgramInterval = 10 * time.Millisecond
+	defer func() { tuneProgramInterval = interval }()
+
+	tests := []struct {
+		name  string
+		infos []string
+		sets  []string
+		p     *Program
+	}{
+		{
+			name:  "HD program",
+			infos: []string{"none", "tsid=0x0B1F\n", streaminfo},
+			sets:  []string{"/tuner0/channel=auto:491000000", "/tuner0/program=1"},
+			p:     &streaminfoPrograms[0],
+		},
+		{
+			name:  "first viewable program",
+			infos: []string{"1: 0 (no data)\n2: 4.1 KWGN\n3: 4.2 Weather\n"},
+			sets:  []string{"/tuner0/channel=auto:491000000", "/tuner0/program=2"},
+			p:     &Program{Number: 2, VChannel: "4.1", Name: "KWGN"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				sets  []string
+				infos = tt.infos
+			)
+
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				var name, value string
+				for _, tag := range req.Tags {
+					switch tag.Type {
+					case libhdhomerun.TagGetsetName:
+						name = bytesStr(tag.Data)
+					case libhdhomerun.TagGetsetValue:
+						value = bytesStr(tag.Data)
+					}
+				}
+
+				if name == "/tuner0/streaminfo" {
+					value = infos[0]
+					if len(infos) > 1 {
+						infos = infos[1:]
+					}
+				} else {
+					sets = append(sets, name+"="+value)
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes(name),
+						},
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(value),
+						},
+					},
+				}, nil
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			p, err := c.Tuner(0).TuneProgram(ctx, Channel{
+				Modulation:  "auto",
+				FrequencyHz: 491000000,
+			})
+			if err != nil {
+				t.Fatalf("failed to tune program: %v", err)
+			}
+
+			done()
+
+			if diff := cmp.Diff(tt.p, p); diff != "" {
+				t.Fatalf("unexpected program (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.sets, sets); diff != "" {
+				t.Fatalf("unexpected set requests (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerTuneProgramContextCanceled(t *testing.T) {
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		var name string
+		for _, tag := range req.Tags {
+			if tag.Type == libhdhomerun.TagGetsetName {
+				name = bytesStr(tag.Data)
+			}
+		}
+
+		// Only encrypted programs are available.
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes(name),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("1: 7.1 KMGH (encrypted)\n"),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.Tuner(0).TuneProgram(ctx, Channel{
+		Modulation:  "auto",
+		FrequencyHz: 491000000,
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected context deadline exceeded, but got: %v", err)
+	}
+}
+
+func TestTunerForceUnlock(t *testing.T) {
+	const name = "/tuner1/lockkey"
+
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		want := &Packet{
+			Type: libhdhomerun.TypeGetsetReq,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes(name),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("force"),
+				},
+			},
+		}
+
+		if diff := cmp.Diff(want, req); diff != "" {
+			return nil, fmt.Errorf("unexpected force unlock request (-want +got):\n%s", diff)
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: []Tag{
+				{
+					Type: libhdhomerun.TagGetsetName,
+					Data: strBytes(name),
+				},
+				{
+					Type: libhdhomerun.TagGetsetValue,
+					Data: strBytes("none"),
+				},
+			},
+		}, nil
+	})
+	defer done()
+
+	if err := c.Tuner(1).ForceUnlock(); err != nil {
+		t.Fatalf("failed to force unlock: %v", err)
+	}
+}
+
+func TestTunerReset(t *testing.T) {
+	tests := []struct {
+		name    string
+		lockkey uint32
+		sets    []string
+	}{
+		{
+			name: "no lock key",
+			sets: []string{
+				"/tuner0/channel=none",
+				"/tuner0/target=none",
+			},
+		},
+		{
+			name:    "lock key",
+			lockkey: 0xdeadbeef,
+			sets: []string{
+				"/tuner0/channel=none",
+				"/tuner0/target=none",
+				"/tuner0/lockkey=none",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sets []string
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				var name, value string
+				var lockkey []byte
+				for _, tag := range req.Tags {
+					switch tag.Type {
+					case libhdhomerun.TagGetsetName:
+						name = bytesStr(tag.Data)
+					case libhdhomerun.TagGetsetValue:
+						value = bytesStr(tag.Data)
+					case libhdhomerun.TagGetsetLockkey:
+						lockkey = tag.Data
+					}
+				}
+
+				if tt.lockkey != 0 {
+					want := []byte{0xde, 0xad, 0xbe, 0xef}
+					if diff := cmp.Diff(want, lockkey); diff != "" {
+						return nil, fmt.Errorf("unexpected lock key (-want +got):\n%s", diff)
+					}
+				}
+
+				sets = append(sets, name+"="+value)
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: req.Tags,
+				}, nil
+			})
+
+			c.SetLockKey(tt.lockkey)
+
+			// Reset must be idempotent.
+			for i := 0; i < 2; i++ {
+				if err := c.Tuner(0).Reset(); err != nil {
+					t.Fatalf("failed to reset tuner: %v", err)
+				}
+			}
+
+			done()
+
+			want := append(tt.sets, tt.sets...)
+			if diff := cmp.Diff(want, sets); diff != "" {
+				t.Fatalf("unexpected set requests (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerResource(t *testing.T) {
+	tests := []struct {
+		name     string
+		tuner    int
+		resource string
+		s        string
+		ok       bool
+	}{
+		{
+			name:     "negative",
+			tuner:    -1,
+			resource: "channel",
+		},
+		{
+			name:     "OK",
+			tuner:    0,
+			resource: "channel",
+			s:        "/tuner0/channel",
+			ok:       true,
+		},
+		{
+			name:     "leading slash",
+			tuner:    2,
+			resource: "/lockkey",
+			s:        "/tuner2/lockkey",
+			ok:       true,
+		},
+		{
+			name:     "nested",
+			tuner:    10,
+			resource: "program/streaminfo",
+			s:        "/tuner10/program/streaminfo",
+			ok:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := TunerResource(tt.tuner, tt.resource)
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.s, s); diff != "" {
+				t.Fatalf("unexpected tuner resource (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseChannel(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		ch   Channel
+		ok   bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "none",
+			s:    "none",
+		},
+		{
+			name: "no modulation",
+			s:    ":489000000",
+		},
+		{
+			name: "bad frequency",
+			s:    "qam:foo",
+		},
+		{
+			name: "too many fields",
+			s:    "qam:489000000:1",
+		},
+		{
+			name: "qam",
+			s:    "qam:489000000",
+			ch: Channel{
+				Modulation:  "qam",
+				FrequencyHz: 489000000,
+			},
+			ok: true,
+		},
+		{
+			name: "auto",
+			s:    "auto:593000000",
+			ch: Channel{
+				Modulation:  "auto",
+				FrequencyHz: 593000000,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, err := ParseChannel(tt.s)
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.ch, ch); diff != "" {
+				t.Fatalf("unexpected channel (-want +got):\n%s", diff)
+			}
+
+			// The channel must format back to its original form.
+			if diff := cmp.Diff(tt.s, ch.String()); diff != "" {
+				t.Fatalf("unexpected channel string (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseChannelMap(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		m    ChannelMap
+		ok   bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "no medium",
+			s:    "us",
+		},
+		{
+			name: "empty country",
+			s:    "-bcast",
+		},
+		{
+			name: "too many fields",
+			s:    "us-bcast-hd",
+		},
+		{
+			name: "US broadcast",
+			s:    "us-bcast",
+			m:    ChannelMap{Country: "us", Medium: "bcast"},
+			ok:   true,
+		},
+		{
+			name: "US HRC cable",
+			s:    "us-hrc",
+			m:    ChannelMap{Country: "us", Medium: "hrc"},
+			ok:   true,
+		},
+		{
+			name: "EU cable",
+			s:    "eu-cable",
+			m:    ChannelMap{Country: "eu", Medium: "cable"},
+			ok:   true,
+		},
+		{
+			name: "KR cable",
+			s:    "kr-cable",
+			m:    ChannelMap{Country: "kr", Medium: "cable"},
+			ok:   true,
+		},
+		{
+			// Unknown channel maps are well-formed, but are not supported
+			// by any device.
+			name: "unknown",
+			s:    "zz-satellite",
+			m:    ChannelMap{Country: "zz", Medium: "satellite"},
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseChannelMap(tt.s)
+
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+			if !tt.ok {
+				return
+			}
+
+			if diff := cmp.Diff(tt.m, m); diff != "" {
+				t.Fatalf("unexpected channel map (-want +got):\n%s", diff)
+			}
+
+			// The channel map must format back to its original form.
+			if diff := cmp.Diff(tt.s, m.String()); diff != "" {
+				t.Fatalf("unexpected channel map string (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerChannel(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ch    *Channel
+	}{
+		{
+			name:  "none",
+			value: "none",
+		},
+		{
+			name:  "tuned",
+			value: "qam:489000000",
+			ch: &Channel{
+				Modulation:  "qam",
+				FrequencyHz: 489000000,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						req.Tags[0],
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.value),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			ch, err := c.Tuner(0).Channel()
+			if err != nil {
+				t.Fatalf("failed to get channel: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.ch, ch); diff != "" {
+				t.Fatalf("unexpected channel (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		target string
+	}{
+		{
+			name:  "none",
+			value: "none",
+		},
+		{
+			name:   "UDP",
+			value:  "udp://192.168.1.10:5000",
+			target: "udp://192.168.1.10:5000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes("/tuner0/target"),
+						},
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.value),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			target, err := c.Tuner(0).Target()
+			if err != nil {
+				t.Fatalf("failed to get target: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.target, target); diff != "" {
+				t.Fatalf("unexpected target (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerCapabilities(t *testing.T) {
+	const (
+		device = "channelmap: us-bcast us-cable us-hrc us-irc\nmodulation: 8vsb qam256 qam64\nauto-modulation: auto auto6t auto6c qam\n"
+		tuner  = "channelmap: eu-bcast eu-cable\nmodulation: t8dvbt t7dvbt a8qam64\nauto-modulation: auto auto8t\n"
+	)
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		caps   *TunerCaps
+		ch     Channel
+		ok     bool
+	}{
+		{
+			name: "tuner",
+			values: map[string]string{
+				"/tuner1/features": tuner,
+				"/sys/features":    device,
+			},
+			caps: &TunerCaps{
+				ChannelMaps: []ChannelMap{
+					{Country: "eu", Medium: "bcast"},
+					{Country: "eu", Medium: "cable"},
+				},
+				Modulations:     []string{"t8dvbt", "t7dvbt", "a8qam64"},
+				AutoModulations: []string{"auto", "auto8t"},
+			},
+			ch: Channel{Modulation: "t8dvbt", FrequencyHz: 506000000},
+			ok: true,
+		},
+		{
+			name: "tuner unsupported",
+			values: map[string]string{
+				"/tuner1/features": tuner,
+				"/sys/features":    device,
+			},
+			ch: Channel{Modulation: "8vsb", FrequencyHz: 509000000},
+		},
+		{
+			name: "device",
+			values: map[string]string{
+				"/sys/features": device,
+			},
+			caps: &TunerCaps{
+				ChannelMaps: []ChannelMap{
+					{Country: "us", Medium: "bcast"},
+					{Country: "us", Medium: "cable"},
+					{Country: "us", Medium: "hrc"},
+					{Country: "us", Medium: "irc"},
+				},
+				Modulations:     []string{"8vsb", "qam256", "qam64"},
+				AutoModulations: []string{"auto", "auto6t", "auto6c", "qam"},
+			},
+			ch: Channel{Modulation: "auto6t", FrequencyHz: 509000000},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				value := Tag{
+					Type: libhdhomerun.TagErrorMessage,
+					Data: strBytes(errorPrefix + unknownGetSet),
+				}
+				if v, ok := tt.values[bytesStr(req.Tags[0].Data)]; ok {
+					value = Tag{
+						Type: libhdhomerun.TagGetsetValue,
+						Data: strBytes(v),
+					}
+				}
+
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{req.Tags[0], value},
+				}, nil
+			})
+			defer done()
+
+			caps, err := c.Tuner(1).Capabilities()
+			if err != nil {
+				t.Fatalf("failed to get capabilities: %v", err)
+			}
+
+			if tt.caps != nil {
+				if diff := cmp.Diff(tt.caps, caps); diff != "" {
+					t.Fatalf("unexpected capabilities (-want +got):\n%s", diff)
+				}
+			}
+
+			if diff := cmp.Diff(tt.ok, caps.SupportsChannel(tt.ch)); diff != "" {
+				t.Fatalf("unexpected channel support (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerLockOwner(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ip    net.IP
+		ok    bool
+	}{
+		{
+			name:  "none",
+			value: "none",
+			ok:    true,
+		},
+		{
+			name:  "force",
+			value: "force",
+			ok:    true,
+		},
+		{
+			name:  "owner",
+			value: "192.168.1.20",
+			ip:    net.IPv4(192, 168, 1, 20),
+			ok:    true,
+		},
+		{
+			name:  "malformed",
+			value: "192.168.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, done := testClient(t, func(req *Packet) (*Packet, error) {
+				return &Packet{
+					Type: libhdhomerun.TypeGetsetRpy,
+					Tags: []Tag{
+						{
+							Type: libhdhomerun.TagGetsetName,
+							Data: strBytes("/tuner0/lockkey"),
+						},
+						{
+							Type: libhdhomerun.TagGetsetValue,
+							Data: strBytes(tt.value),
+						},
+					},
+				}, nil
+			})
+			defer done()
+
+			ip, err := c.Tuner(0).LockOwner()
+			if tt.ok && err != nil {
+				t.Fatalf("failed to get lock owner: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.ip, ip); diff != "" {
+				t.Fatalf("unexpected lock owner (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTunerSetChannel(t *testing.T) {
+	var got string
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		for _, tag := range req.Tags {
+			if tag.Type == libhdhomerun.TagGetsetValue {
+				got = bytesStr(tag.Data)
+			}
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: req.Tags,
+		}, nil
+	})
+
+	err := c.Tuner(0).SetChannel(Channel{
+		Modulation:  "auto",
+		FrequencyHz: 593000000,
+	})
+	if err != nil {
+		t.Fatalf("failed to set channel: %v", err)
+	}
+
+	done()
+
+	if diff := cmp.Diff("auto:593000000", got); diff != "" {
+		t.Fatalf("unexpected channel value (-want +got):\n%s", diff)
+	}
+}
+
+func TestTunerTuneAuto(t *testing.T) {
+	var name, value string
+	c, done := testClient(t, func(req *Packet) (*Packet, error) {
+		for _, tag := range req.Tags {
+			switch tag.Type {
+			case libhdhomerun.TagGetsetName:
+				name = bytesStr(tag.Data)
+			case libhdhomerun.TagGetsetValue:
+				value = bytesStr(tag.Data)
+			}
+		}
+
+		return &Packet{
+			Type: libhdhomerun.TypeGetsetRpy,
+			Tags: req.Tags,
+		}, nil
+	})
+
+	if err := c.Tuner(1).TuneAuto(593000000); err != nil {
+		t.Fatalf("failed to tune: %v", err)
+	}
+
+	done()
+
+	if diff := cmp.Diff("/tuner1/channel", name); diff != "" {
+		t.Fatalf("unexpected set name (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("auto:593000000", value); diff != "" {
+		t.Fatalf("unexpected channel value (-want +got):\n%s", diff)
+	}
+}